@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
 	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/extract"
 	"jemgunay/url-scraper/pkg/ingest"
+	"jemgunay/url-scraper/pkg/metrics"
+	"jemgunay/url-scraper/pkg/policy"
+	"jemgunay/url-scraper/pkg/ports"
 	"jemgunay/url-scraper/pkg/server"
 	"jemgunay/url-scraper/pkg/store"
 )
@@ -24,17 +33,125 @@ func main() {
 	}
 
 	logger := conf.Logger
+	registry := metrics.NewRegistry()
 
-	storage := store.New(logger, 50)
+	destinations, err := policy.New(conf.Destinations)
+	if err != nil {
+		logger.Fatal("failed to initialise destination policy", zap.Error(err))
+	}
+	// the destination policy is enforced on every connection, including those
+	// made to follow redirects
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = destinations.DialContext
+	// connect directly so that the policy can't be bypassed via a proxy
+	transport.Proxy = nil
 	httpClient := &http.Client{
-		Timeout: time.Second * time.Duration(conf.TimeoutSeconds),
+		Timeout:   time.Second * time.Duration(conf.TimeoutSeconds),
+		Transport: transport,
+		// honour each URL's follow redirects setting
+		CheckRedirect: ingest.CheckRedirect,
+	}
+	extractor, err := extract.New(conf.Ingest.Extraction)
+	if err != nil {
+		logger.Fatal("failed to initialise content extractor", zap.Error(err))
+	}
+
+	// open the store last so that it is always closed by the deferred func, as
+	// logger.Fatal exits without running deferred funcs
+	storage, benchmarks, err := newStorer(logger, conf.Store, store.NewBenchmarkStore(logger,
+		time.Hour*time.Duration(conf.Benchmarks.RetentionHours), conf.Benchmarks.MaxPerURL))
+	if err != nil {
+		logger.Fatal("failed to initialise store", zap.Error(err))
 	}
-	ingester := ingest.New(logger, storage, httpClient)
+	defer func() {
+		if err := storage.Close(); err != nil {
+			logger.Error("failed to close store", zap.Error(err))
+		}
+	}()
+	storage.RegisterMetrics(registry)
+
+	changes := store.NewChangeStore(logger,
+		time.Hour*time.Duration(conf.Benchmarks.RetentionHours), conf.Ingest.ChangeDetection.MaxHistoryPerURL)
+	extractions := store.NewExtractionStore(logger,
+		time.Hour*time.Duration(conf.Benchmarks.RetentionHours), conf.Ingest.Extraction.MaxHistoryPerURL)
+	ingester := ingest.New(logger, conf.Ingest, ingest.Deps{
+		Storage:     storage,
+		Benchmarks:  benchmarks,
+		Changes:     changes,
+		Extractions: extractions,
+		Jobs:        store.NewJobStore(logger, conf.Ingest.JobCapacity),
+		HTTPClient:  httpClient,
+		Extractor:   extractor,
+		Registry:    registry,
+	})
+	analyser := ingest.NewAnalyser(storage, benchmarks, conf.Benchmarks.StatsWindows)
+	certs := ingest.NewCertificateMonitor(storage, time.Hour*24*time.Duration(conf.Ingest.Certificates.ExpiryWarningDays))
 
 	// start HTTP server
 	logger.Info("starting HTTP server", zap.Int("port", conf.Port))
-	httpServer := server.New(logger, conf.Port, ingester, storage)
-	if err := httpServer.Run(); err != nil {
-		logger.Warn("HTTP server shut down")
+	httpServer := server.New(logger, conf.Port, conf.MaxBatchSize, server.Deps{
+		Ingester:     ingester,
+		Storage:      storage,
+		Benchmarks:   benchmarks,
+		Changes:      changes,
+		Extractions:  extractions,
+		Analyser:     analyser,
+		Certificates: certs,
+		Registry:     registry,
+	})
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- httpServer.Run()
+	}()
+
+	// block until we're signalled to terminate or the HTTP server fails
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		logger.Info("received shutdown signal")
+	case err := <-serverErr:
+		logger.Error("HTTP server shut down unexpectedly", zap.Error(err))
+	}
+
+	// shut down from the outside in: stop accepting requests, then drain the
+	// ingestion queue, and finally close the store
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(conf.ShutdownTimeoutSeconds))
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to gracefully shut down HTTP server", zap.Error(err))
+	}
+	if err := ingester.Close(shutdownCtx); err != nil {
+		logger.Error("failed to gracefully close ingester", zap.Error(err))
+	}
+	logger.Info("shut down gracefully")
+}
+
+// closableStorer is a ports.Storer which must be closed on shutdown.
+type closableStorer interface {
+	ports.Storer
+	io.Closer
+	RegisterMetrics(registry *metrics.Registry)
+}
+
+// newStorer initialises the ports.Storer backend selected in the store config,
+// along with the ports.BenchmarkStorer which records benchmarks in memory and,
+// for the disk backend, persists them alongside the records.
+func newStorer(logger config.Logger, conf config.Store, benchmarks *store.BenchmarkStore) (closableStorer,
+	ports.BenchmarkStorer, error) {
+	switch conf.Type {
+	case config.MemoryStore:
+		return store.New(logger, conf.Capacity), benchmarks, nil
+	case config.DiskStore:
+		snapshotInterval := time.Second * time.Duration(conf.SnapshotIntervalSeconds)
+		disk, err := store.NewDisk(logger, conf.Capacity, conf.Path, snapshotInterval, benchmarks)
+		if err != nil {
+			return nil, nil, err
+		}
+		return disk, disk.Benchmarks(), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported store type %q", conf.Type)
 	}
 }
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -12,21 +16,330 @@ import (
 
 // Config contains the service configuration.
 type Config struct {
-	Port   int  `yaml:"port"`
-	Debug  bool `yaml:"debug"`
-	Client `yaml:"client"`
-	Logger `yaml:"-"`
+	Port                   int  `yaml:"port"`
+	Debug                  bool `yaml:"debug"`
+	ShutdownTimeoutSeconds int  `yaml:"shutdown_timeout"`
+	MaxBatchSize           int  `yaml:"max_batch_size"`
+	Client                 `yaml:"client"`
+	Ingest                 `yaml:"ingest"`
+	Store                  `yaml:"store"`
+	Benchmarks             `yaml:"benchmarks"`
+	Logger                 `yaml:"-"`
 }
 
 // Client represents the HTTP client config.
 type Client struct {
+	TimeoutSeconds int          `yaml:"timeout"`
+	Destinations   Destinations `yaml:"destinations"`
+}
+
+// Destinations represents the policy of which destinations outgoing requests
+// may connect to. Deny lists take precedence over allow lists.
+type Destinations struct {
+	// BlockPrivate blocks loopback, private, link-local (including cloud
+	// metadata) and other non-public IP ranges, unless in AllowCIDRs.
+	BlockPrivate bool `yaml:"block_private"`
+	// AllowDomains restricts requests to these domains and their subdomains,
+	// if non-empty.
+	AllowDomains []string `yaml:"allow_domains"`
+	DenyDomains  []string `yaml:"deny_domains"`
+	AllowCIDRs   []string `yaml:"allow_cidrs"`
+	DenyCIDRs    []string `yaml:"deny_cidrs"`
+}
+
+// Ingest represents the URL ingestion and benchmark refresh config.
+type Ingest struct {
+	QueueCapacity          int `yaml:"queue_capacity"`
+	InsertWorkers          int `yaml:"insert_workers"`
+	RefreshWorkers         int `yaml:"refresh_workers"`
+	RefreshIntervalSeconds int `yaml:"refresh_interval"`
+	// RefreshJitter is the fraction (0-1) of each URL's refresh interval
+	// which is randomised.
+	RefreshJitter float64   `yaml:"refresh_jitter"`
+	JobCapacity   int       `yaml:"job_capacity"`
+	Retry         Retry     `yaml:"retry"`
+	RateLimit     RateLimit `yaml:"rate_limit"`
+	Robots        Robots    `yaml:"robots"`
+	// UserAgent is sent with every outgoing request and is the user agent
+	// robots.txt rules are matched against.
+	UserAgent string `yaml:"user_agent"`
+	// TrackingParams are the query params stripped from ingested URLs when
+	// canonicalising them. A trailing "*" matches any param with that prefix.
+	TrackingParams  []string        `yaml:"tracking_params"`
+	ChangeDetection ChangeDetection `yaml:"change_detection"`
+	Redirects       Redirects       `yaml:"redirects"`
+	Certificates    Certificates    `yaml:"certificates"`
+	Extraction      Extraction      `yaml:"extraction"`
+	Crawl           Crawl           `yaml:"crawl"`
+	LinkCheck       LinkCheck       `yaml:"link_check"`
+}
+
+// LinkCheck represents the limits of link checks.
+type LinkCheck struct {
+	// Workers is the number of links each link check checks concurrently.
+	Workers int `yaml:"workers"`
+	// TimeoutSeconds is the timeout of each page fetch and link check
+	// request.
 	TimeoutSeconds int `yaml:"timeout"`
+	// MaxLinks is the maximum number of unique links checked by each link
+	// check.
+	MaxLinks int `yaml:"max_links"`
+	// Capacity is the number of link checks to track before purging the
+	// oldest.
+	Capacity int `yaml:"capacity"`
+}
+
+// Crawl represents the limits of crawls.
+type Crawl struct {
+	// MaxDepth and MaxPages are the default and maximum limits of each
+	// crawl. MaxPages may not exceed the store capacity.
+	MaxDepth int `yaml:"max_depth"`
+	MaxPages int `yaml:"max_pages"`
+	// Capacity is the number of crawls to track before purging the oldest.
+	Capacity int `yaml:"capacity"`
+}
+
+// Extraction represents the rules extracting values from HTML responses.
+type Extraction struct {
+	// Domains are keyed by domain, e.g. "example.com", and apply to the domain
+	// and its subdomains. Only the most specific domain's rules apply.
+	Domains map[string][]ExtractionRule `yaml:"domains"`
+	// MaxHistoryPerURL is the number of extracted value versions retained per
+	// URL.
+	MaxHistoryPerURL int `yaml:"max_history_per_url"`
+}
+
+// ExtractionRule extracts a named value from an HTML response. See
+// ports.ExtractionRule.
+type ExtractionRule struct {
+	Name      string `yaml:"name"`
+	Selector  string `yaml:"selector"`
+	Attribute string `yaml:"attribute"`
+	Pattern   string `yaml:"pattern"`
+	Type      string `yaml:"type"`
+}
+
+// Certificates represents the TLS certificate inspection config.
+type Certificates struct {
+	// ExpiryWarningDays is the window in which certificates are flagged as
+	// expiring.
+	ExpiryWarningDays int `yaml:"expiry_warning_days"`
+}
+
+// Redirects represents the policy of which redirects benchmark requests may
+// follow.
+type Redirects struct {
+	MaxRedirects int `yaml:"max_redirects"`
+	// AllowCrossDomain allows redirects to hosts which are neither the
+	// original host nor one of its subdomains or parent domains.
+	AllowCrossDomain bool `yaml:"allow_cross_domain"`
+	// AllowHTTPSDowngrade allows redirects from https to http.
+	AllowHTTPSDowngrade bool `yaml:"allow_https_downgrade"`
+	// StoreResolvedURL stores ingested URLs under the final URL of their
+	// redirect chain rather than the submitted URL.
+	StoreResolvedURL bool `yaml:"store_resolved_url"`
+}
+
+// ChangeDetection represents how response bodies are normalised before being
+// hashed to detect content changes.
+type ChangeDetection struct {
+	IgnoreWhitespace bool `yaml:"ignore_whitespace"`
+	// StripPatterns are regular expressions whose matches are removed from
+	// response bodies, e.g. timestamps or CSRF tokens.
+	StripPatterns []string `yaml:"strip_patterns"`
+	// MaxHistoryPerURL is the number of content changes retained per URL.
+	MaxHistoryPerURL int `yaml:"max_history_per_url"`
+}
+
+// Robots represents the robots.txt compliance config.
+type Robots struct {
+	Enabled         bool `yaml:"enabled"`
+	CacheTTLSeconds int  `yaml:"cache_ttl"`
+}
+
+// Retry represents the retry policy of URL benchmark requests.
+type Retry struct {
+	// MaxAttempts includes the first attempt, i.e. 1 disables retries.
+	MaxAttempts       int `yaml:"max_attempts"`
+	BaseBackoffMillis int `yaml:"base_backoff"`
+	MaxBackoffMillis  int `yaml:"max_backoff"`
+	// Jitter is the fraction (0-1) of each backoff which is randomised.
+	Jitter               float64 `yaml:"jitter"`
+	RetryableStatusCodes []int   `yaml:"retryable_status_codes"`
+}
+
+// RateLimit represents the politeness limits applied to outgoing requests. The
+// default HostLimit applies to each host individually; Domains overrides it
+// for specific domains and their subdomains.
+type RateLimit struct {
+	HostLimit `yaml:",inline"`
+	// Domains are keyed by domain, e.g. "httpbin.org". Unset fields fall back
+	// to the default HostLimit.
+	Domains map[string]HostLimit `yaml:"domains"`
+}
+
+// HostLimit represents the request limits of a single host.
+type HostLimit struct {
+	// RequestsPerSecond is the token bucket refill rate; 0 disables rate
+	// limiting.
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+	// MaxConcurrency is the maximum number of in-flight requests; 0 disables
+	// the concurrency limit.
+	MaxConcurrency int `yaml:"max_concurrency"`
+}
+
+func (h HostLimit) validate() error {
+	switch {
+	case h.RequestsPerSecond < 0:
+		return errors.New("invalid requests per second provided")
+	case h.Burst < 0:
+		return errors.New("invalid burst provided")
+	case h.MaxConcurrency < 0:
+		return errors.New("invalid max concurrency provided")
+	}
+	return nil
+}
+
+// StoreType is the storage backend used to persist Records.
+type StoreType string
+
+const (
+	// MemoryStore keeps Records in memory only; they are lost on restart.
+	MemoryStore StoreType = "memory"
+	// DiskStore persists Records to an append-only log with periodic
+	// compacted snapshots so that they survive restarts.
+	DiskStore StoreType = "disk"
+)
+
+// Store represents the Record storage config.
+type Store struct {
+	Capacity                int       `yaml:"capacity"`
+	Type                    StoreType `yaml:"type"`
+	Path                    string    `yaml:"path"`
+	SnapshotIntervalSeconds int       `yaml:"snapshot_interval"`
+}
+
+// Benchmarks represents the benchmark history storage config.
+type Benchmarks struct {
+	RetentionHours int      `yaml:"retention"`
+	MaxPerURL      int      `yaml:"max_per_url"`
+	StatsWindows   []Window `yaml:"stats_windows"`
+}
+
+// Window is a named time window, e.g. "1h" or "7d".
+type Window struct {
+	Name string
+	time.Duration
+}
+
+// UnmarshalYAML decodes a Window from a duration string. In addition to the
+// units supported by time.ParseDuration, "d" (days) is supported.
+func (w *Window) UnmarshalYAML(value *yaml.Node) error {
+	window, err := ParseWindow(value.Value)
+	if err != nil {
+		return err
+	}
+	*w = window
+	return nil
+}
+
+// ParseWindow parses a Window from a duration string. In addition to the units
+// supported by time.ParseDuration, "d" (days) is supported.
+func ParseWindow(s string) (Window, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || n <= 0 {
+			return Window{}, fmt.Errorf("invalid window %q", s)
+		}
+		return Window{Name: s, Duration: time.Hour * 24 * time.Duration(n)}, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return Window{}, fmt.Errorf("invalid window %q", s)
+	}
+	return Window{Name: s, Duration: d}, nil
 }
 
 // New initialises a Config from a yaml file on disk. It also initialises a
 // service Logger.
 func New(filePath string) (Config, error) {
-	conf := Config{}
+	conf := Config{
+		ShutdownTimeoutSeconds: 30,
+		MaxBatchSize:           100,
+		Client: Client{
+			Destinations: Destinations{
+				BlockPrivate: true,
+			},
+		},
+		Ingest: Ingest{
+			QueueCapacity:          10,
+			InsertWorkers:          3,
+			RefreshWorkers:         3,
+			RefreshIntervalSeconds: 60,
+			RefreshJitter:          0.1,
+			JobCapacity:            10000,
+			Retry: Retry{
+				MaxAttempts:          3,
+				BaseBackoffMillis:    200,
+				MaxBackoffMillis:     5000,
+				Jitter:               0.5,
+				RetryableStatusCodes: []int{429, 502, 503, 504},
+			},
+			RateLimit: RateLimit{
+				HostLimit: HostLimit{
+					RequestsPerSecond: 5,
+					Burst:             5,
+					MaxConcurrency:    2,
+				},
+			},
+			Robots: Robots{
+				Enabled:         true,
+				CacheTTLSeconds: 3600,
+			},
+			UserAgent:      "url-scraper/1.0",
+			TrackingParams: []string{"utm_*", "gclid", "fbclid", "mc_cid", "mc_eid"},
+			ChangeDetection: ChangeDetection{
+				MaxHistoryPerURL: 100,
+			},
+			Redirects: Redirects{
+				MaxRedirects:     10,
+				AllowCrossDomain: true,
+			},
+			Certificates: Certificates{
+				ExpiryWarningDays: 30,
+			},
+			Extraction: Extraction{
+				MaxHistoryPerURL: 100,
+			},
+			Crawl: Crawl{
+				MaxDepth: 3,
+				MaxPages: 25,
+				Capacity: 100,
+			},
+			LinkCheck: LinkCheck{
+				Workers:        5,
+				TimeoutSeconds: 10,
+				MaxLinks:       1000,
+				Capacity:       100,
+			},
+		},
+		Store: Store{
+			Capacity:                50,
+			Type:                    MemoryStore,
+			SnapshotIntervalSeconds: 300,
+		},
+		Benchmarks: Benchmarks{
+			RetentionHours: 24 * 7,
+			MaxPerURL:      10000,
+			StatsWindows: []Window{
+				{Name: "1h", Duration: time.Hour},
+				{Name: "24h", Duration: time.Hour * 24},
+				{Name: "7d", Duration: time.Hour * 24 * 7},
+			},
+		},
+	}
 
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -60,6 +373,95 @@ func (c Config) Validate() error {
 		return errors.New("logger is uninitialised")
 	case c.Port == 0:
 		return errors.New("invalid port config provided")
+	case c.ShutdownTimeoutSeconds <= 0:
+		return errors.New("invalid shutdown timeout provided")
+	case c.MaxBatchSize <= 0:
+		return errors.New("invalid max batch size provided")
+	case c.Ingest.QueueCapacity < 0:
+		return errors.New("invalid ingest queue capacity provided")
+	case c.Ingest.InsertWorkers <= 0:
+		return errors.New("invalid ingest insert worker count provided")
+	case c.Ingest.RefreshWorkers <= 0:
+		return errors.New("invalid ingest refresh worker count provided")
+	case c.Ingest.RefreshIntervalSeconds <= 0:
+		return errors.New("invalid ingest refresh interval provided")
+	case c.Ingest.RefreshJitter < 0 || c.Ingest.RefreshJitter > 1:
+		return errors.New("invalid ingest refresh jitter provided")
+	case c.Ingest.JobCapacity <= 0:
+		return errors.New("invalid ingest job capacity provided")
+	case c.Ingest.Retry.MaxAttempts <= 0:
+		return errors.New("invalid retry max attempts provided")
+	case c.Ingest.Retry.BaseBackoffMillis <= 0:
+		return errors.New("invalid retry base backoff provided")
+	case c.Ingest.Retry.MaxBackoffMillis < c.Ingest.Retry.BaseBackoffMillis:
+		return errors.New("retry max backoff must not be less than base backoff")
+	case c.Ingest.Retry.Jitter < 0 || c.Ingest.Retry.Jitter > 1:
+		return errors.New("invalid retry jitter provided")
+	case c.Ingest.Robots.CacheTTLSeconds <= 0:
+		return errors.New("invalid robots cache TTL provided")
+	case c.Ingest.UserAgent == "":
+		return errors.New("user agent must be provided")
+	case c.Ingest.ChangeDetection.MaxHistoryPerURL <= 0:
+		return errors.New("invalid change detection max history per URL provided")
+	case c.Ingest.Redirects.MaxRedirects < 0:
+		return errors.New("invalid max redirects provided")
+	case c.Ingest.Certificates.ExpiryWarningDays < 0:
+		return errors.New("invalid certificate expiry warning days provided")
+	case c.Ingest.Extraction.MaxHistoryPerURL <= 0:
+		return errors.New("invalid extraction max history per URL provided")
+	case c.Ingest.Crawl.MaxDepth <= 0:
+		return errors.New("invalid crawl max depth provided")
+	case c.Ingest.Crawl.MaxPages <= 0:
+		return errors.New("invalid crawl max pages provided")
+	case c.Ingest.Crawl.Capacity <= 0:
+		return errors.New("invalid crawl capacity provided")
+	case c.Ingest.LinkCheck.Workers <= 0:
+		return errors.New("invalid link check workers provided")
+	case c.Ingest.LinkCheck.TimeoutSeconds <= 0:
+		return errors.New("invalid link check timeout provided")
+	case c.Ingest.LinkCheck.MaxLinks <= 0:
+		return errors.New("invalid link check max links provided")
+	case c.Ingest.LinkCheck.Capacity <= 0:
+		return errors.New("invalid link check capacity provided")
+	case c.Store.Capacity <= 0:
+		return errors.New("invalid store capacity provided")
+	case c.Ingest.Crawl.MaxPages > c.Store.Capacity:
+		// a single crawl would otherwise evict every other stored URL
+		return errors.New("crawl max pages exceeds store capacity")
+	case c.Store.Type != MemoryStore && c.Store.Type != DiskStore:
+		return fmt.Errorf("invalid store type %q provided", c.Store.Type)
+	case c.Store.Type == DiskStore && c.Store.Path == "":
+		return errors.New("store path must be provided for disk store")
+	case c.Store.SnapshotIntervalSeconds <= 0:
+		return errors.New("invalid store snapshot interval provided")
+	case c.Benchmarks.RetentionHours <= 0:
+		return errors.New("invalid benchmark retention provided")
+	case c.Benchmarks.MaxPerURL <= 0:
+		return errors.New("invalid benchmark max per URL provided")
+	case len(c.Benchmarks.StatsWindows) == 0:
+		return errors.New("at least one benchmark stats window must be provided")
+	}
+
+	if err := c.Ingest.RateLimit.validate(); err != nil {
+		return fmt.Errorf("invalid rate limit config: %w", err)
+	}
+	for domain, limit := range c.Ingest.RateLimit.Domains {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("invalid rate limit config for domain %s: %w", domain, err)
+		}
+	}
+
+	for _, pattern := range c.Ingest.ChangeDetection.StripPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid change detection strip pattern %q provided: %w", pattern, err)
+		}
+	}
+
+	retention := time.Hour * time.Duration(c.Benchmarks.RetentionHours)
+	for _, window := range c.Benchmarks.StatsWindows {
+		if window.Duration > retention {
+			return fmt.Errorf("benchmark stats window %s exceeds benchmark retention", window.Name)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name          string
+		yaml          string
+		expectedError string
+		assert        func(t *testing.T, conf Config)
+	}{
+		{
+			name: "defaults",
+			yaml: "port: 8080",
+			assert: func(t *testing.T, conf Config) {
+				require.Equal(t, 10, conf.Ingest.QueueCapacity)
+				require.Equal(t, 3, conf.Ingest.InsertWorkers)
+				require.Equal(t, 3, conf.Ingest.RefreshWorkers)
+				require.Equal(t, 60, conf.Ingest.RefreshIntervalSeconds)
+				require.Equal(t, 0.1, conf.Ingest.RefreshJitter)
+				require.Equal(t, Redirects{MaxRedirects: 10, AllowCrossDomain: true}, conf.Ingest.Redirects)
+				require.Equal(t, 50, conf.Store.Capacity)
+				require.Equal(t, 25, conf.Ingest.Crawl.MaxPages)
+				require.Equal(t, MemoryStore, conf.Store.Type)
+			},
+		},
+		{
+			name: "overrides",
+			yaml: "port: 8080\ningest:\n  insert_workers: 8\n  refresh_interval: 5\nstore:\n  capacity: 500\n" +
+				"benchmarks:\n  stats_windows: [\"15m\", \"2d\"]\n",
+			assert: func(t *testing.T, conf Config) {
+				require.Equal(t, 8, conf.Ingest.InsertWorkers)
+				require.Equal(t, 5, conf.Ingest.RefreshIntervalSeconds)
+				require.Equal(t, 3, conf.Ingest.RefreshWorkers)
+				require.Equal(t, 500, conf.Store.Capacity)
+				require.Equal(t, []Window{
+					{Name: "15m", Duration: 15 * time.Minute},
+					{Name: "2d", Duration: 48 * time.Hour},
+				}, conf.Benchmarks.StatsWindows)
+			},
+		},
+		{
+			name:          "invalid worker count",
+			yaml:          "port: 8080\ningest:\n  refresh_workers: 0\n",
+			expectedError: "invalid ingest refresh worker count provided",
+		},
+		{
+			name:          "invalid store capacity",
+			yaml:          "port: 8080\nstore:\n  capacity: -1\n",
+			expectedError: "invalid store capacity provided",
+		},
+		{
+			name:          "crawl max pages exceeds store capacity",
+			yaml:          "port: 8080\ningest:\n  crawl:\n    max_pages: 51\n",
+			expectedError: "crawl max pages exceeds store capacity",
+		},
+		{
+			name:          "invalid window",
+			yaml:          "port: 8080\nbenchmarks:\n  stats_windows: [\"1w\"]\n",
+			expectedError: `invalid window "1w"`,
+		},
+		{
+			name:          "invalid strip pattern",
+			yaml:          "port: 8080\ningest:\n  change_detection:\n    strip_patterns: [\"[a-\"]\n",
+			expectedError: `invalid change detection strip pattern "[a-" provided`,
+		},
+		{
+			name:          "window exceeds retention",
+			yaml:          "port: 8080\nbenchmarks:\n  retention: 1\n  stats_windows: [\"2h\"]\n",
+			expectedError: "benchmark stats window 2h exceeds benchmark retention",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.yaml), 0o644))
+
+			conf, err := New(path)
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			tt.assert(t, conf)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/internal/domain"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// numberReplacer strips the thousands separators and whitespace commonly
+// found in formatted numbers, e.g. "1,299.00".
+var numberReplacer = strings.NewReplacer(",", "", " ", "", "\u00a0", "")
+
+// Extractor extracts values from HTML documents according to the extraction
+// rules configured for each domain and those of each URL.
+type Extractor struct {
+	domains map[string][]rule
+}
+
+// rule is a compiled ports.ExtractionRule.
+type rule struct {
+	name      string
+	selector  selector
+	attribute string
+	pattern   *regexp.Regexp
+	number    bool
+}
+
+// New initialises a new Extractor from the extraction config.
+func New(conf config.Extraction) (*Extractor, error) {
+	e := &Extractor{domains: make(map[string][]rule, len(conf.Domains))}
+	for domain, rules := range conf.Domains {
+		specs := make([]ports.ExtractionRule, 0, len(rules))
+		for _, r := range rules {
+			specs = append(specs, ports.ExtractionRule(r))
+		}
+
+		compiled, err := compile(specs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extraction rules for domain %s: %w", domain, err)
+		}
+		e.domains[strings.ToLower(domain)] = compiled
+	}
+	return e, nil
+}
+
+// Validate validates a URL's extraction rules.
+func Validate(rules []ports.ExtractionRule) error {
+	_, err := compile(rules)
+	return err
+}
+
+// compile compiles rules, validating that they are uniquely named.
+func compile(rules []ports.ExtractionRule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	names := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, errors.New("missing extraction rule name")
+		}
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate extraction rule %q", r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		sel, err := parseSelector(r.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("extraction rule %q: %w", r.Name, err)
+		}
+		c := rule{
+			name:      r.Name,
+			selector:  sel,
+			attribute: strings.ToLower(r.Attribute),
+		}
+		if r.Pattern != "" {
+			if c.pattern, err = regexp.Compile(r.Pattern); err != nil {
+				return nil, fmt.Errorf("extraction rule %q: invalid pattern: %w", r.Name, err)
+			}
+		}
+		switch r.Type {
+		case "", ports.ExtractString:
+		case ports.ExtractNumber:
+			c.number = true
+		default:
+			return nil, fmt.Errorf("extraction rule %q: invalid type %q", r.Name, r.Type)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// Extract extracts values from an HTML document fetched from host. The rules
+// of host's most specific configured domain apply, followed by urlRules, which
+// override domain rules of the same name. It returns the values extracted at
+// the given time and a description of each rule which failed.
+func (e *Extractor) Extract(host string, urlRules []ports.ExtractionRule, body []byte,
+	at time.Time) ([]ports.ExtractedValue, []string) {
+	rules := e.rules(host)
+	if len(urlRules) > 0 {
+		compiled, err := compile(urlRules)
+		if err != nil {
+			return nil, []string{err.Error()}
+		}
+		rules = merge(rules, compiled)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, []string{fmt.Sprintf("failed to parse HTML: %s", err)}
+	}
+
+	var (
+		values   []ports.ExtractedValue
+		failures []string
+	)
+	for _, r := range rules {
+		value, err := r.extract(doc)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("extraction rule %q: %s", r.name, err))
+			continue
+		}
+		values = append(values, ports.ExtractedValue{
+			Timestamp: at,
+			Rule:      r.name,
+			Value:     value,
+		})
+	}
+	return values, failures
+}
+
+// rules returns the rules of host's most specific configured domain.
+func (e *Extractor) rules(host string) []rule {
+	rules, _ := domain.Match(e.domains, host)
+	return rules
+}
+
+// merge returns the domain rules with any of the same name replaced by a URL
+// rule, followed by the remaining URL rules.
+func merge(domainRules, urlRules []rule) []rule {
+	merged := make([]rule, 0, len(domainRules)+len(urlRules))
+	overrides := make(map[string]rule, len(urlRules))
+	for _, r := range urlRules {
+		overrides[r.name] = r
+	}
+
+	for _, r := range domainRules {
+		if override, ok := overrides[r.name]; ok {
+			r = override
+			delete(overrides, r.name)
+		}
+		merged = append(merged, r)
+	}
+	for _, r := range urlRules {
+		if _, ok := overrides[r.name]; ok {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// extract extracts the rule's value from doc, which is either a string or a
+// float64.
+func (r rule) extract(doc *html.Node) (interface{}, error) {
+	n := r.selector.find(doc)
+	if n == nil {
+		return nil, errors.New("no element matches selector")
+	}
+
+	raw := text(n)
+	if r.attribute != "" {
+		val, ok := lookupAttr(n, r.attribute)
+		if !ok {
+			return nil, fmt.Errorf("element has no %s attribute", r.attribute)
+		}
+		raw = strings.TrimSpace(val)
+	}
+
+	if r.pattern != nil {
+		match := r.pattern.FindStringSubmatch(raw)
+		if match == nil {
+			return nil, fmt.Errorf("value %q doesn't match pattern", raw)
+		}
+		raw = match[0]
+		if len(match) > 1 {
+			raw = match[1]
+		}
+	}
+
+	if !r.number {
+		return raw, nil
+	}
+	number, err := strconv.ParseFloat(numberReplacer.Replace(raw), 64)
+	if err != nil {
+		return nil, fmt.Errorf("value %q isn't a number", raw)
+	}
+	return number, nil
+}
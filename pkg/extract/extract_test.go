@@ -0,0 +1,136 @@
+package extract
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestExtractor_Extract(t *testing.T) {
+	at := time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC)
+
+	extractor, err := New(config.Extraction{
+		Domains: map[string][]config.ExtractionRule{
+			"example.com": {
+				{Name: "title", Selector: "h1"},
+				{Name: "price", Selector: "span[itemprop=price]", Pattern: `[\d,.]+`, Type: ports.ExtractNumber},
+			},
+			"api.example.com": {
+				{Name: "sku", Selector: "li.sale", Attribute: "data-sku"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		host             string
+		urlRules         []ports.ExtractionRule
+		expected         map[string]interface{}
+		expectedFailures int
+	}{
+		{
+			name:     "domain rules",
+			host:     "www.example.com:8080",
+			expected: map[string]interface{}{"title": "Widget", "price": 1299.0},
+		},
+		{
+			name:     "most specific domain rules",
+			host:     "api.example.com",
+			expected: map[string]interface{}{"sku": "b2"},
+		},
+		{
+			name: "URL rules override domain rules",
+			host: "example.com",
+			urlRules: []ports.ExtractionRule{
+				{Name: "price", Selector: "span", Attribute: "content", Type: ports.ExtractString},
+				{Name: "version", Selector: "a", Attribute: "href", Pattern: `v(\d+\.\d+\.\d+)`},
+			},
+			expected: map[string]interface{}{"title": "Widget", "price": "1299.00", "version": "2.3.1"},
+		},
+		{
+			name: "failures",
+			host: "other.com",
+			urlRules: []ports.ExtractionRule{
+				{Name: "missing element", Selector: "table"},
+				{Name: "missing attribute", Selector: "h1", Attribute: "href"},
+				{Name: "unmatched pattern", Selector: "h1", Pattern: `\d+`},
+				{Name: "not a number", Selector: "h1", Type: ports.ExtractNumber},
+				{Name: "heading", Selector: "/html/body/div[2]/h1"},
+			},
+			expected:         map[string]interface{}{"heading": "Gadget"},
+			expectedFailures: 4,
+		},
+		{
+			name:     "no rules",
+			host:     "other.com",
+			expected: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, failures := extractor.Extract(tt.host, tt.urlRules, []byte(testDocument), at)
+			require.Len(t, failures, tt.expectedFailures, failures)
+
+			actual := make(map[string]interface{}, len(values))
+			for _, value := range values {
+				require.Equal(t, at, value.Timestamp)
+				actual[value.Rule] = value.Value
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []ports.ExtractionRule
+		valid bool
+	}{
+		{
+			name:  "valid",
+			rules: []ports.ExtractionRule{{Name: "a", Selector: "h1"}, {Name: "b", Selector: "//h1", Type: ports.ExtractNumber}},
+			valid: true,
+		},
+		{
+			name:  "missing name",
+			rules: []ports.ExtractionRule{{Selector: "h1"}},
+		},
+		{
+			name:  "duplicate name",
+			rules: []ports.ExtractionRule{{Name: "a", Selector: "h1"}, {Name: "a", Selector: "h2"}},
+		},
+		{
+			name:  "invalid selector",
+			rules: []ports.ExtractionRule{{Name: "a", Selector: "h1 >"}},
+		},
+		{
+			name:  "invalid pattern",
+			rules: []ports.ExtractionRule{{Name: "a", Selector: "h1", Pattern: "("}},
+		},
+		{
+			name:  "invalid type",
+			rules: []ports.ExtractionRule{{Name: "a", Selector: "h1", Type: "bool"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.rules)
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	_, err := New(config.Extraction{Domains: map[string][]config.ExtractionRule{"example.com": {{Name: "a"}}}})
+	require.ErrorContains(t, err, "invalid extraction rules for domain example.com")
+}
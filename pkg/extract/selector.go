@@ -0,0 +1,496 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector matches HTML elements. It is compiled from either a CSS selector or
+// an XPath-like path, and matches an element if any of its paths do.
+type selector []path
+
+// path is a sequence of steps, each matching an element relative to the
+// element matched by the previous step.
+type path []step
+
+// step matches a single element.
+type step struct {
+	// child requires the element to be a child of the previous step's
+	// element, otherwise it may be any descendant. If the first step is a
+	// child, it must be the document's root element.
+	child bool
+	// tag is lowercase; an empty tag matches any element
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatcher
+	// index is the 1-based position of the element among its sibling elements
+	// with the same tag; 0 matches any position.
+	index int
+}
+
+// attrMatcher matches an element attribute.
+type attrMatcher struct {
+	key   string
+	value string
+	// exists only requires the attribute to be present
+	exists bool
+}
+
+// parseSelector parses a CSS selector, or an XPath-like path if s starts with
+// "/".
+func parseSelector(s string) (selector, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty selector")
+	}
+
+	p := &parser{s: s}
+	if strings.HasPrefix(s, "/") {
+		return p.parseXPath()
+	}
+	return p.parseCSS()
+}
+
+// find returns the first element in document order matched by the selector,
+// or nil if there isn't one.
+func (sel selector) find(root *html.Node) *html.Node {
+	if root.Type == html.ElementNode {
+		for _, p := range sel {
+			if p.match(len(p)-1, root) {
+				return root
+			}
+		}
+	}
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if n := sel.find(c); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// match determines whether n matches the path up to and including step i.
+func (p path) match(i int, n *html.Node) bool {
+	if !p[i].match(n) {
+		return false
+	}
+
+	parent := elementParent(n)
+	if i == 0 {
+		return !p[0].child || parent == nil
+	}
+	if p[i].child {
+		return parent != nil && p.match(i-1, parent)
+	}
+	for ancestor := parent; ancestor != nil; ancestor = elementParent(ancestor) {
+		if p.match(i-1, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// match determines whether n matches the step, ignoring its relationship to
+// other elements.
+func (s step) match(n *html.Node) bool {
+	if n.Type != html.ElementNode || (s.tag != "" && n.Data != s.tag) {
+		return false
+	}
+	if s.id != "" && attr(n, "id") != s.id {
+		return false
+	}
+
+	classes := strings.Fields(attr(n, "class"))
+	for _, class := range s.classes {
+		if !contains(classes, class) {
+			return false
+		}
+	}
+
+	for _, a := range s.attrs {
+		val, ok := lookupAttr(n, a.key)
+		if !ok || (!a.exists && val != a.value) {
+			return false
+		}
+	}
+
+	if s.index > 0 {
+		position := 1
+		for sibling := n.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+			if sibling.Type == html.ElementNode && (s.tag == "" || sibling.Data == s.tag) {
+				position++
+			}
+		}
+		if position != s.index {
+			return false
+		}
+	}
+	return true
+}
+
+// elementParent returns the parent of n if it is an element, otherwise nil.
+func elementParent(n *html.Node) *html.Node {
+	if n.Parent == nil || n.Parent.Type != html.ElementNode {
+		return nil
+	}
+	return n.Parent
+}
+
+// lookupAttr returns the value of an element's attribute and whether it is
+// set.
+func lookupAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// attr returns the value of an element's attribute, or an empty string if it
+// isn't set.
+func attr(n *html.Node, key string) string {
+	val, _ := lookupAttr(n, key)
+	return val
+}
+
+// text returns the text content of n and its descendants with whitespace
+// collapsed.
+func text(n *html.Node) string {
+	b := &strings.Builder{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parser parses selectors. The supported CSS syntax is type (e.g. "div") and
+// universal ("*") selectors, IDs (e.g. "#main"), classes (e.g. ".price"),
+// attribute presence and equality (e.g. "[data-id]", `[itemprop="price"]`),
+// :first-of-type and :nth-of-type(n), descendant (" ") and child (">")
+// combinators and comma-separated groups. The supported XPath syntax is
+// absolute paths of child ("/") and descendant ("//") steps, each an element
+// name or "*" with optional position (e.g. "[2]"), attribute presence (e.g.
+// "[@href]") and attribute equality (e.g. "[@class='price']") predicates.
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) parseCSS() (selector, error) {
+	var sel selector
+	for {
+		path, err := p.parseCSSPath()
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, path)
+
+		p.skipSpace()
+		if p.done() {
+			return sel, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("unexpected character %q", p.peek())
+		}
+	}
+}
+
+func (p *parser) parseCSSPath() (path, error) {
+	p.skipSpace()
+	first, err := p.parseCSSStep(false)
+	if err != nil {
+		return nil, err
+	}
+	steps := path{first}
+
+	for {
+		spaced := p.skipSpace()
+		if p.done() || p.peek() == ',' {
+			return steps, nil
+		}
+
+		child := p.consume('>')
+		if child {
+			p.skipSpace()
+		} else if !spaced {
+			return nil, p.errorf("unexpected character %q", p.peek())
+		}
+
+		next, err := p.parseCSSStep(child)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, next)
+	}
+}
+
+func (p *parser) parseCSSStep(child bool) (step, error) {
+	s := step{child: child}
+	start := p.pos
+
+	if p.consume('*') {
+		// matches any element
+	} else if isIdentChar(p.peek()) {
+		s.tag = strings.ToLower(p.ident())
+	}
+
+	for !p.done() {
+		var err error
+		switch {
+		case p.consume('#'):
+			if s.id = p.ident(); s.id == "" {
+				return s, p.errorf("missing ID")
+			}
+		case p.consume('.'):
+			class := p.ident()
+			if class == "" {
+				return s, p.errorf("missing class")
+			}
+			s.classes = append(s.classes, class)
+		case p.consume('['):
+			err = p.parseCSSAttr(&s)
+		case p.consume(':'):
+			err = p.parsePseudoClass(&s)
+		default:
+			if p.pos == start {
+				return s, p.errorf("unexpected character %q", p.peek())
+			}
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+
+	if p.pos == start {
+		return s, p.errorf("missing selector")
+	}
+	return s, nil
+}
+
+// parseCSSAttr parses an attribute selector following its opening bracket.
+func (p *parser) parseCSSAttr(s *step) error {
+	p.skipSpace()
+	key := strings.ToLower(p.ident())
+	if key == "" {
+		return p.errorf("missing attribute name")
+	}
+	p.skipSpace()
+
+	matcher := attrMatcher{key: key, exists: true}
+	if p.consume('=') {
+		p.skipSpace()
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		matcher = attrMatcher{key: key, value: value}
+		p.skipSpace()
+	}
+	if !p.consume(']') {
+		return p.errorf("unterminated attribute selector")
+	}
+
+	s.attrs = append(s.attrs, matcher)
+	return nil
+}
+
+// parsePseudoClass parses a pseudo-class following its colon.
+func (p *parser) parsePseudoClass(s *step) error {
+	switch name := p.ident(); name {
+	case "first-of-type":
+		s.index = 1
+	case "nth-of-type":
+		if !p.consume('(') {
+			return p.errorf("missing :nth-of-type position")
+		}
+		p.skipSpace()
+		index, err := p.index()
+		if err != nil {
+			return err
+		}
+		p.skipSpace()
+		if !p.consume(')') {
+			return p.errorf("unterminated :nth-of-type")
+		}
+		s.index = index
+	default:
+		return p.errorf("unsupported pseudo-class %q", name)
+	}
+	return nil
+}
+
+func (p *parser) parseXPath() (selector, error) {
+	var steps path
+	for !p.done() {
+		s := step{}
+		switch {
+		case strings.HasPrefix(p.s[p.pos:], "//"):
+			p.pos += 2
+		case p.consume('/'):
+			s.child = true
+		default:
+			return nil, p.errorf("unexpected character %q", p.peek())
+		}
+
+		if !p.consume('*') {
+			if s.tag = strings.ToLower(p.ident()); s.tag == "" {
+				return nil, p.errorf("missing element name")
+			}
+		}
+
+		for p.consume('[') {
+			if err := p.parseXPathPredicate(&s); err != nil {
+				return nil, err
+			}
+		}
+		steps = append(steps, s)
+	}
+	return selector{steps}, nil
+}
+
+// parseXPathPredicate parses a predicate following its opening bracket.
+func (p *parser) parseXPathPredicate(s *step) error {
+	p.skipSpace()
+	if p.consume('@') {
+		key := strings.ToLower(p.ident())
+		if key == "" {
+			return p.errorf("missing attribute name")
+		}
+		p.skipSpace()
+
+		matcher := attrMatcher{key: key, exists: true}
+		if p.consume('=') {
+			p.skipSpace()
+			value, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			matcher = attrMatcher{key: key, value: value}
+			p.skipSpace()
+		}
+		s.attrs = append(s.attrs, matcher)
+	} else {
+		index, err := p.index()
+		if err != nil {
+			return err
+		}
+		s.index = index
+		p.skipSpace()
+	}
+
+	if !p.consume(']') {
+		return p.errorf("unterminated predicate")
+	}
+	return nil
+}
+
+// value parses a quoted string or an identifier.
+func (p *parser) value() (string, error) {
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.quoted()
+	}
+	if value := p.ident(); value != "" {
+		return value, nil
+	}
+	return "", p.errorf("missing attribute value")
+}
+
+// quoted parses a single or double quoted string.
+func (p *parser) quoted() (string, error) {
+	quote := p.peek()
+	if quote != '"' && quote != '\'' {
+		return "", p.errorf("missing quoted value")
+	}
+	end := strings.IndexByte(p.s[p.pos+1:], quote)
+	if end == -1 {
+		return "", p.errorf("unterminated quoted value")
+	}
+	value := p.s[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return value, nil
+}
+
+// index parses a positive position.
+func (p *parser) index() (int, error) {
+	start := p.pos
+	for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	index, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil || index < 1 {
+		return 0, p.errorf("invalid position %q", p.s[start:p.pos])
+	}
+	return index, nil
+}
+
+// ident parses an identifier, returning an empty string if there isn't one.
+func (p *parser) ident() string {
+	start := p.pos
+	for !p.done() && isIdentChar(p.peek()) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_' || c >= 0x80
+}
+
+// skipSpace skips whitespace, returning whether any was skipped.
+func (p *parser) skipSpace() bool {
+	start := p.pos
+	for !p.done() && strings.IndexByte(" \t\r\n\f", p.peek()) != -1 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// consume advances past c if it is next.
+func (p *parser) consume(c byte) bool {
+	if p.done() || p.s[p.pos] != c {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// peek returns the next character, or 0 if there isn't one.
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid selector %q at position %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
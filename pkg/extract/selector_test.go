@@ -0,0 +1,97 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+const testDocument = `<!DOCTYPE html>
+<html lang="en">
+<body>
+  <div id="main" class="product featured">
+    <h1>Widget</h1>
+    <ul>
+      <li data-sku="a1">First</li>
+      <li data-sku="b2" class="sale">Second</li>
+      <li>Third <b>item</b></li>
+    </ul>
+    <span itemprop="price" content="1299.00">£1,299.00</span>
+  </div>
+  <div class="product"><h1>Gadget</h1></div>
+  <a href="/download/v2.3.1.tar.gz">Download</a>
+</body>
+</html>`
+
+func TestSelector_Find(t *testing.T) {
+	tests := []struct {
+		selector string
+		// expected is the text of the matched element, or empty if none
+		expected string
+	}{
+		{selector: "h1", expected: "Widget"},
+		{selector: "*", expected: "Widget First Second Third item £1,299.00 Gadget Download"},
+		{selector: "#main h1", expected: "Widget"},
+		{selector: "div.product:nth-of-type(2) h1", expected: "Gadget"},
+		{selector: "div.product.featured > h1", expected: "Widget"},
+		{selector: "div > li"},
+		{selector: "li.sale", expected: "Second"},
+		{selector: "li[data-sku]", expected: "First"},
+		{selector: `li[data-sku="b2"]`, expected: "Second"},
+		{selector: "li[data-sku=c3]"},
+		{selector: "ul > li:nth-of-type(3)", expected: "Third item"},
+		{selector: "li:first-of-type", expected: "First"},
+		{selector: "table, span[itemprop='price']", expected: "£1,299.00"},
+		{selector: "/html/body/div/h1", expected: "Widget"},
+		{selector: "/html/body/div[2]/h1", expected: "Gadget"},
+		{selector: "/body/div"},
+		{selector: "//ul/li[3]", expected: "Third item"},
+		{selector: "//li[@data-sku='b2']", expected: "Second"},
+		{selector: `//*[@id="main"]//span[@itemprop]`, expected: "£1,299.00"},
+		{selector: "//div[@class='product']/h1", expected: "Gadget"},
+	}
+
+	doc, err := html.Parse(strings.NewReader(testDocument))
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := parseSelector(tt.selector)
+			require.NoError(t, err)
+
+			n := sel.find(doc)
+			if tt.expected == "" {
+				require.Nil(t, n)
+				return
+			}
+			require.NotNil(t, n)
+			require.Equal(t, tt.expected, text(n))
+		})
+	}
+}
+
+func TestParseSelector_Invalid(t *testing.T) {
+	for _, selector := range []string{
+		"",
+		"div >",
+		"> div",
+		"div,",
+		"#",
+		".",
+		"li[data-sku",
+		`li[data-sku="b2]`,
+		"li:hover",
+		"li:nth-of-type(0)",
+		"div!",
+		"//",
+		"/html/body/",
+		"//li[0]",
+		"//li[@data-sku=b2]",
+		"//li[@data-sku='b2'",
+	} {
+		_, err := parseSelector(selector)
+		require.Error(t, err, selector)
+	}
+}
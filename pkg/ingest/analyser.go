@@ -0,0 +1,99 @@
+package ingest
+
+import (
+	"math"
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+var _ ports.BenchmarkAnalyser = (*Analyser)(nil)
+
+// Analyser aggregates the Benchmark history of URLs into latency histograms
+// over a set of time windows.
+type Analyser struct {
+	storage    ports.Storer
+	benchmarks ports.BenchmarkStorer
+	windows    []config.Window
+}
+
+// NewAnalyser initialises a new Analyser which aggregates over windows.
+func NewAnalyser(storage ports.Storer, benchmarks ports.BenchmarkStorer, windows []config.Window) *Analyser {
+	return &Analyser{
+		storage:    storage,
+		benchmarks: benchmarks,
+		windows:    windows,
+	}
+}
+
+// Stats aggregates the Benchmarks of url for each window.
+func (a *Analyser) Stats(url string) []ports.BenchmarkStats {
+	return a.summarise(a.histograms(url, time.Now().UTC()))
+}
+
+// OverallStats aggregates the Benchmarks of all stored URLs for each window,
+// returning both the per-URL and combined statistics.
+func (a *Analyser) OverallStats() ([]ports.BenchmarkStats, []ports.URLBenchmarkStats) {
+	now := time.Now().UTC()
+	records := a.storage.Fetch(math.MaxInt, ports.Age, ports.Descending)
+
+	overall := make([]*histogram, len(a.windows))
+	for i := range overall {
+		overall[i] = &histogram{}
+	}
+
+	urls := make([]ports.URLBenchmarkStats, 0, len(records))
+	for _, record := range records {
+		histograms := a.histograms(record.Key, now)
+		for i, h := range histograms {
+			overall[i].merge(h)
+		}
+
+		urls = append(urls, ports.URLBenchmarkStats{
+			URL:   record.Key,
+			Stats: a.summarise(histograms),
+		})
+	}
+
+	return a.summarise(overall), urls
+}
+
+// histograms builds a histogram of the Benchmarks of url for each window.
+func (a *Analyser) histograms(url string, now time.Time) []*histogram {
+	histograms := make([]*histogram, len(a.windows))
+	var longest time.Duration
+	for i, window := range a.windows {
+		histograms[i] = &histogram{}
+		if window.Duration > longest {
+			longest = window.Duration
+		}
+	}
+
+	// fetch the longest window once and fan each benchmark out to every
+	// window it falls within
+	benchmarks := a.benchmarks.Query(url, now.Add(-longest), now, math.MaxInt)
+	for _, benchmark := range benchmarks {
+		age := now.Sub(benchmark.Timestamp)
+		for i, window := range a.windows {
+			if age > window.Duration {
+				continue
+			}
+			if !scrapeStatus(benchmark.Status).ok() {
+				histograms[i].observeError()
+				continue
+			}
+			histograms[i].observe(benchmark.Duration)
+		}
+	}
+
+	return histograms
+}
+
+func (a *Analyser) summarise(histograms []*histogram) []ports.BenchmarkStats {
+	stats := make([]ports.BenchmarkStats, 0, len(histograms))
+	for i, h := range histograms {
+		stats = append(stats, h.stats(a.windows[i].Name))
+	}
+	return stats
+}
@@ -0,0 +1,308 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// maxBufferedBodyBytes is the maximum size of a response body which is
+// buffered for body assertions or content normalisation; any remainder is only
+// counted and hashed.
+const maxBufferedBodyBytes = 10 << 20
+
+// defaultStatusCodes are accepted if no status code assertion is provided.
+var defaultStatusCodes = []statusRange{{min: 200, max: 299, spec: "2xx"}}
+
+// assertionError is returned when a response fails any assertion other than
+// the status code assertion.
+type assertionError struct {
+	failures []string
+}
+
+func (e *assertionError) Error() string {
+	return "failed assertions: " + strings.Join(e.failures, "; ")
+}
+
+// assertions are compiled ports.Assertions, ready to be evaluated against
+// responses.
+type assertions struct {
+	statusCodes     []statusRange
+	headers         map[string]string
+	bodyContains    string
+	bodyRegex       *regexp.Regexp
+	jsonPaths       []jsonPathAssertion
+	maxResponseTime time.Duration
+	maxBodyBytes    int64
+}
+
+type statusRange struct {
+	min, max int
+	spec     string
+}
+
+type jsonPathAssertion struct {
+	path     string
+	steps    []jsonPathStep
+	expected interface{}
+}
+
+// jsonPathStep is either an object key or, if key is empty, an array index.
+type jsonPathStep struct {
+	key   string
+	index int
+}
+
+// compileAssertions validates and compiles a. If a is nil, only the default
+// status code assertion applies.
+func compileAssertions(a *ports.Assertions) (*assertions, error) {
+	compiled := &assertions{statusCodes: defaultStatusCodes}
+	if a == nil {
+		return compiled, nil
+	}
+
+	if len(a.StatusCodes) > 0 {
+		compiled.statusCodes = make([]statusRange, 0, len(a.StatusCodes))
+		for _, spec := range a.StatusCodes {
+			r, err := parseStatusRange(spec)
+			if err != nil {
+				return nil, err
+			}
+			compiled.statusCodes = append(compiled.statusCodes, r)
+		}
+	}
+
+	compiled.headers = a.Headers
+	compiled.bodyContains = a.BodyContains
+	if a.BodyRegex != "" {
+		re, err := regexp.Compile(a.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body regex: %w", err)
+		}
+		compiled.bodyRegex = re
+	}
+
+	for path, expected := range a.JSONPathEquals {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+		compiled.jsonPaths = append(compiled.jsonPaths, jsonPathAssertion{path: path, steps: steps, expected: expected})
+	}
+	// map iteration is random, so keep failures in a stable order
+	sort.Slice(compiled.jsonPaths, func(i, j int) bool {
+		return compiled.jsonPaths[i].path < compiled.jsonPaths[j].path
+	})
+
+	if a.MaxResponseTimeMillis < 0 {
+		return nil, errors.New("invalid max response time")
+	}
+	compiled.maxResponseTime = time.Millisecond * time.Duration(a.MaxResponseTimeMillis)
+	if a.MaxBodyBytes < 0 {
+		return nil, errors.New("invalid max body bytes")
+	}
+	compiled.maxBodyBytes = a.MaxBodyBytes
+
+	return compiled, nil
+}
+
+// needsBody determines whether the response body must be buffered.
+func (a *assertions) needsBody() bool {
+	return a.bodyContains != "" || a.bodyRegex != nil || len(a.jsonPaths) > 0
+}
+
+// readBody drains body into digest, additionally buffering it if buffer is
+// set, and returns its total size.
+func readBody(body io.Reader, digest io.Writer, buffer bool) ([]byte, int64, error) {
+	if !buffer {
+		n, err := io.Copy(digest, body)
+		return nil, n, err
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := io.Copy(io.MultiWriter(buf, digest), io.LimitReader(body, maxBufferedBodyBytes))
+	if err != nil {
+		return nil, n, err
+	}
+	rest, err := io.Copy(digest, body)
+	return buf.Bytes(), n + rest, err
+}
+
+// evaluate evaluates every assertion against a response, returning whether
+// the status code was accepted and a description of each failed assertion.
+func (a *assertions) evaluate(resp *http.Response, body []byte, bodySize int64, elapsed time.Duration) (bool, []string) {
+	var failures []string
+
+	statusOK := false
+	specs := make([]string, 0, len(a.statusCodes))
+	for _, r := range a.statusCodes {
+		if resp.StatusCode >= r.min && resp.StatusCode <= r.max {
+			statusOK = true
+		}
+		specs = append(specs, r.spec)
+	}
+	if !statusOK {
+		failures = append(failures, fmt.Sprintf("status code %d not in [%s]", resp.StatusCode, strings.Join(specs, ", ")))
+	}
+
+	names := make([]string, 0, len(a.headers))
+	for name := range a.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expected := a.headers[name]
+		values, ok := resp.Header[http.CanonicalHeaderKey(name)]
+		switch {
+		case !ok:
+			failures = append(failures, fmt.Sprintf("header %s missing", name))
+		case expected != "" && !containsValue(values, expected):
+			failures = append(failures, fmt.Sprintf("header %s = %q, expected %q", name, strings.Join(values, ", "), expected))
+		}
+	}
+
+	if a.bodyContains != "" && !bytes.Contains(body, []byte(a.bodyContains)) {
+		failures = append(failures, fmt.Sprintf("body does not contain %q", a.bodyContains))
+	}
+	if a.bodyRegex != nil && !a.bodyRegex.Match(body) {
+		failures = append(failures, fmt.Sprintf("body does not match regex %q", a.bodyRegex))
+	}
+
+	if len(a.jsonPaths) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			failures = append(failures, "body is not valid JSON")
+		} else {
+			for _, p := range a.jsonPaths {
+				actual, ok := lookupJSONPath(doc, p.steps)
+				switch {
+				case !ok:
+					failures = append(failures, fmt.Sprintf("JSON path %s not found", p.path))
+				case !reflect.DeepEqual(actual, p.expected):
+					failures = append(failures, fmt.Sprintf("JSON path %s = %v, expected %v", p.path, actual, p.expected))
+				}
+			}
+		}
+	}
+
+	if a.maxResponseTime > 0 && elapsed > a.maxResponseTime {
+		failures = append(failures, fmt.Sprintf("response time %s exceeds %s", elapsed, a.maxResponseTime))
+	}
+	if a.maxBodyBytes > 0 && bodySize > a.maxBodyBytes {
+		failures = append(failures, fmt.Sprintf("body size %d bytes exceeds %d bytes", bodySize, a.maxBodyBytes))
+	}
+
+	return statusOK, failures
+}
+
+// parseStatusRange parses a status code (e.g. "204"), class (e.g. "2xx") or
+// inclusive range (e.g. "200-299").
+func parseStatusRange(spec string) (statusRange, error) {
+	invalid := fmt.Errorf("invalid status code %q", spec)
+	s := strings.ToLower(strings.TrimSpace(spec))
+
+	if len(s) == 3 && strings.HasSuffix(s, "xx") {
+		class, err := strconv.Atoi(s[:1])
+		if err != nil || class < 1 || class > 5 {
+			return statusRange{}, invalid
+		}
+		return statusRange{min: class * 100, max: class*100 + 99, spec: spec}, nil
+	}
+
+	lowerSpec, upperSpec, isRange := strings.Cut(s, "-")
+	if !isRange {
+		upperSpec = lowerSpec
+	}
+	lower, err := strconv.Atoi(lowerSpec)
+	if err != nil {
+		return statusRange{}, invalid
+	}
+	upper, err := strconv.Atoi(upperSpec)
+	if err != nil || lower < 100 || upper > 599 || lower > upper {
+		return statusRange{}, invalid
+	}
+	return statusRange{min: lower, max: upper, spec: spec}, nil
+}
+
+// parseJSONPath parses a dot-separated path of object keys with optional
+// array indices, e.g. "data.items[0].id". A leading "$." is permitted.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	invalid := fmt.Errorf("invalid JSON path %q", path)
+
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed == "" {
+		return nil, invalid
+	}
+
+	var steps []jsonPathStep
+	for _, segment := range strings.Split(trimmed, ".") {
+		key := segment
+		if i := strings.Index(segment, "["); i != -1 {
+			key = segment[:i]
+		}
+		if key != "" {
+			steps = append(steps, jsonPathStep{key: key})
+		}
+
+		for rest := segment[len(key):]; rest != ""; {
+			end := strings.Index(rest, "]")
+			if !strings.HasPrefix(rest, "[") || end == -1 {
+				return nil, invalid
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, invalid
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			rest = rest[end+1:]
+		}
+
+		if key == "" && len(segment) == 0 {
+			return nil, invalid
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSONPath resolves steps against a decoded JSON document.
+func lookupJSONPath(doc interface{}, steps []jsonPathStep) (interface{}, bool) {
+	for _, step := range steps {
+		if step.key != "" {
+			obj, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if doc, ok = obj[step.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+
+		arr, ok := doc.([]interface{})
+		if !ok || step.index >= len(arr) {
+			return nil, false
+		}
+		doc = arr[step.index]
+	}
+	return doc, true
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
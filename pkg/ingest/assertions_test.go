@@ -0,0 +1,155 @@
+package ingest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestProcessor_BenchmarkRequest_Assertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/error-page":
+			w.Write([]byte("<html>Something went wrong</html>"))
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write([]byte(`{"status":"ok","data":{"items":[{"id":7},{"id":8}]}}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		path             string
+		assertions       *ports.Assertions
+		expectedStatus   scrapeStatus
+		expectedFailures []string
+	}{
+		{
+			name:           "2xx accepted by default",
+			path:           "/empty",
+			expectedStatus: success,
+		},
+		{
+			name:             "status code not accepted",
+			path:             "/empty",
+			assertions:       &ports.Assertions{StatusCodes: []string{"200", "300-399"}},
+			expectedStatus:   failure,
+			expectedFailures: []string{"status code 204 not in [200, 300-399]"},
+		},
+		{
+			name: "all assertions pass",
+			path: "/json",
+			assertions: &ports.Assertions{
+				StatusCodes:           []string{"2xx"},
+				Headers:               map[string]string{"content-type": "application/json", "Cache-Control": ""},
+				BodyContains:          `"status":"ok"`,
+				BodyRegex:             `"id":\d+`,
+				JSONPathEquals:        map[string]interface{}{"status": "ok", "$.data.items[1].id": float64(8)},
+				MaxResponseTimeMillis: 1000,
+				MaxBodyBytes:          1024,
+			},
+			expectedStatus: success,
+		},
+		{
+			name: "error page",
+			path: "/error-page",
+			assertions: &ports.Assertions{
+				Headers:        map[string]string{"X-Missing": "", "Content-Type": "application/json"},
+				BodyContains:   "ok",
+				BodyRegex:      `^\{`,
+				JSONPathEquals: map[string]interface{}{"status": "ok"},
+				MaxBodyBytes:   10,
+			},
+			expectedStatus: failure,
+			expectedFailures: []string{
+				`header Content-Type = "text/html; charset=utf-8", expected "application/json"`,
+				"header X-Missing missing",
+				`body does not contain "ok"`,
+				"body does not match regex \"^\\\\{\"",
+				"body is not valid JSON",
+				"body size 33 bytes exceeds 10 bytes",
+			},
+		},
+		{
+			name: "JSON path mismatch",
+			path: "/json",
+			assertions: &ports.Assertions{
+				JSONPathEquals: map[string]interface{}{"data.items[0].id": float64(8), "data.items[5].id": float64(8)},
+			},
+			expectedStatus: failure,
+			expectedFailures: []string{
+				"JSON path data.items[0].id = 7, expected 8",
+				"JSON path data.items[5].id not found",
+			},
+		},
+		{
+			name:             "response time exceeded",
+			path:             "/slow",
+			assertions:       &ports.Assertions{MaxResponseTimeMillis: 10},
+			expectedStatus:   failure,
+			expectedFailures: []string{"response time"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor, _, _ := newTestProcessor(t, newTestConfig(), server.Client())
+
+			result, err := processor.benchmarkRequest(server.URL+tt.path, &ports.URLSpec{Assertions: tt.assertions}, nil)
+			require.Equal(t, tt.expectedStatus, result.Status)
+			require.Equal(t, 1, result.Attempts)
+			if tt.expectedStatus == success {
+				require.NoError(t, err)
+				require.Empty(t, result.FailedAssertions)
+				return
+			}
+
+			require.Error(t, err)
+			require.Len(t, result.FailedAssertions, len(tt.expectedFailures))
+			for i, failure := range tt.expectedFailures {
+				require.Contains(t, result.FailedAssertions[i], failure)
+			}
+		})
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		assertions *ports.Assertions
+		invalid    bool
+	}{
+		{name: "no assertions"},
+		{name: "valid", assertions: &ports.Assertions{StatusCodes: []string{"204", "2xx", "300-302"}, JSONPathEquals: map[string]interface{}{"a.b[0][1]": 1}}},
+		{name: "invalid status code", assertions: &ports.Assertions{StatusCodes: []string{"abc"}}, invalid: true},
+		{name: "out of range status code", assertions: &ports.Assertions{StatusCodes: []string{"700"}}, invalid: true},
+		{name: "inverted status range", assertions: &ports.Assertions{StatusCodes: []string{"299-200"}}, invalid: true},
+		{name: "invalid status class", assertions: &ports.Assertions{StatusCodes: []string{"9xx"}}, invalid: true},
+		{name: "invalid regex", assertions: &ports.Assertions{BodyRegex: "("}, invalid: true},
+		{name: "invalid JSON path", assertions: &ports.Assertions{JSONPathEquals: map[string]interface{}{"a[x]": 1}}, invalid: true},
+		{name: "empty JSON path segment", assertions: &ports.Assertions{JSONPathEquals: map[string]interface{}{"a..b": 1}}, invalid: true},
+		{name: "negative max body bytes", assertions: &ports.Assertions{MaxBodyBytes: -1}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSpec(&ports.URLSpec{Assertions: tt.assertions})
+			if tt.invalid {
+				require.ErrorIs(t, err, ports.ErrInvalidSpec)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
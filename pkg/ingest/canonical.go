@@ -0,0 +1,122 @@
+package ingest
+
+import (
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// defaultPorts are the ports which are redundant for each scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicaliseURL performs synchronous syntactic validation of an ingested
+// URL, so that obviously invalid URLs aren't queued, and normalises it so
+// that equivalent URLs produce the same Record key:
+//   - the scheme and host are lowercased
+//   - default ports and fragments are removed
+//   - an empty path becomes "/"
+//   - query params matching trackingParams are removed and the remainder are
+//     sorted by name
+func canonicaliseURL(rawURL string, trackingParams []string) (string, error) {
+	u, err := neturl.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ports.ErrInvalidURL, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: scheme must be http or https", ports.ErrInvalidURL)
+	}
+	if u.Opaque != "" {
+		return "", fmt.Errorf("%w: URL must be absolute", ports.ErrInvalidURL)
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if host == "" {
+		return "", fmt.Errorf("%w: host must be provided", ports.ErrInvalidURL)
+	}
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return "", fmt.Errorf("%w: invalid port %q", ports.ErrInvalidURL, port)
+		}
+	}
+
+	// Hostname strips the brackets of IPv6 literals, so restore them
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment, u.RawFragment = "", ""
+	u.RawQuery = canonicaliseQuery(u.RawQuery, trackingParams)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// canonicaliseQuery removes tracking params from rawQuery and sorts the
+// remaining params by name. Param encoding and the relative order of
+// repeated params are preserved, as servers may depend on them.
+func canonicaliseQuery(rawQuery string, trackingParams []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct {
+		name string
+		raw  string
+	}
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := neturl.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if isTrackingParam(name, trackingParams) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].name < params[j].name
+	})
+
+	raws := make([]string, 0, len(params))
+	for _, p := range params {
+		raws = append(raws, p.raw)
+	}
+	return strings.Join(raws, "&")
+}
+
+func isTrackingParam(name string, trackingParams []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range trackingParams {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if name == pattern {
+			return true
+		}
+	}
+	return false
+}
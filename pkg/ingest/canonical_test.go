@@ -0,0 +1,52 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestCanonicaliseURL(t *testing.T) {
+	trackingParams := []string{"utm_*", "gclid"}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+		invalid  bool
+	}{
+		{name: "already canonical", url: "https://example.com/path?a=1", expected: "https://example.com/path?a=1"},
+		{name: "lowercase scheme and host", url: "HTTPS://Example.COM/Path", expected: "https://example.com/Path"},
+		{name: "empty path", url: "https://example.com", expected: "https://example.com/"},
+		{name: "fragment", url: "https://example.com/#frag", expected: "https://example.com/"},
+		{name: "default http port", url: "http://example.com:80/", expected: "http://example.com/"},
+		{name: "default https port", url: "https://example.com:443/", expected: "https://example.com/"},
+		{name: "non-default port", url: "https://example.com:8443/", expected: "https://example.com:8443/"},
+		{name: "ipv6 host", url: "http://[::1]:80/", expected: "http://[::1]/"},
+		{name: "sorted query params", url: "https://example.com/?b=2&a=1&b=1", expected: "https://example.com/?a=1&b=2&b=1"},
+		{name: "query encoding preserved", url: "https://example.com/?q=a+b&p=%2F", expected: "https://example.com/?p=%2F&q=a+b"},
+		{name: "tracking params", url: "https://example.com/?utm_source=x&id=1&UTM_Medium=y&gclid=z", expected: "https://example.com/?id=1"},
+		{name: "empty query", url: "https://example.com/?", expected: "https://example.com/"},
+		{name: "surrounding whitespace", url: " https://example.com/ ", expected: "https://example.com/"},
+		{name: "not a URL", url: "not a url", invalid: true},
+		{name: "unsupported scheme", url: "ftp://example.com", invalid: true},
+		{name: "missing host", url: "https:///path", invalid: true},
+		{name: "opaque", url: "http:example.com", invalid: true},
+		{name: "invalid port", url: "http://example.com:99999/", invalid: true},
+		{name: "unparseable", url: "http://example.com/%zz", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, err := canonicaliseURL(tt.url, trackingParams)
+			if tt.invalid {
+				require.ErrorIs(t, err, ports.ErrInvalidURL)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, url)
+		})
+	}
+}
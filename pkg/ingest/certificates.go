@@ -0,0 +1,142 @@
+package ingest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+var _ ports.CertificateMonitor = (*CertificateMonitor)(nil)
+
+// CertificateMonitor reports the TLS certificates of stored URLs, flagging
+// those which expire within a warning window.
+type CertificateMonitor struct {
+	storage ports.Storer
+	window  time.Duration
+}
+
+// NewCertificateMonitor initialises a new CertificateMonitor which flags
+// certificates expiring within window.
+func NewCertificateMonitor(storage ports.Storer, window time.Duration) *CertificateMonitor {
+	return &CertificateMonitor{
+		storage: storage,
+		window:  window,
+	}
+}
+
+// Certificates returns the TLS details of every stored HTTPS URL, sorted by
+// soonest expiry first. Days to expiry are evaluated as of the call rather
+// than when the certificates were captured.
+func (m *CertificateMonitor) Certificates() []ports.URLCertificates {
+	now := time.Now().UTC()
+	records := m.storage.Fetch(math.MaxInt, ports.Age, ports.Descending)
+
+	certs := make([]ports.URLCertificates, 0, len(records))
+	for _, record := range records {
+		if record.TLS == nil {
+			continue
+		}
+
+		info := *record.TLS
+		info.Chain = make([]ports.Certificate, len(record.TLS.Chain))
+		for i, cert := range record.TLS.Chain {
+			cert.DaysToExpiry = daysUntil(cert.NotAfter, now)
+			info.Chain[i] = cert
+		}
+		info.DaysToExpiry = daysUntil(info.ExpiresAt, now)
+		info.Expiring = expiring(info.ExpiresAt, now, m.window)
+
+		certs = append(certs, ports.URLCertificates{
+			URL:     record.Key,
+			TLSInfo: info,
+		})
+	}
+
+	sort.SliceStable(certs, func(i, j int) bool {
+		if !certs[i].ExpiresAt.Equal(certs[j].ExpiresAt) {
+			return certs[i].ExpiresAt.Before(certs[j].ExpiresAt)
+		}
+		return certs[i].URL < certs[j].URL
+	})
+	return certs
+}
+
+// tlsInfo describes the negotiated TLS connection and peer certificate chain of
+// state as of now, flagging certificates expiring within window. It returns nil
+// if the connection wasn't made over TLS.
+func tlsInfo(state *tls.ConnectionState, now time.Time, window time.Duration) *ports.TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &ports.TLSInfo{
+		Version:     tlsVersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		Chain:       make([]ports.Certificate, 0, len(state.PeerCertificates)),
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, certificate(cert, now))
+		if info.ExpiresAt.IsZero() || cert.NotAfter.Before(info.ExpiresAt) {
+			info.ExpiresAt = cert.NotAfter.UTC()
+		}
+	}
+	info.DaysToExpiry = daysUntil(info.ExpiresAt, now)
+	info.Expiring = expiring(info.ExpiresAt, now, window)
+
+	return info
+}
+
+// certificate describes cert as of now.
+func certificate(cert *x509.Certificate, now time.Time) ports.Certificate {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.EmailAddresses)+len(cert.URIs))
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	return ports.Certificate{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SANs:         sans,
+		NotBefore:    cert.NotBefore.UTC(),
+		NotAfter:     cert.NotAfter.UTC(),
+		DaysToExpiry: daysUntil(cert.NotAfter, now),
+	}
+}
+
+// daysUntil returns the number of whole days from now until t, which is
+// negative once t has passed.
+func daysUntil(t, now time.Time) int {
+	return int(math.Floor(t.Sub(now).Hours() / 24))
+}
+
+// expiring determines whether expiresAt is within window of now. Expired
+// certificates are also expiring.
+func expiring(expiresAt, now time.Time, window time.Duration) bool {
+	return !expiresAt.IsZero() && expiresAt.Sub(now) <= window
+}
+
+// tlsVersionName returns the name of a TLS version, e.g. "TLS 1.3".
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", version)
+	}
+}
@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+	"jemgunay/url-scraper/pkg/store"
+)
+
+func TestProcessor_Certificates(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	leaf := server.Certificate()
+	// flag the test certificate as expiring by using a window which exceeds
+	// its validity
+	window := leaf.NotAfter.Sub(time.Now()) + time.Hour*24
+	conf := newTestConfig()
+	conf.Certificates.ExpiryWarningDays = int(window.Hours()/24) + 1
+
+	processor, storage, _ := newTestProcessor(t, conf, server.Client())
+	defer processor.Close(context.Background())
+
+	for _, url := range []string{server.URL + "/", plain.URL + "/"} {
+		job, err := processor.Ingest(context.Background(), url, nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			job, _ := processor.Job(job.ID)
+			return job.Status == ports.JobStored
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	records := storage.Fetch(2, ports.Age, ports.Descending)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		if record.Key == plain.URL+"/" {
+			require.Nil(t, record.TLS)
+			continue
+		}
+
+		require.NotNil(t, record.TLS)
+		require.Equal(t, "TLS 1.3", record.TLS.Version)
+		require.NotEmpty(t, record.TLS.CipherSuite)
+		require.True(t, record.TLS.Expiring)
+		require.Equal(t, leaf.NotAfter.UTC(), record.TLS.ExpiresAt)
+		require.NotEmpty(t, record.TLS.Chain)
+		cert := record.TLS.Chain[0]
+		require.Equal(t, leaf.Subject.String(), cert.Subject)
+		require.Equal(t, leaf.Issuer.String(), cert.Issuer)
+		require.Contains(t, cert.SANs, "example.com")
+		require.Contains(t, cert.SANs, "127.0.0.1")
+		require.Equal(t, record.TLS.DaysToExpiry, cert.DaysToExpiry)
+		require.Positive(t, cert.DaysToExpiry)
+	}
+
+	// only HTTPS URLs are reported, and expiry is evaluated against the
+	// monitor's window
+	certs := NewCertificateMonitor(storage, window).Certificates()
+	require.Len(t, certs, 1)
+	require.Equal(t, server.URL+"/", certs[0].URL)
+	require.True(t, certs[0].Expiring)
+
+	certs = NewCertificateMonitor(storage, time.Hour*24*30).Certificates()
+	require.Len(t, certs, 1)
+	require.False(t, certs[0].Expiring)
+}
+
+func TestCertificateMonitor_Certificates_Order(t *testing.T) {
+	storage := store.New(zap.NewNop(), 10)
+	now := time.Now().UTC()
+	expiries := map[string]time.Time{
+		"https://a.example.com": now.Add(time.Hour * 24 * 90),
+		"https://b.example.com": now.Add(time.Hour * 24 * 10),
+		"https://c.example.com": now.Add(-time.Hour * 12),
+	}
+	for url, expiresAt := range expiries {
+		storage.Store(url, nil)
+		storage.UpdateTLS(url, ports.TLSInfo{
+			Chain:     []ports.Certificate{{NotAfter: expiresAt}},
+			ExpiresAt: expiresAt,
+		})
+	}
+	storage.Store("http://d.example.com", nil)
+
+	certs := NewCertificateMonitor(storage, time.Hour*24*30).Certificates()
+	require.Len(t, certs, 3)
+
+	expected := []struct {
+		url      string
+		days     int
+		expiring bool
+	}{
+		{url: "https://c.example.com", days: -1, expiring: true},
+		{url: "https://b.example.com", days: 9, expiring: true},
+		{url: "https://a.example.com", days: 89, expiring: false},
+	}
+	for i, e := range expected {
+		require.Equal(t, e.url, certs[i].URL)
+		require.Equal(t, e.days, certs[i].DaysToExpiry)
+		require.Equal(t, e.days, certs[i].Chain[0].DaysToExpiry)
+		require.Equal(t, e.expiring, certs[i].Expiring)
+	}
+}
@@ -0,0 +1,54 @@
+package ingest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"regexp"
+	"unicode"
+
+	"jemgunay/url-scraper/pkg/config"
+)
+
+// contentNormaliser normalises response bodies before they are hashed, so that
+// insignificant differences such as whitespace or timestamps aren't detected
+// as content changes.
+type contentNormaliser struct {
+	ignoreWhitespace bool
+	strip            []*regexp.Regexp
+}
+
+func newContentNormaliser(conf config.ChangeDetection) *contentNormaliser {
+	normaliser := &contentNormaliser{ignoreWhitespace: conf.IgnoreWhitespace}
+	for _, pattern := range conf.StripPatterns {
+		// patterns are validated with the config
+		normaliser.strip = append(normaliser.strip, regexp.MustCompile(pattern))
+	}
+	return normaliser
+}
+
+// needsBody determines whether the response body must be buffered to be
+// normalised.
+func (n *contentNormaliser) needsBody() bool {
+	return n.ignoreWhitespace || len(n.strip) > 0
+}
+
+// hash returns the hex encoded SHA-256 hash of a response body. If no
+// normalisation is required, the raw body's digest is used as is. Otherwise,
+// the buffered body is normalised and hashed, in which case only the first
+// maxBufferedBodyBytes of the body are accounted for.
+func (n *contentNormaliser) hash(body []byte, digest hash.Hash) string {
+	if !n.needsBody() {
+		return hex.EncodeToString(digest.Sum(nil))
+	}
+
+	for _, re := range n.strip {
+		body = re.ReplaceAll(body, nil)
+	}
+	if n.ignoreWhitespace {
+		body = bytes.Join(bytes.FieldsFunc(body, unicode.IsSpace), nil)
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/config"
+)
+
+func TestContentNormaliser_Hash(t *testing.T) {
+	tests := []struct {
+		name          string
+		conf          config.ChangeDetection
+		a, b          string
+		expectedEqual bool
+	}{
+		{
+			name:          "raw bodies",
+			a:             "<p>hello</p>",
+			b:             "<p>hello</p>",
+			expectedEqual: true,
+		},
+		{
+			name: "whitespace is significant by default",
+			a:    "<p>hello</p>",
+			b:    "<p>hello</p>\n",
+		},
+		{
+			name:          "ignore whitespace",
+			conf:          config.ChangeDetection{IgnoreWhitespace: true},
+			a:             "<p>hello</p>",
+			b:             "\t<p>\n  hello </p>\r\n",
+			expectedEqual: true,
+		},
+		{
+			name:          "strip patterns",
+			conf:          config.ChangeDetection{StripPatterns: []string{`<input name="csrf" value="\w+">`, `\d{2}:\d{2}`}},
+			a:             `<p>hello</p><input name="csrf" value="abc">12:00`,
+			b:             `<p>hello</p><input name="csrf" value="def">13:45`,
+			expectedEqual: true,
+		},
+		{
+			name: "strip patterns retain other changes",
+			conf: config.ChangeDetection{StripPatterns: []string{`\d{2}:\d{2}`}},
+			a:    "<p>hello</p>12:00",
+			b:    "<p>goodbye</p>13:45",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normaliser := newContentNormaliser(tt.conf)
+			hash := func(body string) string {
+				digest := sha256.New()
+				digest.Write([]byte(body))
+				return normaliser.hash([]byte(body), digest)
+			}
+
+			require.Len(t, hash(tt.a), sha256.Size*2)
+			require.Equal(t, tt.expectedEqual, hash(tt.a) == hash(tt.b))
+		})
+	}
+}
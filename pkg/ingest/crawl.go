@@ -0,0 +1,354 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+	"jemgunay/url-scraper/pkg/store"
+)
+
+// Crawl enqueues a seed URL for ingestion, followed by the pages it links to
+// within the scope and limits of crawl. Discovered pages are canonicalised,
+// deduplicated and ingested with spec, which may be nil, in the same way as
+// URLs submitted to Ingest. The seed URL is enqueued synchronously, so the same
+// errors as Ingest are returned, and ports.ErrInvalidSpec if crawl is invalid.
+func (s *Processor) Crawl(ctx context.Context, seed string, spec *ports.URLSpec,
+	crawlSpec ports.CrawlSpec) (ports.Crawl, error) {
+	seed, err := canonicaliseURL(seed, s.conf.TrackingParams)
+	if err != nil {
+		s.metrics.ingests.With(ingestRejected).Inc()
+		return ports.Crawl{}, err
+	}
+	if err := validateSpec(spec); err != nil {
+		s.metrics.ingests.With(ingestRejected).Inc()
+		return ports.Crawl{}, err
+	}
+	c, err := newCrawl(s.ctx, seed, spec, crawlSpec, s.conf.Crawl)
+	if err != nil {
+		s.metrics.ingests.With(ingestRejected).Inc()
+		return ports.Crawl{}, fmt.Errorf("%w: %s", ports.ErrInvalidSpec, err)
+	}
+
+	if _, err := s.enqueue(ctx, ingestItem{url: seed, spec: spec, crawl: c}); err != nil {
+		c.cancel()
+		return ports.Crawl{}, err
+	}
+	s.crawls.Add(c.id, c)
+	go s.pumpCrawl(c)
+	s.logger.Info("started crawl", zap.String("crawl_id", c.id), zap.String("url", seed))
+
+	return c.snapshot(), nil
+}
+
+// CrawlStatus fetches a Crawl by ID.
+func (s *Processor) CrawlStatus(id string) (ports.Crawl, bool) {
+	c, ok := s.crawls.Get(id)
+	if !ok {
+		return ports.Crawl{}, false
+	}
+	return c.snapshot(), true
+}
+
+// CancelCrawl cancels a running Crawl by ID. Pages waiting to be enqueued are
+// rejected and no further pages are discovered, but pages which have already
+// been enqueued are still ingested.
+func (s *Processor) CancelCrawl(id string) (ports.Crawl, bool) {
+	c, ok := s.crawls.Get(id)
+	if !ok {
+		return ports.Crawl{}, false
+	}
+	c.stop(errCrawlCancelled, true)
+	s.logger.Info("cancelled crawl", zap.String("crawl_id", c.id))
+	return c.snapshot(), true
+}
+
+// pumpCrawl enqueues the pages discovered by a crawl from its frontier, one at
+// a time, until the crawl completes or is stopped. Enqueueing is done here
+// rather than by the insert workers so that they never block on the queue
+// they consume.
+func (s *Processor) pumpCrawl(c *crawl) {
+	for {
+		select {
+		case page := <-c.frontier:
+			item := ingestItem{url: page, spec: c.spec, crawl: c}
+			if _, err := s.enqueue(c.ctx, item); err != nil {
+				if c.ctx.Err() != nil {
+					err = errCrawlStopped
+				}
+				c.visit(page, nil, err, s.conf.TrackingParams)
+			}
+		case <-c.ctx.Done():
+			// the crawl completed, was cancelled or the Processor was closed
+			c.stop(errCrawlStopped, false)
+			return
+		}
+	}
+}
+
+var (
+	errCrawlCancelled = errors.New("crawl cancelled")
+	errCrawlStopped   = errors.New("crawl stopped")
+)
+
+// crawl is the concurrency-safe state of a single crawl. A page is pending
+// from when it is discovered until it is stored or rejected, and the crawl
+// completes once no pages are pending.
+type crawl struct {
+	id        string
+	seed      *url.URL
+	spec      *ports.URLSpec
+	crawlSpec ports.CrawlSpec
+	sameHost  bool
+	pattern   *regexp.Regexp
+	// frontier holds the discovered pages waiting to be enqueued. It is
+	// buffered to the crawl's max pages, so admitting a page never blocks.
+	frontier chan string
+	// ctx is cancelled once the crawl completes or is stopped
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      *sync.Mutex
+	pages   []*ports.CrawlPage
+	lookup  map[string]*ports.CrawlPage
+	links   []ports.CrawlLink
+	linked  map[ports.CrawlLink]struct{}
+	scoped  map[string]bool
+	skipped map[string]struct{}
+	pending int
+	// stopped prevents further pages from being admitted, and cancelled
+	// records whether the crawl was stopped by cancellation
+	stopped   bool
+	cancelled bool
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// newCrawl initialises a new crawl from a canonical seed URL, whose page is
+// pending. Unset limits default to the configured maximums, and are set in the
+// crawl's spec. The crawl is
+// stopped when parent is cancelled.
+func newCrawl(parent context.Context, seed string, spec *ports.URLSpec, crawlSpec ports.CrawlSpec,
+	conf config.Crawl) (*crawl, error) {
+	switch {
+	case crawlSpec.MaxDepth != nil && (*crawlSpec.MaxDepth < 0 || *crawlSpec.MaxDepth > conf.MaxDepth):
+		return nil, fmt.Errorf("max depth must be between 0 and %d", conf.MaxDepth)
+	case crawlSpec.MaxPages < 0 || crawlSpec.MaxPages > conf.MaxPages:
+		return nil, fmt.Errorf("max pages must be between 1 and %d", conf.MaxPages)
+	case crawlSpec.Scope.PathPrefix != "" && !strings.HasPrefix(crawlSpec.Scope.PathPrefix, "/"):
+		return nil, errors.New("path prefix must start with /")
+	}
+	maxDepth := conf.MaxDepth
+	if crawlSpec.MaxDepth != nil {
+		maxDepth = *crawlSpec.MaxDepth
+	}
+	crawlSpec.MaxDepth = &maxDepth
+	if crawlSpec.MaxPages == 0 {
+		crawlSpec.MaxPages = conf.MaxPages
+	}
+
+	seedURL, err := url.Parse(seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed URL: %w", err)
+	}
+
+	now := time.Now().UTC()
+	c := &crawl{
+		id:        store.NewID(),
+		seed:      seedURL,
+		spec:      spec,
+		crawlSpec: crawlSpec,
+		sameHost:  crawlSpec.Scope.SameHost == nil || *crawlSpec.Scope.SameHost,
+		frontier:  make(chan string, crawlSpec.MaxPages),
+
+		mu:        &sync.Mutex{},
+		lookup:    make(map[string]*ports.CrawlPage),
+		linked:    make(map[ports.CrawlLink]struct{}),
+		scoped:    make(map[string]bool),
+		skipped:   make(map[string]struct{}),
+		createdAt: now,
+		updatedAt: now,
+	}
+	if crawlSpec.Scope.Pattern != "" {
+		if c.pattern, err = regexp.Compile(crawlSpec.Scope.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid scope pattern: %w", err)
+		}
+	}
+
+	c.ctx, c.cancel = context.WithCancel(parent)
+	c.admit(seed, 0)
+	return c, nil
+}
+
+// admit adds a pending page to the crawl. The caller must hold the lock,
+// unless the crawl is being initialised.
+func (c *crawl) admit(page string, depth int) {
+	p := &ports.CrawlPage{URL: page, Depth: depth, Status: ports.JobQueued}
+	c.pages = append(c.pages, p)
+	c.lookup[page] = p
+	c.scoped[page] = true
+	c.pending++
+}
+
+// stop stops the crawl from admitting further pages and rejects the pages
+// waiting in the frontier for reason. cancelled records that the crawl was
+// stopped by cancellation.
+func (c *crawl) stop(reason error, cancelled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.stopped && c.pending > 0 {
+		c.cancelled = cancelled
+	}
+	c.stopped = true
+	c.cancel()
+
+	for {
+		select {
+		case page := <-c.frontier:
+			c.reject(c.lookup[page], reason)
+		default:
+			return
+		}
+	}
+}
+
+// reject marks a pending page as rejected. The caller must hold the lock.
+func (c *crawl) reject(p *ports.CrawlPage, reason error) {
+	p.Status, p.Reason = ports.JobRejected, reason.Error()
+	c.pending--
+	c.updatedAt = time.Now().UTC()
+}
+
+// setJob sets the ingestion Job of a page.
+func (c *crawl) setJob(page, jobID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.lookup[page]; ok {
+		p.JobID = jobID
+	}
+}
+
+// visit records the outcome of a pending page. If the page was stored and is
+// within the crawl's max depth, its links are canonicalised and recorded, and
+// any in-scope pages which haven't been seen before are admitted to the
+// frontier until the crawl reaches its max pages or is stopped. err is the
+// reason the page was rejected, if any. The crawl's context is cancelled once
+// no pages are pending.
+func (c *crawl) visit(page string, links []string, err error, trackingParams []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.lookup[page]
+	if !ok || (p.Status != ports.JobQueued && p.Status != ports.JobValidating) {
+		return
+	}
+	defer func() {
+		if c.pending == 0 {
+			c.cancel()
+		}
+	}()
+	if err != nil {
+		c.reject(p, err)
+		return
+	}
+	p.Status = ports.JobStored
+	c.pending--
+	c.updatedAt = time.Now().UTC()
+	if p.Depth >= *c.crawlSpec.MaxDepth {
+		return
+	}
+
+	for _, link := range links {
+		link, err := canonicaliseURL(link, trackingParams)
+		if err != nil || link == page || !c.inScope(link) {
+			continue
+		}
+
+		edge := ports.CrawlLink{From: page, To: link}
+		if _, ok := c.linked[edge]; !ok {
+			c.linked[edge] = struct{}{}
+			c.links = append(c.links, edge)
+		}
+
+		if _, ok := c.lookup[link]; ok {
+			continue
+		}
+		if c.stopped || len(c.pages) >= c.crawlSpec.MaxPages {
+			c.skipped[link] = struct{}{}
+			continue
+		}
+		c.admit(link, p.Depth+1)
+		c.frontier <- link
+	}
+}
+
+// inScope determines whether a canonical link is within the crawl's scope,
+// memoising the result. The caller must hold the lock.
+func (c *crawl) inScope(link string) bool {
+	if scoped, ok := c.scoped[link]; ok {
+		return scoped
+	}
+
+	scoped := false
+	if u, err := url.Parse(link); err == nil {
+		scoped = (!c.sameHost || u.Host == c.seed.Host) &&
+			strings.HasPrefix(u.Path, c.crawlSpec.Scope.PathPrefix) &&
+			(c.pattern == nil || c.pattern.MatchString(link))
+	}
+	c.scoped[link] = scoped
+	return scoped
+}
+
+// snapshot returns a copy of the crawl's current state.
+func (c *crawl) snapshot() ports.Crawl {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	crawl := ports.Crawl{
+		ID:        c.id,
+		Seed:      c.seed.String(),
+		Status:    ports.CrawlRunning,
+		Spec:      c.crawlSpec,
+		Pages:     make([]ports.CrawlPage, 0, len(c.pages)),
+		Links:     append([]ports.CrawlLink{}, c.links...),
+		CreatedAt: c.createdAt,
+		UpdatedAt: c.updatedAt,
+	}
+	switch {
+	case c.cancelled:
+		crawl.Status = ports.CrawlCancelled
+	case c.pending == 0:
+		crawl.Status = ports.CrawlCompleted
+	}
+
+	for _, p := range c.pages {
+		crawl.Pages = append(crawl.Pages, *p)
+		switch p.Status {
+		case ports.JobStored:
+			crawl.Progress.Stored++
+		case ports.JobRejected:
+			crawl.Progress.Rejected++
+		default:
+			crawl.Progress.Queued++
+		}
+	}
+	for _, scoped := range c.scoped {
+		if !scoped {
+			crawl.Progress.OutOfScope++
+		}
+	}
+	crawl.Progress.Skipped = len(c.skipped)
+
+	return crawl
+}
@@ -0,0 +1,200 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// depth returns a pointer to a crawl max depth.
+func depth(depth int) *int {
+	return &depth
+}
+
+func TestProcessor_Crawl(t *testing.T) {
+	site := map[string]string{
+		"/":         `<a href="/a">A</a> <a href="b">B</a> <a href="/docs/x#intro">X</a> <a href="https://other.example.com/">O</a> <a href="/a">A</a> <a href="mailto:a@b.c">M</a>`,
+		"/a":        `<a href="/">Home</a> <a href="/a/deep#top">Deep</a>`,
+		"/a/deep":   `<a href="/a/deeper">Deeper</a>`,
+		"/a/deeper": ``,
+		"/docs/x":   `<a href="https://other.example.com/docs/">O</a>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := site[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	u := func(path string) string {
+		return server.URL + path
+	}
+	sameHost := false
+
+	tests := []struct {
+		name             string
+		spec             ports.CrawlSpec
+		expectedPages    map[string]int
+		expectedRejected int
+		expectedProgress ports.CrawlProgress
+		expectedLinks    []ports.CrawlLink
+	}{
+		{
+			name: "max depth",
+			spec: ports.CrawlSpec{MaxDepth: depth(2)},
+			expectedPages: map[string]int{
+				u("/"): 0, u("/a"): 1, u("/b"): 1, u("/docs/x"): 1, u("/a/deep"): 2,
+			},
+			expectedProgress: ports.CrawlProgress{Stored: 4, Rejected: 1, OutOfScope: 2},
+			expectedLinks: []ports.CrawlLink{
+				{From: u("/"), To: u("/a")},
+				{From: u("/"), To: u("/b")},
+				{From: u("/"), To: u("/docs/x")},
+				{From: u("/a"), To: u("/")},
+				{From: u("/a"), To: u("/a/deep")},
+			},
+		},
+		{
+			name:             "seed only",
+			spec:             ports.CrawlSpec{MaxDepth: depth(0)},
+			expectedPages:    map[string]int{u("/"): 0},
+			expectedProgress: ports.CrawlProgress{Stored: 1},
+		},
+		{
+			name:             "max pages",
+			spec:             ports.CrawlSpec{MaxPages: 2},
+			expectedPages:    map[string]int{u("/"): 0, u("/a"): 1},
+			expectedProgress: ports.CrawlProgress{Stored: 2, OutOfScope: 1, Skipped: 3},
+		},
+		{
+			name: "path prefix",
+			spec: ports.CrawlSpec{Scope: ports.CrawlScope{PathPrefix: "/a"}},
+			expectedPages: map[string]int{
+				u("/"): 0, u("/a"): 1, u("/a/deep"): 2, u("/a/deeper"): 3,
+			},
+			expectedProgress: ports.CrawlProgress{Stored: 4, OutOfScope: 3},
+		},
+		{
+			name: "pattern across hosts",
+			spec: ports.CrawlSpec{MaxDepth: depth(1), Scope: ports.CrawlScope{
+				SameHost: &sameHost,
+				Pattern:  `/docs/`,
+			}},
+			expectedPages:    map[string]int{u("/"): 0, u("/docs/x"): 1},
+			expectedProgress: ports.CrawlProgress{Stored: 2, OutOfScope: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor, storage, _ := newTestProcessor(t, newTestConfig(), server.Client())
+			defer processor.Close(context.Background())
+
+			crawl, err := processor.Crawl(context.Background(), u(""), nil, tt.spec)
+			require.NoError(t, err)
+			require.Equal(t, u("/"), crawl.Seed)
+
+			require.Eventually(t, func() bool {
+				crawl, _ = processor.CrawlStatus(crawl.ID)
+				return crawl.Status == ports.CrawlCompleted
+			}, time.Second*5, 10*time.Millisecond)
+
+			pages := make(map[string]int, len(crawl.Pages))
+			for _, page := range crawl.Pages {
+				pages[page.URL] = page.Depth
+				require.NotEmpty(t, page.JobID)
+				job, ok := processor.Job(page.JobID)
+				require.True(t, ok)
+				require.Equal(t, page.Status, job.Status)
+			}
+			require.Equal(t, tt.expectedPages, pages)
+			require.Equal(t, tt.expectedProgress, crawl.Progress)
+			require.Len(t, storage.Fetch(100, ports.Age, ports.Descending), tt.expectedProgress.Stored)
+			if tt.expectedLinks != nil {
+				require.ElementsMatch(t, tt.expectedLinks, crawl.Links)
+			}
+		})
+	}
+}
+
+func TestProcessor_CancelCrawl(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			// link to more pages than can be enqueued at once
+			for i := 0; i < 30; i++ {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+			return
+		}
+		<-release
+	}))
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.QueueCapacity = 1
+	conf.InsertWorkers = 1
+	processor, _, _ := newTestProcessor(t, conf, server.Client())
+	defer processor.Close(context.Background())
+	// unblock in-flight requests before closing the processor
+	defer close(release)
+
+	crawl, err := processor.Crawl(context.Background(), server.URL, nil, ports.CrawlSpec{MaxDepth: depth(1)})
+	require.NoError(t, err)
+
+	// wait for the seed page to be stored and its links discovered
+	require.Eventually(t, func() bool {
+		crawl, _ = processor.CrawlStatus(crawl.ID)
+		return len(crawl.Pages) == 31
+	}, time.Second*5, 10*time.Millisecond)
+
+	crawl, ok := processor.CancelCrawl(crawl.ID)
+	require.True(t, ok)
+	require.Equal(t, ports.CrawlCancelled, crawl.Status)
+
+	// pages waiting in the frontier are rejected, rather than left blocked on
+	// the full queue
+	rejected := 0
+	for _, page := range crawl.Pages {
+		if page.Reason == errCrawlCancelled.Error() {
+			rejected++
+		}
+	}
+	require.Greater(t, rejected, 25)
+
+	_, ok = processor.CancelCrawl("unknown")
+	require.False(t, ok)
+}
+
+func TestProcessor_Crawl_Invalid(t *testing.T) {
+	processor, _, _ := newTestProcessor(t, newTestConfig(), http.DefaultClient)
+	defer processor.Close(context.Background())
+
+	for _, spec := range []ports.CrawlSpec{
+		{MaxDepth: depth(4)},
+		{MaxDepth: depth(-1)},
+		{MaxPages: 101},
+		{Scope: ports.CrawlScope{PathPrefix: "docs"}},
+		{Scope: ports.CrawlScope{Pattern: "("}},
+	} {
+		_, err := processor.Crawl(context.Background(), "https://example.com", nil, spec)
+		require.ErrorIs(t, err, ports.ErrInvalidSpec, spec)
+	}
+
+	_, err := processor.Crawl(context.Background(), "ftp://example.com", nil, ports.CrawlSpec{})
+	require.ErrorIs(t, err, ports.ErrInvalidURL)
+
+	_, ok := processor.CrawlStatus("unknown")
+	require.False(t, ok)
+}
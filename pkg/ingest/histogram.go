@@ -0,0 +1,135 @@
+package ingest
+
+import (
+	"math"
+	"time"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+const (
+	// histogramMinValue is the upper bound of the first bucket; any smaller
+	// observations are counted in it.
+	histogramMinValue = 100 * time.Microsecond
+	// histogramGrowth is the ratio between consecutive bucket bounds, which
+	// bounds the relative error of quantile estimates to ~5%.
+	histogramGrowth = 1.1
+	// histogramBuckets covers observations up to ~20 minutes; any larger
+	// observations are counted in the last bucket.
+	histogramBuckets = 172
+)
+
+// histogram is a log-linear latency histogram with a fixed bucket layout. As
+// every histogram shares the same layout, histograms can be merged losslessly,
+// e.g. to combine the histograms of multiple URLs.
+type histogram struct {
+	buckets    [histogramBuckets]uint64
+	count      uint64
+	errorCount uint64
+	sum        time.Duration
+	min        time.Duration
+	max        time.Duration
+}
+
+// observe adds a successful observation to the histogram.
+func (h *histogram) observe(d time.Duration) {
+	h.buckets[bucketIndex(d)]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// observeError adds a failed observation to the histogram.
+func (h *histogram) observeError() {
+	h.errorCount++
+}
+
+// merge adds all observations of other into h.
+func (h *histogram) merge(other *histogram) {
+	if other.count > 0 {
+		if h.count == 0 || other.min < h.min {
+			h.min = other.min
+		}
+		if other.max > h.max {
+			h.max = other.max
+		}
+	}
+	for i, c := range other.buckets {
+		h.buckets[i] += c
+	}
+	h.count += other.count
+	h.errorCount += other.errorCount
+	h.sum += other.sum
+}
+
+// quantile estimates the q-th quantile (0 < q <= 1) of successful
+// observations.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	var seen uint64
+	for i, c := range h.buckets {
+		seen += c
+		if seen < rank {
+			continue
+		}
+
+		// estimate the quantile as the geometric midpoint of the bucket,
+		// bounded by the true min and max
+		upper := bucketUpperBound(i)
+		estimate := time.Duration(float64(upper) / math.Sqrt(histogramGrowth))
+		if estimate < h.min {
+			estimate = h.min
+		}
+		if estimate > h.max {
+			estimate = h.max
+		}
+		return estimate
+	}
+	return h.max
+}
+
+// stats summarises the histogram as ports.BenchmarkStats.
+func (h *histogram) stats(window string) ports.BenchmarkStats {
+	stats := ports.BenchmarkStats{
+		Window:     window,
+		Count:      int(h.count + h.errorCount),
+		ErrorCount: int(h.errorCount),
+		Min:        h.min,
+		Max:        h.max,
+		P50:        h.quantile(0.5),
+		P90:        h.quantile(0.9),
+		P95:        h.quantile(0.95),
+		P99:        h.quantile(0.99),
+	}
+	if stats.Count > 0 {
+		stats.ErrorRate = float64(h.errorCount) / float64(stats.Count)
+	}
+	if h.count > 0 {
+		stats.Mean = h.sum / time.Duration(h.count)
+	}
+	return stats
+}
+
+func bucketIndex(d time.Duration) int {
+	if d <= histogramMinValue {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(histogramMinValue)) / math.Log(histogramGrowth)))
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return i
+}
+
+func bucketUpperBound(i int) time.Duration {
+	return time.Duration(float64(histogramMinValue) * math.Pow(histogramGrowth, float64(i)))
+}
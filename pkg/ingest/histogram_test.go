@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram_Stats(t *testing.T) {
+	h := &histogram{}
+	// observe 1ms to 1000ms
+	for i := 1; i <= 1000; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	h.observeError()
+	h.observeError()
+
+	stats := h.stats("1h")
+	require.Equal(t, "1h", stats.Window)
+	require.Equal(t, 1002, stats.Count)
+	require.Equal(t, 2, stats.ErrorCount)
+	require.InDelta(t, 2.0/1002, stats.ErrorRate, 1e-9)
+	require.Equal(t, time.Millisecond, stats.Min)
+	require.Equal(t, time.Second, stats.Max)
+	require.Equal(t, 500500*time.Microsecond, stats.Mean)
+
+	// quantile estimates should be within the bucket relative error
+	for expected, actual := range map[time.Duration]time.Duration{
+		500 * time.Millisecond: stats.P50,
+		900 * time.Millisecond: stats.P90,
+		950 * time.Millisecond: stats.P95,
+		990 * time.Millisecond: stats.P99,
+	} {
+		require.InEpsilon(t, float64(expected), float64(actual), 0.05)
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	combined, a, b := &histogram{}, &histogram{}, &histogram{}
+	for i := 1; i <= 100; i++ {
+		d := time.Duration(i) * time.Millisecond
+		combined.observe(d)
+		if i%2 == 0 {
+			a.observe(d)
+		} else {
+			b.observe(d)
+		}
+	}
+	b.observeError()
+	combined.observeError()
+
+	merged := &histogram{}
+	merged.merge(a)
+	merged.merge(b)
+	require.Equal(t, combined, merged)
+
+	// merging an empty histogram should have no effect
+	merged.merge(&histogram{})
+	require.Equal(t, combined, merged)
+}
+
+func TestHistogram_Empty(t *testing.T) {
+	stats := (&histogram{}).stats("1h")
+	require.Zero(t, stats.Count)
+	require.Zero(t, stats.ErrorRate)
+	require.Zero(t, stats.P99)
+	require.Zero(t, stats.Mean)
+}
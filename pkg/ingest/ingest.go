@@ -2,157 +2,662 @@ package ingest
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
 	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/extract"
+	"jemgunay/url-scraper/pkg/metrics"
 	"jemgunay/url-scraper/pkg/ports"
+	"jemgunay/url-scraper/pkg/store"
 )
 
 var _ ports.Ingester = (*Processor)(nil)
 
+// Processor validates and stores ingested URLs, and periodically refreshes the
+// benchmarks of every stored URL according to its schedule.
 type Processor struct {
-	logger  config.Logger
-	storage ports.Storer
+	logger     config.Logger
+	conf       config.Ingest
+	storage    ports.Storer
+	benchmarks ports.BenchmarkStorer
+	changes    ports.ChangeStorer
+	// extractions stores the values extracted by extractor
+	extractions ports.ExtractionStorer
+	jobs        ports.JobTracker
+
+	httpClient ports.Client
+	extractor  *extract.Extractor
+	normaliser *contentNormaliser
+	retry      retryPolicy
+	limiter    *hostLimiter
+	// robots is nil if robots.txt compliance is disabled
+	robots      *robotsChecker
+	insertQueue chan ingestItem
+	scheduler   *scheduler
+	crawls      *store.Tracker[*crawl]
+	linkChecks  *store.Tracker[*linkCheck]
+	metrics     processorMetrics
+
+	// ctx is cancelled to abort in-flight requests if the Processor fails to
+	// close gracefully
+	ctx    context.Context
+	cancel context.CancelFunc
+	// mu guards closed so that insertQueue is never written to once closed
+	mu     *sync.RWMutex
+	closed bool
+	// stop is closed to stop the scheduler and to unblock pending
+	// ingestions
+	stop          chan struct{}
+	stopOnce      *sync.Once
+	insertWorkers *workerGroup[ingestItem]
+	refresherDone chan struct{}
+}
 
-	httpClient  ports.Client
-	insertQueue chan string
+// ingestItem is a URL enqueued for insertion, alongside the Job tracking it.
+type ingestItem struct {
+	url   string
+	jobID string
+	spec  *ports.URLSpec
+	// crawl is the crawl which discovered the URL, if any
+	crawl *crawl
 }
 
-func New(logger config.Logger, storage ports.Storer, httpClient ports.Client) *Processor {
-	processor := &Processor{
-		logger:     logger,
-		storage:    storage,
-		httpClient: httpClient,
+// Deps are the stores and clients which a Processor ingests URLs with.
+type Deps struct {
+	Storage     ports.Storer
+	Benchmarks  ports.BenchmarkStorer
+	Changes     ports.ChangeStorer
+	Extractions ports.ExtractionStorer
+	Jobs        ports.JobTracker
+	HTTPClient  ports.Client
+	Extractor   *extract.Extractor
+	// Registry is where the Processor's metrics are registered
+	Registry *metrics.Registry
+}
 
-		insertQueue: make(chan string, 10), // TODO: make capacity configurable via yaml
+// New initialises a new Processor and starts its insertion and refresh
+// workers.
+func New(logger config.Logger, conf config.Ingest, deps Deps) *Processor {
+	processor := &Processor{
+		logger:      logger,
+		conf:        conf,
+		storage:     deps.Storage,
+		benchmarks:  deps.Benchmarks,
+		changes:     deps.Changes,
+		extractions: deps.Extractions,
+		jobs:        deps.Jobs,
+		httpClient:  deps.HTTPClient,
+		extractor:   deps.Extractor,
+		normaliser:  newContentNormaliser(conf.ChangeDetection),
+		retry:       newRetryPolicy(conf.Retry),
+		limiter:     newHostLimiter(conf.RateLimit),
+
+		insertQueue: make(chan ingestItem, conf.QueueCapacity),
+		scheduler: newScheduler(logger, deps.Storage, time.Second*time.Duration(conf.RefreshIntervalSeconds),
+			conf.RefreshJitter),
+		crawls:     store.NewTracker[*crawl](conf.Crawl.Capacity),
+		linkChecks: store.NewTracker[*linkCheck](conf.LinkCheck.Capacity),
+
+		mu:            &sync.RWMutex{},
+		stop:          make(chan struct{}),
+		stopOnce:      &sync.Once{},
+		refresherDone: make(chan struct{}),
+	}
+	processor.ctx, processor.cancel = context.WithCancel(context.Background())
+	if conf.Robots.Enabled {
+		processor.robots = newRobotsChecker(deps.HTTPClient, conf.UserAgent, time.Second*time.Duration(conf.Robots.CacheTTLSeconds))
 	}
+	processor.metrics = newProcessorMetrics(deps.Registry, func() (int, int) {
+		return len(processor.insertQueue), cap(processor.insertQueue)
+	}, processor.scheduler.len)
 
-	go processor.startPollers()
+	processor.startPollers()
 
 	return processor
 }
 
 func (s *Processor) startPollers() {
-	f := func(url string) {
-		logger := s.logger.With(zap.String("url", url))
+	f := func(item ingestItem) {
+		result, err := s.insert(item)
+		if item.crawl != nil {
+			item.crawl.visit(item.url, result.links, err, s.conf.TrackingParams)
+		}
+	}
+
+	// create a long-lived worker group to fan out enqueued URL insertions
+	s.insertWorkers = newWorkerGroup[ingestItem](s.conf.InsertWorkers, s.insertQueue, f)
 
-		if _, err := s.benchmarkRequest(url); err != nil {
-			// download failed so discard URL
-			logger.Error("failed to validate URL", zap.Error(err))
+	go s.startScheduler()
+}
+
+// insert validates an enqueued URL, storing it and scheduling its refreshes if
+// it is healthy. The returned error is the reason the URL was rejected, if
+// any.
+func (s *Processor) insert(item ingestItem) (scrapeResult, error) {
+	url := item.url
+	logger := s.logger.With(zap.String("url", url), zap.String("job_id", item.jobID))
+
+	if s.ctx.Err() != nil {
+		// we failed to drain the queue before the close deadline
+		logger.Warn("discarding queued URL due to shutdown")
+		err := errors.New("discarded due to shutdown")
+		s.jobs.Update(item.jobID, ports.JobRejected, err.Error())
+		return scrapeResult{}, err
+	}
+
+	s.jobs.Update(item.jobID, ports.JobValidating, "")
+	if err := s.checkRobots(url); err != nil {
+		if errors.Is(err, errDisallowedByRobots) {
+			logger.Warn("rejecting URL disallowed by robots.txt", zap.Error(err))
+		} else {
+			logger.Error("rejecting URL as its robots.txt could not be fetched", zap.Error(err))
+		}
+		s.metrics.validations.With(validationDiscarded).Inc()
+		s.jobs.Update(item.jobID, ports.JobRejected, err.Error())
+		return scrapeResult{}, err
+	}
+	result, err := s.benchmark(url, item.spec, nil)
+	if err != nil {
+		// download failed so discard URL, without recording its benchmark as
+		// the history of URLs which are never stored would grow unbounded
+		logger.Error("failed to validate URL", zap.Error(err))
+		s.metrics.validations.With(validationDiscarded).Inc()
+		s.jobs.Update(item.jobID, ports.JobRejected, err.Error())
+		return result, err
+	}
+
+	// URL is healthy so persist to store and schedule its refreshes
+	key := s.storageKey(url, result, logger)
+	s.benchmarks.Record(key, result.benchmark())
+	s.storage.Store(key, item.spec)
+	s.scheduler.add(key, item.spec)
+	s.track(key, result)
+	s.metrics.validations.With(validationStored).Inc()
+	s.jobs.Update(item.jobID, ports.JobStored, "")
+	logger.Info("successfully validated and stored URL")
+	return result, nil
+}
+
+// startScheduler continuously refreshes the benchmarks of stored URLs as they
+// fall due until the Processor is closed. Due URLs are fanned out to a bounded
+// pool of refresh workers.
+func (s *Processor) startScheduler() {
+	defer close(s.refresherDone)
+
+	due := make(chan ports.Record)
+	workers := newWorkerGroup[ports.Record](s.conf.RefreshWorkers, due, s.refresh)
+	// close due before waiting for the workers to drain it
+	defer workers.Wait()
+	defer close(due)
+
+	// periodically pick up changes to the store, e.g. evictions, and log a
+	// summary of the refreshes since the last sync
+	syncInterval := time.Second * time.Duration(s.conf.RefreshIntervalSeconds)
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	s.scheduler.sync()
+
+	for {
+		timer := time.NewTimer(s.scheduler.untilNext(time.Now(), syncInterval))
+
+		select {
+		case <-timer.C:
+			for _, record := range s.scheduler.due(time.Now()) {
+				select {
+				case due <- record:
+				case <-s.stop:
+					return
+				}
+			}
+		case <-s.scheduler.wake:
+		case <-syncTicker.C:
+			s.scheduler.sync()
+			if summary := s.scheduler.flushSummary(); len(summary.Durations) > 0 {
+				s.logger.Info("successfully refreshed URL benchmarks", zap.Any("summary", summary))
+			}
+		case <-s.stop:
+			timer.Stop()
 			return
 		}
+		timer.Stop()
+	}
+}
 
-		// URL is healthy so persist to store
-		s.storage.Store(url)
-		logger.Info("successfully validated and stored URL")
+// Ingest attempts to ingest a URL into the Processor, returning a queued Job
+// which tracks the outcome. If the processor queue is experiencing
+// backpressure, the call will block until the context is cancelled, in which
+// case an error is returned. It is the responsibility of the consumer to handle
+// this error accordingly. The URL is canonicalised before being enqueued, so
+// that equivalent URLs are stored as a single Record. ports.ErrInvalidURL is
+// returned if the URL is syntactically invalid, and ports.ErrClosed if the
+// Processor has been closed.
+func (s *Processor) Ingest(ctx context.Context, url string, spec *ports.URLSpec) (ports.Job, error) {
+	url, err := canonicaliseURL(url, s.conf.TrackingParams)
+	if err != nil {
+		s.metrics.ingests.With(ingestRejected).Inc()
+		return ports.Job{}, err
+	}
+	if err := validateSpec(spec); err != nil {
+		s.metrics.ingests.With(ingestRejected).Inc()
+		return ports.Job{}, err
 	}
 
-	// create a long-lived worker group to fan out enqueued URL insertions
-	newWorkerGroup[string](3, s.insertQueue, f)
+	return s.enqueue(ctx, ingestItem{url: url, spec: spec})
+}
+
+// Canonicalise returns the canonical form of a URL under which it is stored,
+// or ports.ErrInvalidURL (wrapped) if the URL is syntactically invalid.
+func (s *Processor) Canonicalise(url string) (string, error) {
+	return canonicaliseURL(url, s.conf.TrackingParams)
+}
+
+// enqueue creates a Job for a validated, canonical URL and enqueues it for
+// insertion, blocking until there is space in the queue, ctx expires or the
+// Processor is closed.
+func (s *Processor) enqueue(ctx context.Context, item ingestItem) (ports.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.metrics.ingests.With(ingestRejected).Inc()
+		return ports.Job{}, ports.ErrClosed
+	}
 
-	// continuously refresh benchmarks of the most common URLs
-	ticker := time.NewTicker(time.Second * 60) // TODO: make ticker frequency configurable via yaml
-	for range ticker.C {
-		s.logger.Debug("triggering URL benchmark refresh")
-		s.refreshBenchmarks()
+	// fail fast rather than racing a free queue slot against an expired
+	// context
+	if ctx.Err() != nil {
+		s.metrics.ingests.With(ingestTimedOut).Inc()
+		return ports.Job{}, ports.ErrBackpressure
 	}
+
+	job := s.jobs.Create(item.url)
+	item.jobID = job.ID
+	if item.crawl != nil {
+		item.crawl.setJob(item.url, job.ID)
+	}
+
+	select {
+	case s.insertQueue <- item:
+		s.metrics.ingests.With(ingestAccepted).Inc()
+		return job, nil
+	case <-ctx.Done():
+		s.metrics.ingests.With(ingestTimedOut).Inc()
+		s.jobs.Update(job.ID, ports.JobRejected, ports.ErrBackpressure.Error())
+		return ports.Job{}, ports.ErrBackpressure
+	case <-s.stop:
+		s.metrics.ingests.With(ingestRejected).Inc()
+		s.jobs.Update(job.ID, ports.JobRejected, ports.ErrClosed.Error())
+		return ports.Job{}, ports.ErrClosed
+	}
+}
+
+// Job fetches an ingestion Job by ID.
+func (s *Processor) Job(id string) (ports.Job, bool) {
+	return s.jobs.Get(id)
 }
 
-// Ingest attempts to ingest a URL into the Processor. If the processor queue is
-// experiencing backpressure, the call will block until the context is
-// cancelled, in which case an error is returned. It is the responsibility of
-// the consumer to handle this error accordingly.
-func (s *Processor) Ingest(ctx context.Context, url string) error {
+// Close stops the benchmark refresh scheduler and stops accepting new URLs. It
+// then waits for all queued URLs to be processed and for any in-flight refresh
+// to complete. If ctx expires first, in-flight requests are aborted, remaining
+// queued URLs are discarded and an error is returned.
+func (s *Processor) Close(ctx context.Context) error {
+	alreadyClosed := true
+	s.stopOnce.Do(func() {
+		alreadyClosed = false
+		// unblock any ingestions waiting on a full queue first, otherwise
+		// they would hold the read lock until their contexts expire
+		close(s.stop)
+	})
+	if alreadyClosed {
+		return ports.ErrClosed
+	}
+
+	s.mu.Lock()
+	s.closed = true
+	close(s.insertQueue)
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.insertWorkers.Wait()
+		<-s.refresherDone
+		close(drained)
+	}()
+
 	select {
-	case s.insertQueue <- url:
+	case <-drained:
+		s.cancel()
 		return nil
 	case <-ctx.Done():
-		return errors.New("request to enqueue expired")
+		s.cancel()
+		<-drained
+		return fmt.Errorf("failed to drain processor: %w", ctx.Err())
 	}
 }
 
-func (s *Processor) refreshBenchmarks() {
-	// get 10 most submitted URLs from store and pre-queue them into a buffer
-	records := s.storage.Fetch(10, ports.Count, ports.Descending)
-
-	recordsIn := make(chan string, len(records))
-	for _, record := range records {
-		recordsIn <- record.Key
+// storageKey returns the key a validated URL is stored under: its resolved URL
+// if configured and it was redirected, otherwise the URL itself.
+func (s *Processor) storageKey(url string, result scrapeResult, logger config.Logger) string {
+	if !s.conf.Redirects.StoreResolvedURL || result.FinalURL == "" {
+		return url
 	}
-	// close so that the worker group will terminate once all records have
-	// drained
-	close(recordsIn)
 
-	// use resultsOut to fan results back in from the workers
-	resultsOut := make(chan scrapeResult, len(records))
+	resolved, err := canonicaliseURL(result.FinalURL, s.conf.TrackingParams)
+	if err != nil {
+		logger.Warn("failed to canonicalise resolved URL, storing submitted URL",
+			zap.String("resolved_url", result.FinalURL), zap.Error(err))
+		return url
+	}
+	if resolved != url {
+		logger.Info("storing URL under its resolved URL", zap.String("resolved_url", resolved))
+	}
+	return resolved
+}
 
-	// create worker pool of capacity 3 to fan out requests to benchmark URLs
-	f := func(url string) {
-		logger := s.logger.With(zap.String("url", url))
+// refresh benchmarks a scheduled URL. The request is made conditional on the
+// URL's content having changed since its last successful benchmark.
+func (s *Processor) refresh(record ports.Record) {
+	url := record.Key
+	logger := s.logger.With(zap.String("url", url))
 
-		result, err := s.benchmarkRequest(url)
-		if err != nil {
-			logger.Error("failed to benchmark URL", zap.Error(err))
+	if err := s.checkRobots(url); err != nil {
+		if errors.Is(err, errDisallowedByRobots) {
+			logger.Warn("skipping refresh of URL disallowed by robots.txt", zap.Error(err))
 		} else {
-			s.storage.Store(url)
-			logger.Info("successfully benchmarked URL", zap.Error(err))
+			logger.Error("skipping refresh of URL as its robots.txt could not be fetched", zap.Error(err))
 		}
+		s.scheduler.done(url, scrapeResult{URL: url, Status: failure, Error: err.Error()})
+		return
+	}
+
+	var cached *ports.Content
+	if record.Hash != "" {
+		cached = &record.Content
+	}
+	result, err := s.benchmark(url, &record.URLSpec, cached)
+	s.benchmarks.Record(url, result.benchmark())
+	if err != nil {
+		logger.Error("failed to benchmark URL", zap.Error(err))
+	} else {
+		s.storage.Store(url, nil)
+		s.track(url, result)
+		logger.Info("successfully benchmarked URL", zap.Error(err))
+	}
+
+	s.scheduler.done(url, result)
+}
 
-		resultsOut <- result
+// track updates the details of a stored URL from a successful benchmark.
+func (s *Processor) track(url string, result scrapeResult) {
+	s.trackContent(url, result)
+	s.trackTLS(url, result)
+	if result.metadata != nil {
+		s.storage.UpdateMetadata(url, *result.metadata)
 	}
+	s.trackExtractions(url, result)
+}
 
-	wg := newWorkerGroup[string](3, recordsIn, f)
-	wg.Wait()
+// trackContent updates the content of a stored URL from a successful
+// benchmark, recording a ports.ContentChange if its content changed.
+func (s *Processor) trackContent(url string, result scrapeResult) {
+	content := result.content
+	if content.Hash == "" {
+		return
+	}
 
-	// fan back in results & collect all the download times,
-	summary := &scrapeSummary{}
+	s.scheduler.setContent(url, content)
+	previous, changed := s.storage.UpdateContent(url, content, result.Timestamp)
+	if !changed {
+		return
+	}
+	s.changes.Record(url, ports.ContentChange{
+		Timestamp:    result.Timestamp,
+		Hash:         content.Hash,
+		PreviousHash: previous,
+	})
+	if previous != "" {
+		s.metrics.contentChanges.With(hostOf(url)).Inc()
+		s.logger.Info("detected URL content change", zap.String("url", url),
+			zap.String("previous_hash", previous), zap.String("hash", content.Hash))
+	}
+}
 
-	close(resultsOut)
-	for result := range resultsOut {
-		summary.push(result)
+// trackTLS updates the TLS details of a stored URL from a benchmark, warning if
+// its certificates are expiring.
+func (s *Processor) trackTLS(url string, result scrapeResult) {
+	if result.tls == nil {
+		return
 	}
 
-	// log successful & failed download stats
-	s.logger.Info("successfully refreshed URL benchmarks", zap.Any("summary", summary))
+	s.storage.UpdateTLS(url, *result.tls)
+	if result.tls.Expiring {
+		s.logger.Warn("URL TLS certificate is expiring", zap.String("url", url),
+			zap.Time("expires_at", result.tls.ExpiresAt), zap.Int("days_to_expiry", result.tls.DaysToExpiry))
+	}
 }
 
-func (s *Processor) benchmarkRequest(url string) (scrapeResult, error) {
+// trackExtractions records new versions of the values extracted from a
+// stored URL, warning of any extraction rules which failed.
+func (s *Processor) trackExtractions(url string, result scrapeResult) {
+	for _, value := range result.extracted {
+		if s.extractions.Record(url, value) {
+			s.logger.Debug("extracted new URL value", zap.String("url", url), zap.String("rule", value.Rule),
+				zap.Any("value", value.Value))
+		}
+	}
+	if len(result.extractionFailures) > 0 {
+		s.logger.Warn("failed to extract URL values", zap.String("url", url),
+			zap.Strings("failures", result.extractionFailures))
+	}
+}
+
+// checkRobots returns errDisallowedByRobots (wrapped) if url may not be fetched
+// according to its host's robots.txt, or another error if the robots.txt could
+// not be fetched, in which case url must not be fetched either.
+func (s *Processor) checkRobots(url string) error {
+	if s.robots == nil {
+		return nil
+	}
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+	return s.robots.check(s.ctx, u)
+}
+
+// validateSpec returns ports.ErrInvalidSpec (wrapped) if spec is invalid. A
+// nil spec is valid.
+func validateSpec(spec *ports.URLSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if err := validateRequestSpec(spec); err != nil {
+		return fmt.Errorf("%w: %s", ports.ErrInvalidSpec, err)
+	}
+	if _, err := compileAssertions(spec.Assertions); err != nil {
+		return fmt.Errorf("%w: %s", ports.ErrInvalidSpec, err)
+	}
+	if _, err := parseSchedule(spec.Schedule, time.Minute); err != nil {
+		return fmt.Errorf("%w: %s", ports.ErrInvalidSpec, err)
+	}
+	if err := extract.Validate(spec.Extract); err != nil {
+		return fmt.Errorf("%w: %s", ports.ErrInvalidSpec, err)
+	}
+	return nil
+}
+
+// benchmark benchmarks a request to url as configured by spec, which may be
+// nil. If cached is non-nil, the request is made conditional on its cache
+// validators. The caller records the result in the benchmark history under the
+// URL's storage key.
+func (s *Processor) benchmark(url string, spec *ports.URLSpec, cached *ports.Content) (scrapeResult, error) {
+	result, err := s.benchmarkRequest(url, spec, cached)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	s.metrics.benchmarkDurations.With(hostOf(url), string(result.Status)).Observe(result.elapsed.Seconds())
+	return result, err
+}
+
+// benchmarkRequest benchmarks a request to url, retrying failed attempts
+// according to the retry policy. The timings of the final attempt are
+// recorded. The response is evaluated against the assertions of spec, which
+// may be nil. If cached is non-nil, the request is made conditional on its
+// cache validators.
+func (s *Processor) benchmarkRequest(url string, spec *ports.URLSpec, cached *ports.Content) (scrapeResult, error) {
+	var raw *ports.Assertions
+	if spec != nil {
+		raw = spec.Assertions
+	}
+	checks, err := compileAssertions(raw)
+	if err != nil {
+		result := scrapeResult{URL: url, Status: failure, Timestamp: time.Now().UTC()}
+		return result, fmt.Errorf("invalid assertions: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := s.attemptRequest(url, spec, checks, cached)
+		result.Attempts = attempt
+		if err == nil {
+			return result, nil
+		}
+
+		wait, ok := s.retry.backoff(attempt, err)
+		if !ok {
+			return result, err
+		}
+
+		s.logger.Debug("retrying URL benchmark request", zap.String("url", url),
+			zap.Int("attempt", attempt), zap.Duration("backoff", wait), zap.Error(err))
+
+		if sleep(s.ctx, wait) != nil {
+			return result, err
+		}
+	}
+}
+
+// attemptRequest performs and times a single request to url as configured by
+// spec, evaluating the response against checks. If cached is non-nil, the
+// request is made conditional on its cache validators, and a Not Modified
+// response is successful without being evaluated.
+func (s *Processor) attemptRequest(url string, spec *ports.URLSpec, checks *assertions,
+	cached *ports.Content) (scrapeResult, error) {
 	result := scrapeResult{
-		URL:    url,
-		Status: failure,
+		URL:       url,
+		Status:    failure,
+		Timestamp: time.Now().UTC(),
 	}
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := newRequest(s.ctx, url, spec)
 	if err != nil {
 		return result, fmt.Errorf("failed to create request: %w", err)
 	}
+	conditional := cached != nil && setConditionalHeaders(req, *cached)
+
+	// wait for the host's politeness limits before starting the benchmark
+	var crawlDelay time.Duration
+	if s.robots != nil {
+		crawlDelay = s.robots.crawlDelay(req.URL)
+	}
+	release, waited, err := s.limiter.acquire(s.ctx, req.URL.Host, crawlDelay)
+	s.metrics.rateLimitWaits.With(req.URL.Host).Observe(waited.Seconds())
+	if err != nil {
+		return result, fmt.Errorf("failed to wait for rate limit: %w", err)
+	}
+	defer release()
+	result.Timestamp = time.Now().UTC()
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", s.conf.UserAgent)
+	}
+	req, cancel := withTimeout(req, spec)
+	defer cancel()
+
+	trace := newRequestTrace()
+	redirects := newRedirectChain(s.conf.Redirects, trace)
+	ctx := httptrace.WithClientTrace(req.Context(), trace.clientTrace())
+	req = req.WithContext(context.WithValue(ctx, redirectChainKey{}, redirects))
 
 	now := time.Now().UTC()
+	redirects.start(now)
 
 	resp, err := s.httpClient.Do(req)
+	result.Redirects = redirects.hops
 	if err != nil {
+		end := time.Now().UTC()
+		result.setElapsed(end.Sub(now), trace.timings(end))
 		return result, fmt.Errorf("failed to perform request: %w", err)
 	}
 	defer resp.Body.Close()
+	if len(result.Redirects) > 0 {
+		result.FinalURL = resp.Request.URL.String()
+	}
+	result.tls = tlsInfo(resp.TLS, now, time.Hour*24*time.Duration(s.conf.Certificates.ExpiryWarningDays))
 
-	// ensure we drain body and guarantee connection reuse
-	io.Copy(io.Discard, resp.Body)
+	// ensure we drain body and guarantee connection reuse, hashing it to
+	// detect content changes
+	digest := sha256.New()
+	parseHTML := isHTML(resp.Header)
+	body, bodySize, err := readBody(resp.Body, digest, checks.needsBody() || s.normaliser.needsBody() || parseHTML)
 
 	// finish timing here so that we don't include validation in the benchmark
-	result.Duration = time.Now().UTC().Sub(now).String()
+	end := time.Now().UTC()
+	result.setElapsed(end.Sub(now), trace.timings(end))
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		return result, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		// the content is unchanged since it was last successfully evaluated
+		result.Status = notModified
+		result.content = *cached
+		result.content.ETag, result.content.LastModified = validators(resp.Header, *cached)
+		result.BytesSaved = cached.Size
+		return result, nil
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return result, fmt.Errorf("unexpected HTTP response status: %s", resp.Status)
+	statusOK, failures := checks.evaluate(resp, body, bodySize, result.elapsed)
+	result.FailedAssertions = failures
+	if !statusOK {
+		return result, &statusError{
+			status:     resp.Status,
+			statusCode: resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header, end),
+		}
+	}
+	if len(failures) > 0 {
+		return result, &assertionError{failures: failures}
 	}
 
 	result.Status = success
+	result.content = ports.Content{
+		Hash:         s.normaliser.hash(body, digest),
+		Size:         bodySize,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if parseHTML {
+		metadata, links := parseMetadata(body, resp.Request.URL)
+		result.metadata = &metadata
+		result.links = links
+
+		var rules []ports.ExtractionRule
+		if spec != nil {
+			rules = spec.Extract
+		}
+		result.extracted, result.extractionFailures = s.extractor.Extract(resp.Request.URL.Host, rules, body,
+			result.Timestamp)
+	}
 	return result, nil
 }
 
@@ -161,26 +666,116 @@ type scrapeStatus string
 const (
 	success scrapeStatus = "success"
 	failure scrapeStatus = "failure"
+	// notModified is the successful status of a conditional request whose
+	// content is unchanged.
+	notModified scrapeStatus = "not_modified"
 )
 
+// ok determines whether the status is successful.
+func (s scrapeStatus) ok() bool {
+	return s == success || s == notModified
+}
+
 type scrapeResult struct {
-	URL      string       `json:"url"`
-	Duration string       `json:"duration"`
-	Status   scrapeStatus `json:"status"`
+	URL        string         `json:"url"`
+	Duration   string         `json:"duration"`
+	Phases     phaseDurations `json:"phases"`
+	Status     scrapeStatus   `json:"status"`
+	StatusCode int            `json:"status_code,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Attempts   int            `json:"attempts"`
+	// FailedAssertions describes each assertion the response failed.
+	FailedAssertions []string            `json:"failed_assertions,omitempty"`
+	Redirects        []ports.RedirectHop `json:"redirects,omitempty"`
+	FinalURL         string              `json:"final_url,omitempty"`
+	// BytesSaved is the size of the cached body which wasn't downloaded due
+	// to a Not Modified response.
+	BytesSaved int64     `json:"bytes_saved,omitempty"`
+	Timestamp  time.Time `json:"-"`
+
+	elapsed time.Duration
+	timings ports.PhaseTimings
+	content ports.Content
+	// tls is nil if the final request wasn't made over TLS
+	tls *ports.TLSInfo
+	// metadata is nil unless an HTML response was downloaded, and links are
+	// the absolute URLs it links to
+	metadata *ports.Metadata
+	links    []string
+	// extracted are the values extracted from an HTML response, and
+	// extractionFailures describe each extraction rule which failed
+	extracted          []ports.ExtractedValue
+	extractionFailures []string
+}
+
+// phaseDurations are the human-readable form of ports.PhaseTimings for
+// logging.
+type phaseDurations struct {
+	DNSLookup       string `json:"dns_lookup,omitempty"`
+	Connect         string `json:"connect,omitempty"`
+	TLSHandshake    string `json:"tls_handshake,omitempty"`
+	TimeToFirstByte string `json:"time_to_first_byte,omitempty"`
+	ContentTransfer string `json:"content_transfer,omitempty"`
+}
+
+func (r *scrapeResult) setElapsed(elapsed time.Duration, timings ports.PhaseTimings) {
+	r.elapsed = elapsed
+	r.Duration = elapsed.String()
+
+	r.timings = timings
+	format := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	r.Phases = phaseDurations{
+		DNSLookup:       format(timings.DNSLookup),
+		Connect:         format(timings.Connect),
+		TLSHandshake:    format(timings.TLSHandshake),
+		TimeToFirstByte: format(timings.TimeToFirstByte),
+		ContentTransfer: format(timings.ContentTransfer),
+	}
+}
+
+// benchmark converts the scrapeResult into a ports.Benchmark.
+func (r scrapeResult) benchmark() ports.Benchmark {
+	return ports.Benchmark{
+		Timestamp:  r.Timestamp,
+		Duration:   r.elapsed,
+		Phases:     r.timings,
+		Status:     string(r.Status),
+		StatusCode: r.StatusCode,
+		Error:      r.Error,
+		Attempts:   r.Attempts,
+
+		FailedAssertions: r.FailedAssertions,
+		ContentHash:      r.content.Hash,
+		Redirects:        r.Redirects,
+		FinalURL:         r.FinalURL,
+	}
 }
 
 type scrapeSummary struct {
 	Durations    []scrapeResult `json:"scrape_durations"`
 	SuccessCount int            `json:"success_count"`
 	FailureCount int            `json:"failure_count"`
+	// NotModifiedCount is the number of successful results which were Not
+	// Modified, saving BytesSaved bytes of downloads in total.
+	NotModifiedCount int   `json:"not_modified_count"`
+	BytesSaved       int64 `json:"bytes_saved"`
 }
 
 func (s *scrapeSummary) push(result scrapeResult) {
-	if result.Status == success {
+	if result.Status.ok() {
 		s.SuccessCount++
 	} else {
 		s.FailureCount++
 	}
+	if result.Status == notModified {
+		s.NotModifiedCount++
+		s.BytesSaved += result.BytesSaved
+	}
 	s.Durations = append(s.Durations, result)
 }
 
@@ -0,0 +1,598 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/extract"
+	"jemgunay/url-scraper/pkg/metrics"
+	"jemgunay/url-scraper/pkg/ports"
+	"jemgunay/url-scraper/pkg/store"
+)
+
+func TestProcessor_BenchmarkRequest_Phases(t *testing.T) {
+	const thinkTime = 50 * time.Millisecond
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(thinkTime)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(thinkTime)
+		w.Write([]byte("hello"))
+	})
+
+	tests := []struct {
+		name      string
+		newServer func(http.Handler) *httptest.Server
+		tls       bool
+	}{
+		{
+			name:      "http",
+			newServer: httptest.NewServer,
+		},
+		{
+			name:      "https",
+			newServer: httptest.NewTLSServer,
+			tls:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.newServer(handler)
+			defer server.Close()
+
+			processor, _, _ := newTestProcessor(t, newTestConfig(), server.Client())
+			defer processor.Close(context.Background())
+
+			result, err := processor.benchmarkRequest(server.URL, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, success, result.Status)
+			require.Equal(t, http.StatusOK, result.StatusCode)
+
+			timings := result.timings
+			require.Positive(t, timings.Connect)
+			require.GreaterOrEqual(t, timings.TimeToFirstByte, thinkTime)
+			require.GreaterOrEqual(t, timings.ContentTransfer, thinkTime)
+			require.Equal(t, tt.tls, timings.TLSHandshake > 0)
+			require.NotEmpty(t, result.Phases.TimeToFirstByte)
+
+			// the connection should be reused so no connection phases are
+			// expected
+			result, err = processor.benchmarkRequest(server.URL, nil, nil)
+			require.NoError(t, err)
+			require.Zero(t, result.timings.Connect)
+			require.Zero(t, result.timings.TLSHandshake)
+			require.Empty(t, result.Phases.Connect)
+		})
+	}
+}
+
+func newTestConfig() config.Ingest {
+	return config.Ingest{
+		QueueCapacity:          10,
+		InsertWorkers:          3,
+		RefreshWorkers:         3,
+		RefreshIntervalSeconds: 60,
+		RefreshJitter:          0.1,
+		JobCapacity:            100,
+		Retry: config.Retry{
+			MaxAttempts:          3,
+			BaseBackoffMillis:    1,
+			MaxBackoffMillis:     10,
+			Jitter:               0.5,
+			RetryableStatusCodes: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+		},
+		Redirects: config.Redirects{
+			MaxRedirects:     10,
+			AllowCrossDomain: true,
+		},
+		Certificates: config.Certificates{
+			ExpiryWarningDays: 30,
+		},
+		Crawl: config.Crawl{
+			MaxDepth: 3,
+			MaxPages: 100,
+			Capacity: 10,
+		},
+		LinkCheck: config.LinkCheck{
+			Workers:        3,
+			TimeoutSeconds: 5,
+			MaxLinks:       100,
+			Capacity:       10,
+		},
+		UserAgent: "url-scraper-test/1.0",
+	}
+}
+
+// newTestProcessor initialises a Processor backed by in-memory stores.
+func newTestProcessor(t *testing.T, conf config.Ingest, httpClient ports.Client) (*Processor, *store.Store, *store.JobStore) {
+	logger := zap.NewNop()
+	storage := store.New(logger, 50)
+	jobs := store.NewJobStore(logger, conf.JobCapacity)
+	benchmarks := store.NewBenchmarkStore(logger, time.Hour, 10)
+	changes := store.NewChangeStore(logger, time.Hour, 10)
+	extractions := store.NewExtractionStore(logger, time.Hour, 10)
+	extractor, err := extract.New(conf.Extraction)
+	require.NoError(t, err)
+
+	processor := New(logger, conf, Deps{
+		Storage:     storage,
+		Benchmarks:  benchmarks,
+		Changes:     changes,
+		Extractions: extractions,
+		Jobs:        jobs,
+		HTTPClient:  httpClient,
+		Extractor:   extractor,
+		Registry:    metrics.NewRegistry(),
+	})
+	return processor, storage, jobs
+}
+
+func TestProcessor_Ingest_Jobs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	processor, _, _ := newTestProcessor(t, newTestConfig(), server.Client())
+
+	stored, err := processor.Ingest(context.Background(), server.URL+"/ok", nil)
+	require.NoError(t, err)
+	require.Equal(t, ports.JobQueued, stored.Status)
+	rejected, err := processor.Ingest(context.Background(), server.URL+"/missing", nil)
+	require.NoError(t, err)
+	_, err = processor.Ingest(context.Background(), "ftp://example.com", nil)
+	require.ErrorIs(t, err, ports.ErrInvalidURL)
+
+	require.NoError(t, processor.Close(context.Background()))
+
+	job, ok := processor.Job(stored.ID)
+	require.True(t, ok)
+	require.Equal(t, ports.JobStored, job.Status)
+
+	job, ok = processor.Job(rejected.ID)
+	require.True(t, ok)
+	require.Equal(t, ports.JobRejected, job.Status)
+	require.Equal(t, "unexpected HTTP response status: 404 Not Found", job.Reason)
+
+	// only the benchmarks of stored URLs are recorded
+	require.Len(t, processor.benchmarks.Query(server.URL+"/ok", time.Time{}, time.Time{}, 10), 1)
+	require.Empty(t, processor.benchmarks.Query(server.URL+"/missing", time.Time{}, time.Time{}, 10))
+}
+
+func TestProcessor_Ingest_Canonical(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.InsertWorkers = 1
+	conf.TrackingParams = []string{"utm_*"}
+	processor, storage, _ := newTestProcessor(t, conf, server.Client())
+
+	for _, url := range []string{server.URL, server.URL + "/#frag", server.URL + "/?utm_source=test"} {
+		job, err := processor.Ingest(context.Background(), url, nil)
+		require.NoError(t, err)
+		require.Equal(t, server.URL+"/", job.URL)
+	}
+	require.NoError(t, processor.Close(context.Background()))
+
+	records := storage.Fetch(10, ports.Age, ports.Descending)
+	require.Len(t, records, 1)
+	require.Equal(t, server.URL+"/", records[0].Key)
+	require.Equal(t, 3, records[0].SubmitCount)
+}
+
+func TestProcessor_Ingest_Robots(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: url-scraper-test\nDisallow: /private\n"))
+		}
+	}))
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Robots = config.Robots{Enabled: true, CacheTTLSeconds: 60}
+	processor, storage, _ := newTestProcessor(t, conf, server.Client())
+
+	allowed, err := processor.Ingest(context.Background(), server.URL+"/public", nil)
+	require.NoError(t, err)
+	disallowed, err := processor.Ingest(context.Background(), server.URL+"/private/page", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, processor.Close(context.Background()))
+
+	job, ok := processor.Job(allowed.ID)
+	require.True(t, ok)
+	require.Equal(t, ports.JobStored, job.Status)
+
+	job, ok = processor.Job(disallowed.ID)
+	require.True(t, ok)
+	require.Equal(t, ports.JobRejected, job.Status)
+	require.Equal(t, "disallowed by robots.txt for user agent url-scraper-test/1.0", job.Reason)
+
+	records := storage.Fetch(10, ports.Age, ports.Descending)
+	require.Len(t, records, 1)
+	require.Equal(t, server.URL+"/public", records[0].Key)
+}
+
+func TestProcessor_Ingest_RobotsUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Robots = config.Robots{Enabled: true, CacheTTLSeconds: 60}
+	processor, storage, _ := newTestProcessor(t, conf, server.Client())
+
+	// an unreachable robots.txt disallows the URL, but isn't reported as such
+	err := processor.checkRobots(server.URL + "/public")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, errDisallowedByRobots)
+
+	job, err := processor.Ingest(context.Background(), server.URL+"/public", nil)
+	require.NoError(t, err)
+	require.NoError(t, processor.Close(context.Background()))
+
+	job, ok := processor.Job(job.ID)
+	require.True(t, ok)
+	require.Equal(t, ports.JobRejected, job.Status)
+	require.Equal(t, "failed to fetch robots.txt: unexpected HTTP response status: 503 Service Unavailable", job.Reason)
+	require.Empty(t, storage.Fetch(10, ports.Age, ports.Descending))
+}
+
+func TestProcessor_ContentChanges(t *testing.T) {
+	var version, requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		// vary whitespace and a timestamp on every request, which are both
+		// normalised away
+		fmt.Fprintf(w, "<p>version %d</p>%*s<span>generated at %d</span>", atomic.LoadInt32(&version), n, "", n)
+	}))
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.ChangeDetection = config.ChangeDetection{
+		IgnoreWhitespace: true,
+		StripPatterns:    []string{`generated at \d+`},
+	}
+	processor, storage, _ := newTestProcessor(t, conf, server.Client())
+	defer processor.Close(context.Background())
+
+	url := server.URL + "/"
+	job, err := processor.Ingest(context.Background(), url, nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		job, _ := processor.Job(job.ID)
+		return job.Status == ports.JobStored
+	}, time.Second, 10*time.Millisecond)
+
+	record := storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.NotEmpty(t, record.Hash)
+	firstHash, firstChanged := record.Hash, record.LastChanged
+
+	processor.refresh(record)
+	record = storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.Equal(t, firstHash, record.Hash)
+	require.Equal(t, firstChanged, record.LastChanged)
+
+	atomic.StoreInt32(&version, 1)
+	processor.refresh(record)
+	record = storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.NotEqual(t, firstHash, record.Hash)
+	require.True(t, record.LastChanged.After(firstChanged))
+
+	changes := processor.changes.Query(url, time.Time{}, 10)
+	require.Len(t, changes, 2)
+	require.Equal(t, ports.ContentChange{
+		Timestamp:    record.LastChanged,
+		Hash:         record.Hash,
+		PreviousHash: firstHash,
+	}, changes[0])
+	require.Empty(t, changes[1].PreviousHash)
+
+	benchmarks := processor.benchmarks.Query(url, time.Time{}, time.Time{}, 10)
+	require.Len(t, benchmarks, 3)
+	require.Equal(t, record.Hash, benchmarks[0].ContentHash)
+}
+
+func TestProcessor_ConditionalRequests(t *testing.T) {
+	const body = "<p>hello</p>"
+	var version, notModifiedCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, atomic.LoadInt32(&version))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModifiedCount, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	processor, storage, _ := newTestProcessor(t, newTestConfig(), server.Client())
+	defer processor.Close(context.Background())
+
+	url := server.URL + "/"
+	job, err := processor.Ingest(context.Background(), url, nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		job, _ := processor.Job(job.ID)
+		return job.Status == ports.JobStored
+	}, time.Second, 10*time.Millisecond)
+
+	record := storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.Equal(t, `"v0"`, record.ETag)
+	require.Equal(t, int64(len(body)), record.Size)
+	firstHash := record.Hash
+
+	// unchanged content isn't downloaded
+	processor.refresh(record)
+	require.Equal(t, int32(1), atomic.LoadInt32(&notModifiedCount))
+	record = storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.Equal(t, firstHash, record.Hash)
+
+	summary := processor.scheduler.flushSummary()
+	require.Equal(t, 1, summary.SuccessCount)
+	require.Equal(t, 1, summary.NotModifiedCount)
+	require.Equal(t, int64(len(body)), summary.BytesSaved)
+	require.Equal(t, notModified, summary.Durations[0].Status)
+
+	// changed content is downloaded in full
+	atomic.StoreInt32(&version, 1)
+	processor.refresh(record)
+	require.Equal(t, int32(1), atomic.LoadInt32(&notModifiedCount))
+	record = storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.Equal(t, `"v1"`, record.ETag)
+
+	summary = processor.scheduler.flushSummary()
+	require.Equal(t, 1, summary.SuccessCount)
+	require.Zero(t, summary.NotModifiedCount)
+	require.Zero(t, summary.BytesSaved)
+
+	benchmarks := processor.benchmarks.Query(url, time.Time{}, time.Time{}, 10)
+	require.Len(t, benchmarks, 3)
+	require.Equal(t, string(notModified), benchmarks[1].Status)
+	require.Equal(t, firstHash, benchmarks[1].ContentHash)
+}
+
+func TestProcessor_Metadata(t *testing.T) {
+	var version int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<html lang="en"><title>Version %d</title><a href="https://example.com">x</a></html>`,
+			atomic.LoadInt32(&version))
+	}))
+	defer server.Close()
+
+	processor, storage, _ := newTestProcessor(t, newTestConfig(), server.Client())
+	defer processor.Close(context.Background())
+
+	job, err := processor.Ingest(context.Background(), server.URL+"/", nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		job, _ := processor.Job(job.ID)
+		return job.Status == ports.JobStored
+	}, time.Second, 10*time.Millisecond)
+
+	record := storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.Equal(t, &ports.Metadata{Title: "Version 0", Language: "en", OutboundLinks: 1}, record.Metadata)
+
+	atomic.StoreInt32(&version, 1)
+	processor.refresh(record)
+	record = storage.Fetch(1, ports.Age, ports.Descending)[0]
+	require.Equal(t, "Version 1", record.Metadata.Title)
+}
+
+func TestProcessor_Extractions(t *testing.T) {
+	var price int32 = 10
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<h1>Widget</h1><span class="price">£%d.00</span>`, atomic.LoadInt32(&price))
+	}))
+	defer server.Close()
+
+	processor, storage, _ := newTestProcessor(t, newTestConfig(), server.Client())
+	defer processor.Close(context.Background())
+
+	spec := &ports.URLSpec{Extract: []ports.ExtractionRule{
+		{Name: "title", Selector: "h1"},
+		{Name: "price", Selector: ".price", Pattern: `[\d.]+`, Type: ports.ExtractNumber},
+		{Name: "missing", Selector: "table"},
+	}}
+	url := server.URL + "/"
+	job, err := processor.Ingest(context.Background(), url, spec)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		job, _ := processor.Job(job.ID)
+		return job.Status == ports.JobStored
+	}, time.Second, 10*time.Millisecond)
+
+	// only changed values are versioned
+	record := storage.Fetch(1, ports.Age, ports.Descending)[0]
+	processor.refresh(record)
+	atomic.StoreInt32(&price, 12)
+	processor.refresh(record)
+
+	values := processor.extractions.Query(url, "", time.Time{}, 10)
+	require.Len(t, values, 3)
+	require.Equal(t, "price", values[0].Rule)
+	require.Equal(t, 12.0, values[0].Value)
+	require.Equal(t, 10.0, values[1].Value)
+	require.Equal(t, "Widget", values[2].Value)
+
+	_, err = processor.Ingest(context.Background(), url, &ports.URLSpec{Extract: []ports.ExtractionRule{{Name: "a"}}})
+	require.ErrorIs(t, err, ports.ErrInvalidSpec)
+}
+
+func TestProcessor_BenchmarkRequest_Retry(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []int
+		retryAfter       string
+		expectedAttempts int
+		expectedStatus   scrapeStatus
+		expectedCode     int
+	}{
+		{
+			name:             "succeeds after retryable statuses",
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			expectedAttempts: 3,
+			expectedStatus:   success,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "gives up after max attempts",
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			expectedAttempts: 3,
+			expectedStatus:   failure,
+			expectedCode:     http.StatusServiceUnavailable,
+		},
+		{
+			name:             "non-retryable status",
+			statuses:         []int{http.StatusNotFound, http.StatusOK},
+			expectedAttempts: 1,
+			expectedStatus:   failure,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "retry after exceeds max backoff",
+			statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "120",
+			expectedAttempts: 1,
+			expectedStatus:   failure,
+			expectedCode:     http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := atomic.AddInt32(&requests, 1) - 1
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[i])
+			}))
+			defer server.Close()
+
+			processor, _, _ := newTestProcessor(t, newTestConfig(), server.Client())
+			defer processor.Close(context.Background())
+
+			result, _ := processor.benchmarkRequest(server.URL, nil, nil)
+			require.Equal(t, tt.expectedAttempts, result.Attempts)
+			require.Equal(t, tt.expectedAttempts, int(atomic.LoadInt32(&requests)))
+			require.Equal(t, tt.expectedStatus, result.Status)
+			require.Equal(t, tt.expectedCode, result.StatusCode)
+		})
+	}
+}
+
+func TestProcessor_Close(t *testing.T) {
+	t.Run("drains queued URLs", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		processor, storage, _ := newTestProcessor(t, newTestConfig(), server.Client())
+
+		for i := 0; i < 10; i++ {
+			_, err := processor.Ingest(context.Background(), fmt.Sprintf("%s/%d", server.URL, i), nil)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, processor.Close(context.Background()))
+		require.Len(t, storage.Fetch(50, ports.Age, ports.Descending), 10)
+
+		// subsequent ingestions and closes should be rejected
+		_, err := processor.Ingest(context.Background(), server.URL, nil)
+		require.ErrorIs(t, err, ports.ErrClosed)
+		require.ErrorIs(t, processor.Close(context.Background()), ports.ErrClosed)
+	})
+
+	t.Run("aborts in-flight requests on deadline", func(t *testing.T) {
+		unblock := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-unblock:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(unblock)
+
+		processor, storage, jobs := newTestProcessor(t, newTestConfig(), server.Client())
+
+		var jobIDs []string
+		for i := 0; i < 10; i++ {
+			job, err := processor.Ingest(context.Background(), fmt.Sprintf("%s/%d", server.URL, i), nil)
+			require.NoError(t, err)
+			jobIDs = append(jobIDs, job.ID)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := processor.Close(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), time.Second)
+		require.Empty(t, storage.Fetch(50, ports.Age, ports.Descending))
+
+		for _, id := range jobIDs {
+			job, ok := jobs.Get(id)
+			require.True(t, ok)
+			require.Equal(t, ports.JobRejected, job.Status)
+		}
+	})
+
+	t.Run("unblocks ingestions waiting on a full queue", func(t *testing.T) {
+		unblock := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-unblock:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(unblock)
+
+		conf := newTestConfig()
+		conf.QueueCapacity = 0
+		conf.InsertWorkers = 1
+		processor, _, _ := newTestProcessor(t, conf, server.Client())
+
+		// occupy the only worker so that the next ingestion blocks
+		_, err := processor.Ingest(context.Background(), server.URL, nil)
+		require.NoError(t, err)
+
+		ingestErr := make(chan error)
+		go func() {
+			_, err := processor.Ingest(context.Background(), server.URL, nil)
+			ingestErr <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.Error(t, processor.Close(ctx))
+		require.ErrorIs(t, <-ingestErr, ports.ErrClosed)
+	})
+}
@@ -0,0 +1,289 @@
+package ingest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/internal/domain"
+)
+
+// hostIdleTimeout is how long a host's limits are retained after its last
+// request finishes. Idle hosts are evicted so that the limits of every host
+// ever requested aren't retained indefinitely.
+const hostIdleTimeout = 10 * time.Minute
+
+// hostLimiter applies per-host politeness limits to outgoing requests: a
+// token bucket limiting the request rate and a semaphore limiting the number
+// of in-flight requests.
+type hostLimiter struct {
+	conf config.RateLimit
+	// domains are the domain overrides of conf keyed by lowercase domain
+	domains map[string]config.HostLimit
+
+	mu        *sync.Mutex
+	hosts     map[string]*hostLimit
+	lastEvict time.Time
+}
+
+type hostLimit struct {
+	// bucket is nil if rate limiting is disabled
+	bucket *tokenBucket
+	// inFlight is nil if the concurrency limit is disabled
+	inFlight chan struct{}
+
+	// active is the number of requests waiting for or holding the limits and
+	// lastUsed is when the last of them finished, both guarded by the
+	// hostLimiter's mutex
+	active   int
+	lastUsed time.Time
+
+	// next is the earliest time the next request may start in order to honour
+	// the host's crawl delay
+	mu   *sync.Mutex
+	next time.Time
+}
+
+func newHostLimiter(conf config.RateLimit) *hostLimiter {
+	domains := make(map[string]config.HostLimit, len(conf.Domains))
+	for name, override := range conf.Domains {
+		domains[strings.ToLower(name)] = override
+	}
+
+	return &hostLimiter{
+		conf:      conf,
+		domains:   domains,
+		mu:        &sync.Mutex{},
+		hosts:     make(map[string]*hostLimit),
+		lastEvict: time.Now(),
+	}
+}
+
+// acquire blocks until a request to host is permitted, returning a release
+// func which must be called once the request completes and the time spent
+// waiting. Consecutive requests are additionally spaced by crawlDelay, if
+// non-zero. An error is returned if ctx is done before the request is
+// permitted.
+func (l *hostLimiter) acquire(ctx context.Context, host string, crawlDelay time.Duration) (func(), time.Duration, error) {
+	limit := l.limitFor(host)
+	start := time.Now()
+
+	release := func() { l.done(limit) }
+	if limit.inFlight != nil {
+		select {
+		case limit.inFlight <- struct{}{}:
+			release = func() {
+				<-limit.inFlight
+				l.done(limit)
+			}
+		case <-ctx.Done():
+			l.done(limit)
+			return nil, time.Since(start), ctx.Err()
+		}
+	}
+
+	if limit.bucket != nil {
+		if err := limit.bucket.wait(ctx); err != nil {
+			release()
+			return nil, time.Since(start), err
+		}
+	}
+
+	if crawlDelay > 0 {
+		if err := limit.delay(ctx, crawlDelay); err != nil {
+			release()
+			return nil, time.Since(start), err
+		}
+	}
+
+	return release, time.Since(start), nil
+}
+
+// delay blocks until crawlDelay has passed since the previous request to the
+// host started.
+func (h *hostLimit) delay(ctx context.Context, crawlDelay time.Duration) error {
+	h.mu.Lock()
+	now := time.Now()
+	start := h.next
+	if start.Before(now) {
+		start = now
+	}
+	h.next = start.Add(crawlDelay)
+	h.mu.Unlock()
+
+	return sleep(ctx, start.Sub(now))
+}
+
+// limitFor returns the limits of host, initialising them on first use. The
+// caller must call done once it is finished with the limits.
+func (l *hostLimiter) limitFor(host string) *hostLimit {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// periodically sweep every host so that hosts which are no longer being
+	// requested are eventually evicted
+	now := time.Now()
+	if now.Sub(l.lastEvict) > time.Minute {
+		l.evictIdle(now)
+		l.lastEvict = now
+	}
+
+	if limit, ok := l.hosts[host]; ok {
+		limit.active++
+		return limit
+	}
+
+	conf := l.hostConfig(host)
+	limit := &hostLimit{mu: &sync.Mutex{}}
+	if conf.RequestsPerSecond > 0 {
+		limit.bucket = newTokenBucket(conf.RequestsPerSecond, conf.Burst)
+	}
+	if conf.MaxConcurrency > 0 {
+		limit.inFlight = make(chan struct{}, conf.MaxConcurrency)
+	}
+	limit.active++
+	l.hosts[host] = limit
+	return limit
+}
+
+// done marks a request to a host as finished with its limits.
+func (l *hostLimiter) done(limit *hostLimit) {
+	l.mu.Lock()
+	limit.active--
+	limit.lastUsed = time.Now()
+	l.mu.Unlock()
+}
+
+// evictIdle removes the limits of hosts with no requests in progress which
+// have been idle for longer than hostIdleTimeout. The caller must hold the
+// lock.
+func (l *hostLimiter) evictIdle(now time.Time) {
+	for host, limit := range l.hosts {
+		if limit.idle(now) {
+			delete(l.hosts, host)
+		}
+	}
+}
+
+// idle determines whether the limits are no longer needed, i.e. whether
+// recreating them would impose the same limits. The hostLimiter's lock must be
+// held.
+func (h *hostLimit) idle(now time.Time) bool {
+	if h.active > 0 || now.Sub(h.lastUsed) <= hostIdleTimeout {
+		return false
+	}
+	// the bucket must have refilled and the crawl delay must have passed
+	if h.bucket != nil && !h.bucket.full(now) {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return now.After(h.next)
+}
+
+// hostConfig resolves the limits of host from the most specific matching
+// domain override, falling back to the defaults for any unset fields.
+func (l *hostLimiter) hostConfig(host string) config.HostLimit {
+	conf := l.conf.HostLimit
+
+	override, ok := domain.Match(l.domains, host)
+	if !ok {
+		return conf
+	}
+	if override.RequestsPerSecond > 0 {
+		conf.RequestsPerSecond = override.RequestsPerSecond
+	}
+	if override.Burst > 0 {
+		conf.Burst = override.Burst
+	}
+	if override.MaxConcurrency > 0 {
+		conf.MaxConcurrency = override.MaxConcurrency
+	}
+	return conf
+}
+
+// tokenBucket is a token bucket rate limiter. Tokens are refilled at rate per
+// second up to burst.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     *sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		mu:     &sync.Mutex{},
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available, or until ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if err := sleep(ctx, b.reserve(time.Now())); err != nil {
+		// return the reserved token so that it isn't lost to a request which
+		// was never made
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// reserve takes a token, returning how long to wait before it may be used.
+// Tokens may go negative so that waiters are served in the order they
+// reserved.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full determines whether the bucket will have refilled to its burst by now.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// sleep blocks for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
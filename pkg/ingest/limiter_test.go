@@ -0,0 +1,137 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/config"
+)
+
+func TestHostLimiter_HostConfig(t *testing.T) {
+	limiter := newHostLimiter(config.RateLimit{
+		HostLimit: config.HostLimit{RequestsPerSecond: 5, Burst: 5, MaxConcurrency: 2},
+		Domains: map[string]config.HostLimit{
+			"httpbin.org":         {RequestsPerSecond: 1},
+			"private.httpbin.org": {MaxConcurrency: 1},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		host     string
+		expected config.HostLimit
+	}{
+		{"default", "example.com", config.HostLimit{RequestsPerSecond: 5, Burst: 5, MaxConcurrency: 2}},
+		{"domain override", "httpbin.org", config.HostLimit{RequestsPerSecond: 1, Burst: 5, MaxConcurrency: 2}},
+		{"subdomain override", "api.httpbin.org:8080", config.HostLimit{RequestsPerSecond: 1, Burst: 5, MaxConcurrency: 2}},
+		{"most specific override", "private.httpbin.org", config.HostLimit{RequestsPerSecond: 5, Burst: 5, MaxConcurrency: 1}},
+		{"suffix is not a subdomain", "nothttpbin.org", config.HostLimit{RequestsPerSecond: 5, Burst: 5, MaxConcurrency: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, limiter.hostConfig(tt.host))
+		})
+	}
+}
+
+func TestHostLimiter_Acquire(t *testing.T) {
+	t.Run("rate limits per host", func(t *testing.T) {
+		limiter := newHostLimiter(config.RateLimit{
+			HostLimit: config.HostLimit{RequestsPerSecond: 20, Burst: 2},
+		})
+
+		// the burst is permitted immediately, then requests are spaced by
+		// the refill rate
+		for i := 0; i < 2; i++ {
+			release, waited, err := limiter.acquire(context.Background(), "example.com", 0)
+			require.NoError(t, err)
+			require.Less(t, waited, 10*time.Millisecond)
+			release()
+		}
+		release, waited, err := limiter.acquire(context.Background(), "example.com", 0)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, waited, 40*time.Millisecond)
+		release()
+
+		// other hosts have their own bucket
+		_, waited, err = limiter.acquire(context.Background(), "other.com", 0)
+		require.NoError(t, err)
+		require.Less(t, waited, 10*time.Millisecond)
+	})
+
+	t.Run("limits concurrency per host", func(t *testing.T) {
+		limiter := newHostLimiter(config.RateLimit{
+			HostLimit: config.HostLimit{MaxConcurrency: 1},
+		})
+
+		release, _, err := limiter.acquire(context.Background(), "example.com", 0)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, _, err = limiter.acquire(ctx, "example.com", 0)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		release()
+		release, _, err = limiter.acquire(context.Background(), "example.com", 0)
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("spaces requests by crawl delay", func(t *testing.T) {
+		limiter := newHostLimiter(config.RateLimit{})
+
+		_, waited, err := limiter.acquire(context.Background(), "example.com", 50*time.Millisecond)
+		require.NoError(t, err)
+		require.Less(t, waited, 10*time.Millisecond)
+
+		_, waited, err = limiter.acquire(context.Background(), "example.com", 50*time.Millisecond)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, waited, 40*time.Millisecond)
+	})
+}
+
+func TestHostLimiter_EvictIdle(t *testing.T) {
+	limiter := newHostLimiter(config.RateLimit{
+		HostLimit: config.HostLimit{RequestsPerSecond: 1, Burst: 1, MaxConcurrency: 1},
+	})
+
+	release, _, err := limiter.acquire(context.Background(), "idle.com", 0)
+	require.NoError(t, err)
+	release()
+	release, _, err = limiter.acquire(context.Background(), "busy.com", 0)
+	require.NoError(t, err)
+	defer release()
+	release, _, err = limiter.acquire(context.Background(), "delayed.com", time.Hour)
+	require.NoError(t, err)
+	release()
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected []string
+	}{
+		{"recently used", now, []string{"busy.com", "delayed.com", "idle.com"}},
+		{"idle", now.Add(hostIdleTimeout + time.Second), []string{"busy.com", "delayed.com"}},
+		{"crawl delay passed", now.Add(2 * time.Hour), []string{"busy.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter.mu.Lock()
+			limiter.evictIdle(tt.now)
+			hosts := make([]string, 0, len(limiter.hosts))
+			for host := range limiter.hosts {
+				hosts = append(hosts, host)
+			}
+			limiter.mu.Unlock()
+
+			require.ElementsMatch(t, tt.expected, hosts)
+		})
+	}
+}
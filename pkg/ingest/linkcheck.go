@@ -0,0 +1,477 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"jemgunay/url-scraper/pkg/ports"
+	"jemgunay/url-scraper/pkg/store"
+)
+
+// CheckLinks starts checking the links and assets referenced by either a
+// single page or the stored pages of a crawl. Pages are fetched and each unique
+// link they reference is checked concurrently in the background; the returned
+// LinkCheck can be polled with LinkCheckStatus. ports.ErrInvalidURL,
+// ports.ErrInvalidSpec, ports.ErrCrawlNotFound or ports.ErrClosed are returned
+// if the link check isn't started.
+func (s *Processor) CheckLinks(spec ports.LinkCheckSpec) (ports.LinkCheck, error) {
+	var pages []string
+	switch {
+	case (spec.URL == "") == (spec.CrawlID == ""):
+		return ports.LinkCheck{}, fmt.Errorf("%w: exactly one of url or crawl_id must be provided", ports.ErrInvalidSpec)
+
+	case spec.URL != "":
+		page, err := canonicaliseURL(spec.URL, s.conf.TrackingParams)
+		if err != nil {
+			return ports.LinkCheck{}, err
+		}
+		spec.URL = page
+		pages = []string{page}
+
+	default:
+		c, ok := s.crawls.Get(spec.CrawlID)
+		if !ok {
+			return ports.LinkCheck{}, ports.ErrCrawlNotFound
+		}
+		// only pages which have been stored so far are checked
+		for _, page := range c.snapshot().Pages {
+			if page.Status == ports.JobStored {
+				pages = append(pages, page.URL)
+			}
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ports.LinkCheck{}, ports.ErrClosed
+	}
+
+	lc := newLinkCheck(spec, pages, s.conf.LinkCheck.MaxLinks)
+	s.linkChecks.Add(lc.id, lc)
+	go s.runLinkCheck(lc, pages)
+	s.logger.Info("started link check", zap.String("link_check_id", lc.id), zap.Int("pages", len(pages)))
+
+	return lc.snapshot(), nil
+}
+
+// LinkCheckStatus fetches a LinkCheck by ID.
+func (s *Processor) LinkCheckStatus(id string) (ports.LinkCheck, bool) {
+	lc, ok := s.linkChecks.Get(id)
+	if !ok {
+		return ports.LinkCheck{}, false
+	}
+	return lc.snapshot(), true
+}
+
+// runLinkCheck fetches each page in turn, fanning out the unique links they
+// reference to a bounded pool of workers. In-flight requests are aborted if the
+// Processor fails to close gracefully, in which case the link check is aborted.
+func (s *Processor) runLinkCheck(lc *linkCheck, pages []string) {
+	links := make(chan string)
+	workers := newWorkerGroup[string](s.conf.LinkCheck.Workers, links, func(link string) {
+		result := s.checkLink(link)
+		if s.ctx.Err() != nil {
+			// the request was aborted rather than the link being broken
+			return
+		}
+		lc.record(link, result)
+	})
+
+	for _, page := range pages {
+		if s.ctx.Err() != nil {
+			break
+		}
+
+		refs, err := s.fetchReferences(page)
+		if err != nil {
+			s.logger.Warn("failed to fetch page to check links", zap.String("link_check_id", lc.id),
+				zap.String("url", page), zap.Error(err))
+			lc.pageFailed(page, err)
+			continue
+		}
+
+		for _, link := range lc.addPage(page, refs) {
+			select {
+			case links <- link:
+			case <-s.ctx.Done():
+			}
+		}
+	}
+
+	close(links)
+	workers.Wait()
+	lc.finish(s.ctx.Err() != nil)
+	s.logger.Info("completed link check", zap.String("link_check_id", lc.id))
+}
+
+// fetchReferences fetches an HTML page, returning the links it references.
+func (s *Processor) fetchReferences(page string) ([]reference, error) {
+	if err := s.checkRobots(page); err != nil {
+		return nil, err
+	}
+
+	resp, done, err := s.linkRequest(http.MethodGet, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer done()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if !isHTML(resp.Header) {
+		return nil, errors.New("page isn't HTML")
+	}
+	body, _, err := readBody(resp.Body, io.Discard, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return parseReferences(body, resp.Request.URL), nil
+}
+
+// checkLink checks whether a link is broken. A HEAD request is made, falling
+// back to a GET request if the server doesn't support HEAD.
+func (s *Processor) checkLink(link string) linkResult {
+	resp, done, err := s.linkRequest(http.MethodHead, link)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		done()
+		resp, done, err = s.linkRequest(http.MethodGet, link)
+	}
+	if err != nil {
+		return linkResult{failure: linkFailure(err), err: err.Error()}
+	}
+	defer done()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return linkResult{failure: ports.LinkHTTPError, statusCode: resp.StatusCode}
+	}
+	return linkResult{statusCode: resp.StatusCode}
+}
+
+// linkRequest performs a request to url within the host's politeness limits
+// and the link check timeout. done must be called once the response has been
+// consumed.
+func (s *Processor) linkRequest(method, url string) (*http.Response, func(), error) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Second*time.Duration(s.conf.LinkCheck.TimeoutSeconds))
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", s.conf.UserAgent)
+
+	var crawlDelay time.Duration
+	if s.robots != nil {
+		crawlDelay = s.robots.crawlDelay(req.URL)
+	}
+	release, _, err := s.limiter.acquire(ctx, req.URL.Host, crawlDelay)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("failed to wait for rate limit: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		release()
+		cancel()
+		return nil, nil, err
+	}
+	return resp, func() {
+		resp.Body.Close()
+		release()
+		cancel()
+	}, nil
+}
+
+// linkFailure determines why a link request failed.
+func linkFailure(err error) ports.LinkFailure {
+	var (
+		dnsErr *net.DNSError
+		netErr net.Error
+	)
+	switch {
+	case errors.As(err, &dnsErr):
+		return ports.LinkDNSFailure
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ports.LinkTimeout
+	default:
+		return ports.LinkRequestFailed
+	}
+}
+
+// reference is a link referenced by an element of a page.
+type reference struct {
+	url     string
+	element ports.LinkElement
+	text    string
+}
+
+// parseReferences extracts the absolute http(s) URLs of the anchors, images,
+// scripts and links of an HTML document, without their fragments. Relative
+// URLs are resolved against base, which is the URL the document was fetched
+// from. The text of an anchor is its text content, or the alt text of an image
+// within it, and the text of an image is its alt text.
+func parseReferences(body []byte, base *url.URL) []reference {
+	var refs []reference
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	// anchor is the index of the anchor whose text is being collected, or -1
+	anchor := -1
+	anchorText := &strings.Builder{}
+	endAnchor := func() {
+		if anchor == -1 {
+			return
+		}
+		if text := strings.Join(strings.Fields(anchorText.String()), " "); text != "" {
+			refs[anchor].text = text
+		}
+		anchor = -1
+		anchorText.Reset()
+	}
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			// io.EOF, or the buffered body was truncated mid-token
+			endAnchor()
+			return refs
+
+		case html.TextToken:
+			if anchor != -1 {
+				anchorText.Write(tokenizer.Text())
+				anchorText.WriteByte(' ')
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if atom.Lookup(name) == atom.A {
+				endAnchor()
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			var (
+				element ports.LinkElement
+				href    string
+				text    string
+			)
+			switch token.DataAtom {
+			case atom.A:
+				// anchors can't be nested, so an unclosed anchor ends here
+				endAnchor()
+				element, href = ports.LinkElementA, attr(token, "href")
+			case atom.Img:
+				element, href = ports.LinkElementImg, attr(token, "src")
+				text = strings.TrimSpace(attr(token, "alt"))
+				if anchor != -1 && refs[anchor].text == "" {
+					refs[anchor].text = text
+				}
+			case atom.Script:
+				element, href = ports.LinkElementScript, attr(token, "src")
+			case atom.Link:
+				// resource hints reference origins rather than resources
+				if hasRel(token, "preconnect") || hasRel(token, "dns-prefetch") {
+					continue
+				}
+				element, href = ports.LinkElementLink, attr(token, "href")
+			default:
+				continue
+			}
+
+			ref, ok := resolve(base, href)
+			if !ok || (ref.Scheme != "http" && ref.Scheme != "https") {
+				continue
+			}
+			ref.Fragment, ref.RawFragment = "", ""
+			refs = append(refs, reference{url: ref.String(), element: element, text: text})
+			if element == ports.LinkElementA && tokenType == html.StartTagToken {
+				anchor = len(refs) - 1
+			}
+		}
+	}
+}
+
+// linkResult is the outcome of checking a link. failure is empty if the link
+// isn't broken.
+type linkResult struct {
+	failure    ports.LinkFailure
+	statusCode int
+	err        string
+}
+
+// linkCheck is the concurrency-safe state of a single link check.
+type linkCheck struct {
+	id       string
+	spec     ports.LinkCheckSpec
+	maxLinks int
+
+	mu *sync.Mutex
+	// pages are the fetched pages and their unique references, in the order
+	// they were fetched
+	pages      []checkedPage
+	pageErrors []ports.PageError
+	// results are keyed by link, and are nil until the link is checked
+	results   map[string]*linkResult
+	skipped   map[string]struct{}
+	total     int
+	status    ports.LinkCheckStatus
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// checkedPage is a page whose references are checked.
+type checkedPage struct {
+	url  string
+	refs []reference
+}
+
+func newLinkCheck(spec ports.LinkCheckSpec, pages []string, maxLinks int) *linkCheck {
+	now := time.Now().UTC()
+	return &linkCheck{
+		id:       store.NewID(),
+		spec:     spec,
+		maxLinks: maxLinks,
+
+		mu:        &sync.Mutex{},
+		results:   make(map[string]*linkResult),
+		skipped:   make(map[string]struct{}),
+		total:     len(pages),
+		status:    ports.LinkCheckRunning,
+		createdAt: now,
+		updatedAt: now,
+	}
+}
+
+// addPage records the references of a fetched page, returning the links which
+// haven't been seen before and should be checked, until the link check
+// reaches its max links.
+func (lc *linkCheck) addPage(page string, refs []reference) []string {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	var (
+		unique = make([]reference, 0, len(refs))
+		seen   = make(map[reference]struct{}, len(refs))
+		links  []string
+	)
+	for _, ref := range refs {
+		if _, ok := seen[ref]; ok {
+			continue
+		}
+		seen[ref] = struct{}{}
+		unique = append(unique, ref)
+
+		if _, ok := lc.results[ref.url]; ok {
+			continue
+		}
+		if _, ok := lc.skipped[ref.url]; ok {
+			continue
+		}
+		if len(lc.results) >= lc.maxLinks {
+			lc.skipped[ref.url] = struct{}{}
+			continue
+		}
+		lc.results[ref.url] = nil
+		links = append(links, ref.url)
+	}
+
+	lc.pages = append(lc.pages, checkedPage{url: page, refs: unique})
+	lc.updatedAt = time.Now().UTC()
+	return links
+}
+
+// pageFailed records that a page couldn't be fetched.
+func (lc *linkCheck) pageFailed(page string, err error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.pageErrors = append(lc.pageErrors, ports.PageError{Page: page, Error: err.Error()})
+	lc.updatedAt = time.Now().UTC()
+}
+
+// record records the result of checking a link.
+func (lc *linkCheck) record(link string, result linkResult) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.results[link] = &result
+	lc.updatedAt = time.Now().UTC()
+}
+
+// finish marks the link check as completed, or aborted if it was stopped
+// before every page and link was checked.
+func (lc *linkCheck) finish(aborted bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.status = ports.LinkCheckCompleted
+	if aborted {
+		lc.status = ports.LinkCheckAborted
+	}
+	lc.updatedAt = time.Now().UTC()
+}
+
+// snapshot returns a copy of the link check's current state.
+func (lc *linkCheck) snapshot() ports.LinkCheck {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	check := ports.LinkCheck{
+		ID:     lc.id,
+		Spec:   lc.spec,
+		Status: lc.status,
+		Progress: ports.LinkCheckProgress{
+			Pages:       lc.total,
+			FailedPages: len(lc.pageErrors),
+			Links:       len(lc.results) + len(lc.skipped),
+			Skipped:     len(lc.skipped),
+		},
+		Broken:     []ports.BrokenLink{},
+		PageErrors: append([]ports.PageError(nil), lc.pageErrors...),
+		CreatedAt:  lc.createdAt,
+		UpdatedAt:  lc.updatedAt,
+	}
+
+	for _, result := range lc.results {
+		if result == nil {
+			continue
+		}
+		check.Progress.Checked++
+		if result.failure != "" {
+			check.Progress.Broken++
+		}
+	}
+
+	for _, page := range lc.pages {
+		for _, ref := range page.refs {
+			result := lc.results[ref.url]
+			if result == nil || result.failure == "" {
+				continue
+			}
+			check.Broken = append(check.Broken, ports.BrokenLink{
+				Page:       page.url,
+				URL:        ref.url,
+				Element:    ref.element,
+				Text:       ref.text,
+				Failure:    result.failure,
+				StatusCode: result.statusCode,
+				Error:      result.err,
+			})
+		}
+	}
+	return check
+}
@@ -0,0 +1,218 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestParseReferences(t *testing.T) {
+	base, err := url.Parse("https://example.com/blog/post")
+	require.NoError(t, err)
+
+	body := `<html>
+<head>
+  <link rel="stylesheet" href="/style.css">
+  <link rel="preconnect" href="https://fonts.example.com">
+  <script src="app.js"></script>
+  <script>inline()</script>
+</head>
+<body>
+  <a href="/about#team">
+    About   <b>us</b>
+  </a>
+  <a href="https://other.com/"><img src="/logo.png" alt="Other"></a>
+  <img src="data:image/png;base64,AAAA" alt="Inline">
+  <a href="mailto:a@example.com">Mail</a>
+  <a href="../archive">Archive
+  <a href="/unterminated">Unterminated</a>
+</body>
+</html>`
+
+	expected := []reference{
+		{url: "https://example.com/style.css", element: ports.LinkElementLink},
+		{url: "https://example.com/blog/app.js", element: ports.LinkElementScript},
+		{url: "https://example.com/about", element: ports.LinkElementA, text: "About us"},
+		{url: "https://other.com/", element: ports.LinkElementA, text: "Other"},
+		{url: "https://example.com/logo.png", element: ports.LinkElementImg, text: "Other"},
+		{url: "https://example.com/archive", element: ports.LinkElementA, text: "Archive"},
+		{url: "https://example.com/unterminated", element: ports.LinkElementA, text: "Unterminated"},
+	}
+	require.Equal(t, expected, parseReferences([]byte(body), base))
+}
+
+func TestLinkFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ports.LinkFailure
+	}{
+		{
+			name:     "DNS failure",
+			err:      &url.Error{Op: "Head", Err: &net.DNSError{Err: "no such host", Name: "missing.invalid"}},
+			expected: ports.LinkDNSFailure,
+		},
+		{
+			name:     "deadline exceeded",
+			err:      &url.Error{Op: "Head", Err: context.DeadlineExceeded},
+			expected: ports.LinkTimeout,
+		},
+		{
+			name:     "network timeout",
+			err:      &net.OpError{Op: "dial", Err: &timeoutError{}},
+			expected: ports.LinkTimeout,
+		},
+		{
+			name:     "blocked destination",
+			err:      fmt.Errorf("%w: IP 127.0.0.1 is in a private range", ports.ErrBlockedDestination),
+			expected: ports.LinkRequestFailed,
+		},
+		{
+			name:     "connection refused",
+			err:      &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			expected: ports.LinkRequestFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, linkFailure(tt.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestProcessor_CheckLinks(t *testing.T) {
+	site := map[string]string{
+		"/": `<link rel="stylesheet" href="/missing.css"><script src="/app.js"></script>
+<a href="/a">A</a> <a href="/gone">Gone</a> <a href="/error">Error</a> <a href="/head-unsupported">GET only</a>
+<a href="http://missing.invalid/">Unresolvable</a> <img src="/missing.png" alt="Logo"> <a href="/gone">Gone again</a>`,
+		"/a":                `<a href="/">Home</a> <a href="/gone">Gone from A</a>`,
+		"/app.js":           ``,
+		"/head-unsupported": ``,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "/head-unsupported":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+		}
+		body, ok := site[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	u := func(path string) string {
+		return server.URL + path
+	}
+
+	seedBroken := []ports.BrokenLink{
+		{Page: u("/"), URL: u("/missing.css"), Element: ports.LinkElementLink, Failure: ports.LinkHTTPError, StatusCode: 404},
+		{Page: u("/"), URL: u("/gone"), Element: ports.LinkElementA, Text: "Gone", Failure: ports.LinkHTTPError, StatusCode: 404},
+		{Page: u("/"), URL: u("/error"), Element: ports.LinkElementA, Text: "Error", Failure: ports.LinkHTTPError, StatusCode: 500},
+		{Page: u("/"), URL: "http://missing.invalid/", Element: ports.LinkElementA, Text: "Unresolvable", Failure: ports.LinkDNSFailure},
+		{Page: u("/"), URL: u("/missing.png"), Element: ports.LinkElementImg, Text: "Logo", Failure: ports.LinkHTTPError, StatusCode: 404},
+		{Page: u("/"), URL: u("/gone"), Element: ports.LinkElementA, Text: "Gone again", Failure: ports.LinkHTTPError, StatusCode: 404},
+	}
+
+	awaitLinkCheck := func(t *testing.T, processor *Processor, check ports.LinkCheck) ports.LinkCheck {
+		require.Eventually(t, func() bool {
+			check, _ = processor.LinkCheckStatus(check.ID)
+			return check.Status == ports.LinkCheckCompleted
+		}, time.Second*5, 10*time.Millisecond)
+
+		// errors vary by resolver
+		for i := range check.Broken {
+			check.Broken[i].Error = ""
+		}
+		return check
+	}
+
+	t.Run("page", func(t *testing.T) {
+		processor, _, _ := newTestProcessor(t, newTestConfig(), server.Client())
+		defer processor.Close(context.Background())
+
+		check, err := processor.CheckLinks(ports.LinkCheckSpec{URL: u("")})
+		require.NoError(t, err)
+		require.Equal(t, u("/"), check.Spec.URL)
+		require.Equal(t, ports.LinkCheckRunning, check.Status)
+
+		check = awaitLinkCheck(t, processor, check)
+		require.Equal(t, ports.LinkCheckProgress{Pages: 1, Links: 8, Checked: 8, Broken: 5}, check.Progress)
+		require.Equal(t, seedBroken, check.Broken)
+		require.Empty(t, check.PageErrors)
+	})
+
+	t.Run("crawl", func(t *testing.T) {
+		conf := newTestConfig()
+		conf.LinkCheck.MaxLinks = 7
+		processor, _, _ := newTestProcessor(t, conf, server.Client())
+		defer processor.Close(context.Background())
+
+		crawl, err := processor.Crawl(context.Background(), u("/"), nil, ports.CrawlSpec{MaxDepth: depth(1)})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			crawl, _ = processor.CrawlStatus(crawl.ID)
+			return crawl.Status == ports.CrawlCompleted
+		}, time.Second*5, 10*time.Millisecond)
+
+		check, err := processor.CheckLinks(ports.LinkCheckSpec{CrawlID: crawl.ID})
+		require.NoError(t, err)
+
+		// only the stored pages of the crawl are checked, and links beyond the
+		// seed page's seventh aren't checked as they exceed the max links
+		check = awaitLinkCheck(t, processor, check)
+		require.Equal(t, ports.LinkCheckProgress{Pages: 3, Links: 9, Checked: 7, Broken: 4, Skipped: 2}, check.Progress)
+
+		expected := append(seedBroken[:4:4], seedBroken[5], ports.BrokenLink{
+			Page: u("/a"), URL: u("/gone"), Element: ports.LinkElementA, Text: "Gone from A",
+			Failure: ports.LinkHTTPError, StatusCode: 404,
+		})
+		require.Equal(t, expected, check.Broken)
+		require.Empty(t, check.PageErrors)
+	})
+}
+
+func TestProcessor_CheckLinks_Invalid(t *testing.T) {
+	processor, _, _ := newTestProcessor(t, newTestConfig(), http.DefaultClient)
+
+	_, err := processor.CheckLinks(ports.LinkCheckSpec{})
+	require.ErrorIs(t, err, ports.ErrInvalidSpec)
+	_, err = processor.CheckLinks(ports.LinkCheckSpec{URL: "https://example.com", CrawlID: "crawl"})
+	require.ErrorIs(t, err, ports.ErrInvalidSpec)
+	_, err = processor.CheckLinks(ports.LinkCheckSpec{URL: "ftp://example.com"})
+	require.ErrorIs(t, err, ports.ErrInvalidURL)
+	_, err = processor.CheckLinks(ports.LinkCheckSpec{CrawlID: "unknown"})
+	require.ErrorIs(t, err, ports.ErrCrawlNotFound)
+
+	_, ok := processor.LinkCheckStatus("unknown")
+	require.False(t, ok)
+
+	require.NoError(t, processor.Close(context.Background()))
+	_, err = processor.CheckLinks(ports.LinkCheckSpec{URL: "https://example.com"})
+	require.ErrorIs(t, err, ports.ErrClosed)
+}
@@ -0,0 +1,157 @@
+package ingest
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// isHTML determines whether a response's Content-Type is HTML.
+func isHTML(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// parseMetadata extracts metadata and the absolute URLs of http(s) links from an
+// HTML document. Relative links are resolved against base, which is the URL the
+// document was fetched from.
+func parseMetadata(body []byte, base *url.URL) (ports.Metadata, []string) {
+	var (
+		metadata ports.Metadata
+		links    []string
+	)
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	inTitle := false
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			// io.EOF, or the buffered body was truncated mid-token
+			return metadata, links
+
+		case html.TextToken:
+			if inTitle && metadata.Title == "" {
+				metadata.Title = strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if atom.Lookup(name) == atom.Title {
+				inTitle = false
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Html:
+				if metadata.Language == "" {
+					metadata.Language = attr(token, "lang")
+				}
+			case atom.Title:
+				inTitle = tokenType == html.StartTagToken
+			case atom.Meta:
+				parseMeta(&metadata, token)
+			case atom.Link:
+				if metadata.Canonical == "" && hasRel(token, "canonical") {
+					if ref, ok := resolve(base, attr(token, "href")); ok {
+						metadata.Canonical = ref.String()
+					}
+				}
+			case atom.A:
+				ref, ok := resolve(base, attr(token, "href"))
+				if !ok || (ref.Scheme != "http" && ref.Scheme != "https") {
+					continue
+				}
+				links = append(links, ref.String())
+				if !strings.EqualFold(ref.Host, base.Host) {
+					metadata.OutboundLinks++
+				}
+			}
+		}
+	}
+}
+
+// parseMeta extracts the description, Open Graph and Twitter card properties
+// from a meta tag into metadata. The first occurrence of each property wins.
+func parseMeta(metadata *ports.Metadata, token html.Token) {
+	content := strings.TrimSpace(attr(token, "content"))
+	if content == "" {
+		return
+	}
+
+	// Open Graph uses the property attribute, whereas Twitter cards use name
+	// but property is commonly seen too
+	for _, key := range []string{attr(token, "property"), attr(token, "name")} {
+		key = strings.ToLower(strings.TrimSpace(key))
+		switch {
+		case key == "description":
+			if metadata.Description == "" {
+				metadata.Description = content
+			}
+		case strings.HasPrefix(key, "og:"):
+			setProperty(&metadata.OpenGraph, strings.TrimPrefix(key, "og:"), content)
+		case strings.HasPrefix(key, "twitter:"):
+			setProperty(&metadata.Twitter, strings.TrimPrefix(key, "twitter:"), content)
+		}
+	}
+}
+
+// setProperty sets key to value in properties, initialising it if nil, unless
+// key is already set.
+func setProperty(properties *map[string]string, key, value string) {
+	if key == "" {
+		return
+	}
+	if *properties == nil {
+		*properties = make(map[string]string)
+	}
+	if _, ok := (*properties)[key]; !ok {
+		(*properties)[key] = value
+	}
+}
+
+// attr returns the value of a token's attribute, or an empty string if it
+// isn't set.
+func attr(token html.Token, key string) string {
+	for _, a := range token.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasRel determines whether a link token's space-separated rel attribute
+// contains rel.
+func hasRel(token html.Token, rel string) bool {
+	for _, r := range strings.Fields(attr(token, "rel")) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve resolves a link href against base.
+func resolve(base *url.URL, href string) (*url.URL, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return nil, false
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, false
+	}
+	return base.ResolveReference(ref), true
+}
@@ -0,0 +1,115 @@
+package ingest
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected ports.Metadata
+		// expectedLinks are the absolute http(s) links in document order
+		expectedLinks []string
+	}{
+		{
+			name: "full",
+			body: `<!DOCTYPE html>
+<html lang="en-GB">
+<head>
+  <title>
+    Example   Page
+  </title>
+  <meta name="description" content=" An example page. ">
+  <meta property="og:title" content="Example">
+  <meta property="og:image" content="https://example.com/image.png">
+  <meta name="twitter:card" content="summary">
+  <meta property="twitter:site" content="@example">
+  <link rel="alternate canonical" href="/page">
+</head>
+<body>
+  <a href="/about">About</a>
+  <a href="https://example.com/contact">Contact</a>
+  <a href="https://other.example.com/">Other</a>
+  <a href="//another.com/path">Another</a>
+  <a href="mailto:hello@example.com">Email</a>
+  <a href="#top">Top</a>
+  <svg><title>Icon</title></svg>
+</body>
+</html>`,
+			expected: ports.Metadata{
+				Title:         "Example Page",
+				Description:   "An example page.",
+				Canonical:     "https://example.com/page",
+				Language:      "en-GB",
+				OpenGraph:     map[string]string{"title": "Example", "image": "https://example.com/image.png"},
+				Twitter:       map[string]string{"card": "summary", "site": "@example"},
+				OutboundLinks: 2,
+			},
+			expectedLinks: []string{
+				"https://example.com/about",
+				"https://example.com/contact",
+				"https://other.example.com/",
+				"https://another.com/path",
+				"https://example.com/dir/index.html#top",
+			},
+		},
+		{
+			name: "first occurrence wins",
+			body: `<title>First</title><title>Second</title>
+<meta property="og:title" content="First"><meta property="og:title" content="Second">
+<link rel="canonical" href="https://example.com/first"><link rel="canonical" href="https://example.com/second">`,
+			expected: ports.Metadata{
+				Title:     "First",
+				Canonical: "https://example.com/first",
+				OpenGraph: map[string]string{"title": "First"},
+			},
+		},
+		{
+			name:     "empty",
+			body:     "",
+			expected: ports.Metadata{},
+		},
+		{
+			name: "truncated",
+			body: `<html lang="fr"><title>Tronqué</title><a href="https://other.com/">x</a><a hr`,
+			expected: ports.Metadata{
+				Title:         "Tronqué",
+				Language:      "fr",
+				OutboundLinks: 1,
+			},
+			expectedLinks: []string{"https://other.com/"},
+		},
+	}
+
+	base, err := url.Parse("https://example.com/dir/index.html")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, links := parseMetadata([]byte(tt.body), base)
+			require.Equal(t, tt.expected, metadata)
+			require.Equal(t, tt.expectedLinks, links)
+		})
+	}
+}
+
+func TestIsHTML(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"text/html":                 true,
+		"text/html; charset=utf-8":  true,
+		"application/xhtml+xml":     true,
+		"application/json":          false,
+		"text/plain; charset=utf-8": false,
+		"":                          false,
+	} {
+		header := http.Header{"Content-Type": []string{contentType}}
+		require.Equal(t, expected, isHTML(header), contentType)
+	}
+}
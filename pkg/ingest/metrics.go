@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"net/url"
+
+	"jemgunay/url-scraper/pkg/metrics"
+)
+
+// Ingest results, i.e. the outcome of enqueuing a URL.
+const (
+	ingestAccepted = "accepted"
+	ingestRejected = "rejected"
+	ingestTimedOut = "timed_out"
+)
+
+// Validation results, i.e. the outcome of processing an enqueued URL.
+const (
+	validationStored    = "stored"
+	validationDiscarded = "discarded"
+)
+
+// processorMetrics are the operational metrics of a Processor.
+type processorMetrics struct {
+	ingests            *metrics.CounterVec
+	validations        *metrics.CounterVec
+	benchmarkDurations *metrics.HistogramVec
+	rateLimitWaits     *metrics.HistogramVec
+	contentChanges     *metrics.CounterVec
+}
+
+// newProcessorMetrics registers the Processor metrics. queueSize returns the
+// current length and capacity of the insertion queue, and scheduled returns
+// the number of URLs scheduled for refresh.
+func newProcessorMetrics(registry *metrics.Registry, queueSize func() (length, capacity int), scheduled func() int) processorMetrics {
+	registry.NewGaugeFunc("scraper_ingest_queue_depth", "Number of URLs waiting in the insertion queue.", func() float64 {
+		length, _ := queueSize()
+		return float64(length)
+	})
+	registry.NewGaugeFunc("scraper_ingest_queue_capacity", "Capacity of the insertion queue.", func() float64 {
+		_, capacity := queueSize()
+		return float64(capacity)
+	})
+	registry.NewGaugeFunc("scraper_scheduled_urls", "Number of URLs scheduled for benchmark refreshes.", func() float64 {
+		return float64(scheduled())
+	})
+
+	return processorMetrics{
+		ingests: registry.NewCounter("scraper_ingests_total",
+			"Total URLs submitted for ingestion by result (accepted, rejected, timed_out).", "result"),
+		validations: registry.NewCounter("scraper_ingest_validations_total",
+			"Total ingested URLs validated by result (stored, discarded).", "result"),
+		benchmarkDurations: registry.NewHistogram("scraper_benchmark_duration_seconds",
+			"Duration of URL benchmark requests in seconds.", metrics.DefaultBuckets, "host", "status"),
+		rateLimitWaits: registry.NewHistogram("scraper_rate_limit_wait_seconds",
+			"Time spent waiting for per-host rate limits before a request in seconds.", metrics.DefaultBuckets, "host"),
+		contentChanges: registry.NewCounter("scraper_content_changes_total",
+			"Total detected changes of stored URL content.", "host"),
+	}
+}
+
+// hostOf returns the host of rawURL, or an empty string if it can't be parsed.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,102 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// defaultMaxRedirects is the maximum number of redirects followed by requests
+// which aren't benchmarks, e.g. robots.txt fetches, matching the http.Client
+// default.
+const defaultMaxRedirects = 10
+
+// errRedirectPolicy is returned (wrapped) when a redirect is prohibited by the
+// redirect policy.
+var errRedirectPolicy = errors.New("redirect prohibited by policy")
+
+type followRedirectsKey struct{}
+
+type redirectChainKey struct{}
+
+// redirectChain records the redirects followed by a benchmark request and
+// enforces the redirect policy on them. A request's redirects are followed
+// sequentially, so it isn't synchronised.
+type redirectChain struct {
+	policy config.Redirects
+	hops   []ports.RedirectHop
+	// hopStart is when the current hop's request started
+	hopStart time.Time
+	// trace is reset on each redirect so that it only times the final hop
+	trace *requestTrace
+}
+
+func newRedirectChain(policy config.Redirects, trace *requestTrace) *redirectChain {
+	return &redirectChain{
+		policy: policy,
+		trace:  trace,
+	}
+}
+
+// start marks the start of the initial request.
+func (c *redirectChain) start(now time.Time) {
+	c.hopStart = now
+}
+
+// follow records the redirect to req and determines whether it may be
+// followed. via are the requests made so far, oldest first.
+func (c *redirectChain) follow(req *http.Request, via []*http.Request) error {
+	now := time.Now().UTC()
+	prev := via[len(via)-1]
+	hop := ports.RedirectHop{
+		URL:      prev.URL.String(),
+		Location: req.URL.String(),
+		Duration: now.Sub(c.hopStart),
+	}
+	if req.Response != nil {
+		hop.StatusCode = req.Response.StatusCode
+	}
+	c.hops = append(c.hops, hop)
+	c.hopStart = now
+	c.trace.reset()
+
+	if len(via) > c.policy.MaxRedirects {
+		return fmt.Errorf("%w: stopped after %d redirects", errRedirectPolicy, c.policy.MaxRedirects)
+	}
+	if !c.policy.AllowHTTPSDowngrade && prev.URL.Scheme == "https" && req.URL.Scheme == "http" {
+		return fmt.Errorf("%w: redirect from https to http", errRedirectPolicy)
+	}
+	if !c.policy.AllowCrossDomain && !sameDomain(via[0].URL.Hostname(), req.URL.Hostname()) {
+		return fmt.Errorf("%w: cross-domain redirect to %s", errRedirectPolicy, req.URL.Hostname())
+	}
+	return nil
+}
+
+// CheckRedirect is an http.Client CheckRedirect func which honours the
+// FollowRedirects setting of the URLSpec a request was made for, and records
+// and enforces the redirect policy on the redirects of benchmark requests. If
+// redirects aren't followed, the redirect response itself is benchmarked.
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if follow, ok := req.Context().Value(followRedirectsKey{}).(bool); ok && !follow {
+		return http.ErrUseLastResponse
+	}
+	if chain, ok := req.Context().Value(redirectChainKey{}).(*redirectChain); ok {
+		return chain.follow(req, via)
+	}
+	if len(via) >= defaultMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", defaultMaxRedirects)
+	}
+	return nil
+}
+
+// sameDomain determines whether hosts a and b are the same, or if either is a
+// subdomain of the other.
+func sameDomain(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
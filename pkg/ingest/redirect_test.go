@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestProcessor_BenchmarkRequest_Redirects(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			time.Sleep(10 * time.Millisecond)
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/downgrade":
+			http.Redirect(w, r, plain.URL, http.StatusFound)
+		case "/cross-domain":
+			http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/final", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	client := server.Client()
+	client.CheckRedirect = CheckRedirect
+
+	defaultPolicy := config.Redirects{MaxRedirects: 10, AllowCrossDomain: true}
+
+	tests := []struct {
+		name              string
+		path              string
+		policy            config.Redirects
+		expectedStatus    scrapeStatus
+		expectedLocations []string
+		expectedError     string
+	}{
+		{
+			name:              "chain recorded",
+			path:              "/a",
+			policy:            defaultPolicy,
+			expectedStatus:    success,
+			expectedLocations: []string{"/b", "/final"},
+		},
+		{
+			name:              "max redirects exceeded",
+			path:              "/a",
+			policy:            config.Redirects{MaxRedirects: 1, AllowCrossDomain: true},
+			expectedStatus:    failure,
+			expectedLocations: []string{"/b", "/final"},
+			expectedError:     "stopped after 1 redirects",
+		},
+		{
+			name:              "https downgrade",
+			path:              "/downgrade",
+			policy:            defaultPolicy,
+			expectedStatus:    failure,
+			expectedLocations: []string{plain.URL},
+			expectedError:     "redirect from https to http",
+		},
+		{
+			name:              "https downgrade allowed",
+			path:              "/downgrade",
+			policy:            config.Redirects{MaxRedirects: 10, AllowCrossDomain: true, AllowHTTPSDowngrade: true},
+			expectedStatus:    success,
+			expectedLocations: []string{plain.URL},
+		},
+		{
+			name:              "cross-domain",
+			path:              "/cross-domain",
+			policy:            config.Redirects{MaxRedirects: 10},
+			expectedStatus:    failure,
+			expectedLocations: []string{"localhost"},
+			expectedError:     "cross-domain redirect to localhost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := newTestConfig()
+			conf.Redirects = tt.policy
+			processor, _, _ := newTestProcessor(t, conf, client)
+			defer processor.Close(context.Background())
+
+			result, err := processor.benchmarkRequest(server.URL+tt.path, nil, nil)
+			require.Equal(t, tt.expectedStatus, result.Status, err)
+			if tt.expectedError != "" {
+				require.ErrorIs(t, err, errRedirectPolicy)
+				require.ErrorContains(t, err, tt.expectedError)
+				// policy violations aren't retried
+				require.Equal(t, 1, result.Attempts)
+			}
+
+			require.Len(t, result.Redirects, len(tt.expectedLocations))
+			for i, hop := range result.Redirects {
+				require.Contains(t, hop.Location, tt.expectedLocations[i])
+				require.Positive(t, hop.Duration)
+			}
+			if tt.expectedStatus == success {
+				require.Equal(t, result.Redirects[len(result.Redirects)-1].Location, result.FinalURL)
+			}
+		})
+	}
+
+	t.Run("hops", func(t *testing.T) {
+		processor, _, _ := newTestProcessor(t, newTestConfig(), client)
+		defer processor.Close(context.Background())
+
+		result, err := processor.benchmarkRequest(server.URL+"/a", nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, server.URL+"/final", result.FinalURL)
+		require.Equal(t, server.URL+"/a", result.Redirects[0].URL)
+		require.Equal(t, http.StatusMovedPermanently, result.Redirects[0].StatusCode)
+		require.Equal(t, server.URL+"/b", result.Redirects[1].URL)
+		require.Equal(t, http.StatusFound, result.Redirects[1].StatusCode)
+		require.GreaterOrEqual(t, result.Redirects[1].Duration, 10*time.Millisecond)
+		// connection phases were timed by the first hop, so the final hop
+		// reuses the connection
+		require.Zero(t, result.timings.Connect)
+	})
+}
+
+func TestProcessor_Ingest_StoreResolvedURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new?utm_source=redirect", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	client := server.Client()
+	client.CheckRedirect = CheckRedirect
+
+	conf := newTestConfig()
+	conf.Redirects.StoreResolvedURL = true
+	conf.TrackingParams = []string{"utm_*"}
+	processor, storage, _ := newTestProcessor(t, conf, client)
+
+	_, err := processor.Ingest(context.Background(), server.URL+"/old", nil)
+	require.NoError(t, err)
+	require.NoError(t, processor.Close(context.Background()))
+
+	records := storage.Fetch(10, ports.Age, ports.Descending)
+	require.Len(t, records, 1)
+	require.Equal(t, server.URL+"/new", records[0].Key)
+
+	// the validating benchmark is recorded under the stored URL
+	require.Len(t, processor.benchmarks.Query(server.URL+"/new", time.Time{}, time.Time{}, 10), 1)
+	require.Empty(t, processor.benchmarks.Query(server.URL+"/old", time.Time{}, time.Time{}, 10))
+}
+
+func TestSameDomain(t *testing.T) {
+	require.True(t, sameDomain("example.com", "EXAMPLE.com"))
+	require.True(t, sameDomain("example.com", "www.example.com"))
+	require.True(t, sameDomain("api.example.com", "example.com"))
+	require.False(t, sameDomain("api.example.com", "www.example.com"))
+	require.False(t, sameDomain("example.com", "badexample.com"))
+}
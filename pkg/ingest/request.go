@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// supportedMethods are the request methods a URLSpec may specify.
+var supportedMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodOptions: {},
+}
+
+// validateRequestSpec validates the request configuration of spec.
+func validateRequestSpec(spec *ports.URLSpec) error {
+	if spec.Method != "" {
+		if _, ok := supportedMethods[strings.ToUpper(spec.Method)]; !ok {
+			return fmt.Errorf("unsupported method %q", spec.Method)
+		}
+	}
+	for name, value := range spec.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for header %s", name)
+		}
+	}
+	if spec.TimeoutMillis < 0 {
+		return errors.New("invalid timeout")
+	}
+	return nil
+}
+
+// newRequest creates a request to url as configured by spec, which may be
+// nil. The spec's timeout isn't applied so that it doesn't include time spent
+// waiting to send the request; see withTimeout.
+func newRequest(ctx context.Context, url string, spec *ports.URLSpec) (*http.Request, error) {
+	if spec == nil {
+		spec = &ports.URLSpec{}
+	}
+
+	if spec.FollowRedirects != nil {
+		ctx = context.WithValue(ctx, followRedirectsKey{}, *spec.FollowRedirects)
+	}
+
+	method := http.MethodGet
+	if spec.Method != "" {
+		method = strings.ToUpper(spec.Method)
+	}
+	var body io.Reader
+	if spec.Body != "" {
+		body = strings.NewReader(spec.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range spec.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// withTimeout applies the timeout of spec, which may be nil, to req. The
+// returned cancel func must be called once the request completes.
+func withTimeout(req *http.Request, spec *ports.URLSpec) (*http.Request, context.CancelFunc) {
+	if spec == nil || spec.TimeoutMillis <= 0 {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), time.Millisecond*time.Duration(spec.TimeoutMillis))
+	return req.WithContext(ctx), cancel
+}
+
+// setConditionalHeaders makes req conditional on the cache validators of
+// cached via the If-None-Match and If-Modified-Since headers, unless either is
+// already set by the URL's spec. Only GET and HEAD requests are made
+// conditional. It returns whether req was made conditional.
+func setConditionalHeaders(req *http.Request, cached ports.Content) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	return cached.ETag != "" || cached.LastModified != ""
+}
+
+// validators returns the cache validators of a Not Modified response, which
+// fall back to those of cached if the response omits them.
+func validators(header http.Header, cached ports.Content) (etag, lastModified string) {
+	etag, lastModified = header.Get("ETag"), header.Get("Last-Modified")
+	if etag == "" {
+		etag = cached.ETag
+	}
+	if lastModified == "" {
+		lastModified = cached.LastModified
+	}
+	return etag, lastModified
+}
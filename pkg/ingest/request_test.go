@@ -0,0 +1,180 @@
+package ingest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestProcessor_BenchmarkRequest_Spec(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/echo", http.StatusFound)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("X-Method", r.Method)
+			w.Header().Set("X-Token", r.Header.Get("X-Token"))
+			w.Header().Set("X-User-Agent", r.UserAgent())
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	client := server.Client()
+	client.CheckRedirect = CheckRedirect
+
+	follow, noFollow := true, false
+
+	tests := []struct {
+		name           string
+		path           string
+		spec           *ports.URLSpec
+		expectedStatus scrapeStatus
+		expectedCode   int
+	}{
+		{
+			name: "method, headers and body",
+			path: "/echo",
+			spec: &ports.URLSpec{
+				Method:  "post",
+				Headers: map[string]string{"X-Token": "secret", "User-Agent": "custom/1.0"},
+				Body:    `{"hello":"world"}`,
+				Assertions: &ports.Assertions{
+					Headers:      map[string]string{"X-Method": "POST", "X-Token": "secret", "X-User-Agent": "custom/1.0"},
+					BodyContains: `{"hello":"world"}`,
+				},
+			},
+			expectedStatus: success,
+			expectedCode:   http.StatusOK,
+		},
+		{
+			name:           "redirects followed by default",
+			path:           "/redirect",
+			spec:           &ports.URLSpec{FollowRedirects: &follow},
+			expectedStatus: success,
+			expectedCode:   http.StatusOK,
+		},
+		{
+			name: "redirects not followed",
+			path: "/redirect",
+			spec: &ports.URLSpec{
+				FollowRedirects: &noFollow,
+				Assertions:      &ports.Assertions{StatusCodes: []string{"3xx"}},
+			},
+			expectedStatus: success,
+			expectedCode:   http.StatusFound,
+		},
+		{
+			name:           "timeout",
+			path:           "/slow",
+			spec:           &ports.URLSpec{TimeoutMillis: 20},
+			expectedStatus: failure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := newTestConfig()
+			conf.Retry.MaxAttempts = 1
+			processor, _, _ := newTestProcessor(t, conf, client)
+			defer processor.Close(context.Background())
+
+			result, err := processor.benchmarkRequest(server.URL+tt.path, tt.spec, nil)
+			require.Equal(t, tt.expectedStatus, result.Status, err)
+			require.Equal(t, tt.expectedCode, result.StatusCode)
+			if tt.expectedStatus == failure {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_Request(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *ports.URLSpec
+		invalid bool
+	}{
+		{name: "nil spec", spec: nil},
+		{name: "valid", spec: &ports.URLSpec{Method: "head", Headers: map[string]string{"Accept": "text/html"}, TimeoutMillis: 500}},
+		{name: "unsupported method", spec: &ports.URLSpec{Method: "TRACE"}, invalid: true},
+		{name: "invalid header name", spec: &ports.URLSpec{Headers: map[string]string{"Bad Header": "x"}}, invalid: true},
+		{name: "invalid header value", spec: &ports.URLSpec{Headers: map[string]string{"X-Inject": "a\r\nb: c"}}, invalid: true},
+		{name: "negative timeout", spec: &ports.URLSpec{TimeoutMillis: -1}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSpec(tt.spec)
+			if tt.invalid {
+				require.ErrorIs(t, err, ports.ErrInvalidSpec)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSetConditionalHeaders(t *testing.T) {
+	cached := ports.Content{ETag: `"v1"`, LastModified: "Wed, 05 Apr 2023 17:00:00 GMT"}
+
+	tests := []struct {
+		name                    string
+		spec                    *ports.URLSpec
+		cached                  ports.Content
+		expectedConditional     bool
+		expectedIfNoneMatch     string
+		expectedIfModifiedSince string
+	}{
+		{
+			name:                    "both validators",
+			cached:                  cached,
+			expectedConditional:     true,
+			expectedIfNoneMatch:     `"v1"`,
+			expectedIfModifiedSince: "Wed, 05 Apr 2023 17:00:00 GMT",
+		},
+		{
+			name:                "etag only",
+			spec:                &ports.URLSpec{Method: "HEAD"},
+			cached:              ports.Content{ETag: `"v1"`},
+			expectedConditional: true,
+			expectedIfNoneMatch: `"v1"`,
+		},
+		{
+			name:   "no validators",
+			cached: ports.Content{Hash: "hash"},
+		},
+		{
+			name:   "unsafe method",
+			spec:   &ports.URLSpec{Method: "POST"},
+			cached: cached,
+		},
+		{
+			name:                "spec overrides",
+			spec:                &ports.URLSpec{Headers: map[string]string{"If-None-Match": `"v0"`}},
+			cached:              cached,
+			expectedIfNoneMatch: `"v0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := newRequest(context.Background(), "https://example.com/", tt.spec)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.expectedConditional, setConditionalHeaders(req, tt.cached))
+			require.Equal(t, tt.expectedIfNoneMatch, req.Header.Get("If-None-Match"))
+			require.Equal(t, tt.expectedIfModifiedSince, req.Header.Get("If-Modified-Since"))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// retryPolicy determines whether and when a failed request attempt should be
+// retried.
+type retryPolicy struct {
+	maxAttempts          int
+	baseBackoff          time.Duration
+	maxBackoff           time.Duration
+	jitter               float64
+	retryableStatusCodes map[int]struct{}
+
+	// rand is not concurrency safe so is guarded by randMu
+	randMu *sync.Mutex
+	rand   *rand.Rand
+}
+
+func newRetryPolicy(conf config.Retry) retryPolicy {
+	codes := make(map[int]struct{}, len(conf.RetryableStatusCodes))
+	for _, code := range conf.RetryableStatusCodes {
+		codes[code] = struct{}{}
+	}
+
+	return retryPolicy{
+		maxAttempts:          conf.MaxAttempts,
+		baseBackoff:          time.Millisecond * time.Duration(conf.BaseBackoffMillis),
+		maxBackoff:           time.Millisecond * time.Duration(conf.MaxBackoffMillis),
+		jitter:               conf.Jitter,
+		retryableStatusCodes: codes,
+
+		randMu: &sync.Mutex{},
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// statusError is returned when a request attempt receives an unexpected HTTP
+// response status.
+type statusError struct {
+	status     string
+	statusCode int
+	// retryAfter is the parsed Retry-After response header, if any
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP response status: %s", e.status)
+}
+
+// backoff returns how long to wait before the next attempt given the failed
+// attempt number (starting at 1) and its error. If the attempt shouldn't be
+// retried, false is returned.
+func (p retryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.maxAttempts || !p.retryable(err) {
+		return 0, false
+	}
+
+	// exponential backoff, capped at maxBackoff
+	wait := p.baseBackoff << (attempt - 1)
+	if wait > p.maxBackoff || wait <= 0 {
+		wait = p.maxBackoff
+	}
+
+	// randomly shave up to jitter (as a fraction) off the backoff so that
+	// concurrent retries against the same host are spread out
+	p.randMu.Lock()
+	wait -= time.Duration(p.jitter * p.rand.Float64() * float64(wait))
+	p.randMu.Unlock()
+
+	// honour Retry-After if the server told us to back off for longer; if we
+	// aren't willing to wait that long, give up
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.retryAfter > wait {
+		if statusErr.retryAfter > p.maxBackoff {
+			return 0, false
+		}
+		wait = statusErr.retryAfter
+	}
+
+	return wait, true
+}
+
+// retryable determines whether a failed attempt is worth retrying. Unexpected
+// statuses are retryable if configured as such, and transport errors (e.g.
+// connection resets or timeouts) are always retryable, unless the request was
+// cancelled or its destination is blocked. Failed assertions other than the
+// status code are not retryable.
+func (p retryPolicy) retryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		_, ok := p.retryableStatusCodes[statusErr.statusCode]
+		return ok
+	}
+	// the response was received, so retrying won't change the outcome
+	var assertionErr *assertionError
+	if errors.As(err, &assertionErr) {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, ports.ErrBlockedDestination) &&
+		!errors.Is(err, errRedirectPolicy)
+}
+
+// parseRetryAfter parses a Retry-After header value, which is either a number
+// of seconds or an HTTP date. Zero is returned if it is absent or invalid.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Second * time.Duration(seconds)
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := newRetryPolicy(config.Retry{
+		MaxAttempts:          4,
+		BaseBackoffMillis:    100,
+		MaxBackoffMillis:     300,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	})
+
+	tests := []struct {
+		name          string
+		attempt       int
+		err           error
+		expectedWait  time.Duration
+		expectedRetry bool
+	}{
+		{"transport error", 1, errors.New("connection reset"), 100 * time.Millisecond, true},
+		{"exponential backoff", 2, &statusError{statusCode: http.StatusServiceUnavailable}, 200 * time.Millisecond, true},
+		{"capped backoff", 3, &statusError{statusCode: http.StatusServiceUnavailable}, 300 * time.Millisecond, true},
+		{"max attempts reached", 4, &statusError{statusCode: http.StatusServiceUnavailable}, 0, false},
+		{"blocked destination", 1, fmt.Errorf("dial failed: %w", ports.ErrBlockedDestination), 0, false},
+		{"non-retryable status", 1, &statusError{statusCode: http.StatusNotFound}, 0, false},
+		{"retry after honoured", 1, &statusError{statusCode: http.StatusServiceUnavailable, retryAfter: 250 * time.Millisecond}, 250 * time.Millisecond, true},
+		{"retry after too long", 1, &statusError{statusCode: http.StatusServiceUnavailable, retryAfter: time.Second}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := policy.backoff(tt.attempt, tt.err)
+			require.Equal(t, tt.expectedRetry, ok)
+			require.Equal(t, tt.expectedWait, wait)
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{"absent", "", 0},
+		{"seconds", "30", 30 * time.Second},
+		{"http date", now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{"past http date", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"invalid", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			require.Equal(t, tt.expected, parseRetryAfter(header, now))
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// robotsMaxSize is the maximum robots.txt size which is parsed; any remainder
+// is ignored.
+const robotsMaxSize = 500 << 10
+
+// errDisallowedByRobots is returned when a URL is disallowed by its host's
+// robots.txt.
+var errDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// robotsChecker fetches, parses and caches the robots.txt of each host in
+// order to determine whether URLs may be fetched by userAgent.
+type robotsChecker struct {
+	httpClient ports.Client
+	userAgent  string
+	ttl        time.Duration
+
+	mu    *sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+// robotsEntry is a cached robots.txt. ready is closed once it has been
+// fetched, so that concurrent checks against the same host share a single
+// fetch.
+type robotsEntry struct {
+	ready   chan struct{}
+	rules   robotsRules
+	err     error
+	expires time.Time
+}
+
+func newRobotsChecker(httpClient ports.Client, userAgent string, ttl time.Duration) *robotsChecker {
+	return &robotsChecker{
+		httpClient: httpClient,
+		userAgent:  userAgent,
+		ttl:        ttl,
+		mu:         &sync.Mutex{},
+		hosts:      make(map[string]*robotsEntry),
+	}
+}
+
+// check returns errDisallowedByRobots if u may not be fetched, or an error if
+// the host's robots.txt could not be fetched.
+func (c *robotsChecker) check(ctx context.Context, u *url.URL) error {
+	rules, err := c.rules(ctx, u)
+	if err != nil {
+		return err
+	}
+	if !rules.allowed(robotsPath(u)) {
+		return fmt.Errorf("%w for user agent %s", errDisallowedByRobots, c.userAgent)
+	}
+	return nil
+}
+
+// crawlDelay returns the cached Crawl-delay of u's host, or zero if its
+// robots.txt hasn't been fetched yet.
+func (c *robotsChecker) crawlDelay(u *url.URL) time.Duration {
+	c.mu.Lock()
+	entry, ok := c.hosts[robotsKey(u)]
+	c.mu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	select {
+	case <-entry.ready:
+		return entry.rules.crawlDelay
+	default:
+		return 0
+	}
+}
+
+// rules returns the cached rules of u's host, fetching them if they are
+// absent or expired.
+func (c *robotsChecker) rules(ctx context.Context, u *url.URL) (robotsRules, error) {
+	key := robotsKey(u)
+
+	c.mu.Lock()
+	entry, ok := c.hosts[key]
+	if ok {
+		select {
+		case <-entry.ready:
+			if time.Now().After(entry.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		entry = &robotsEntry{ready: make(chan struct{})}
+		c.hosts[key] = entry
+		go c.fetch(ctx, key, entry)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.rules, entry.err
+	case <-ctx.Done():
+		return robotsRules{}, ctx.Err()
+	}
+}
+
+// fetch fetches and parses the robots.txt at key into entry. Failed fetches
+// are not cached so that they are retried by the next check.
+func (c *robotsChecker) fetch(ctx context.Context, key string, entry *robotsEntry) {
+	defer close(entry.ready)
+
+	entry.rules, entry.err = c.fetchRules(ctx, key+"/robots.txt")
+	entry.expires = time.Now().Add(c.ttl)
+
+	if entry.err != nil {
+		c.mu.Lock()
+		if c.hosts[key] == entry {
+			delete(c.hosts, key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *robotsChecker) fetchRules(ctx context.Context, robotsURL string) (robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return robotsRules{}, fmt.Errorf("failed to create robots.txt request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return robotsRules{}, fmt.Errorf("failed to fetch robots.txt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(io.LimitReader(resp.Body, robotsMaxSize), c.userAgent), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		// an unavailable robots.txt means there are no restrictions
+		io.Copy(io.Discard, resp.Body)
+		return robotsRules{}, nil
+	default:
+		// an unreachable robots.txt must be treated as a complete disallow,
+		// so surface it rather than assuming we're allowed
+		io.Copy(io.Discard, resp.Body)
+		return robotsRules{}, fmt.Errorf("failed to fetch robots.txt: unexpected HTTP response status: %s", resp.Status)
+	}
+}
+
+// robotsKey returns the origin of u, as robots.txt applies per scheme and
+// host.
+func robotsKey(u *url.URL) string {
+	return u.Scheme + "://" + strings.ToLower(u.Host)
+}
+
+// robotsPath returns the path and query of u which robots.txt rules are
+// matched against.
+func robotsPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// robotsRules are the rules of a robots.txt which apply to our user agent.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// allowed determines whether path may be fetched. The longest matching rule
+// takes precedence, with Allow winning ties. Paths matching no rules are
+// allowed.
+func (r robotsRules) allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// robotsGroup is a set of rules which apply to the user agents preceding
+// them.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// parseRobots parses a robots.txt, returning the rules of the groups which
+// apply to userAgent. If no group names userAgent's product token, the "*"
+// group applies.
+func parseRobots(r io.Reader, userAgent string) robotsRules {
+	var (
+		groups []*robotsGroup
+		group  *robotsGroup
+		// inAgents is true whilst consecutive user-agent lines are read, which
+		// all share the following group
+		inAgents bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				groups = append(groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			// an empty rule matches nothing
+			if group == nil || value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+				re:      robotsPattern(value),
+			})
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	token := strings.ToLower(userAgent)
+	if i := strings.Index(token, "/"); i != -1 {
+		token = token[:i]
+	}
+
+	if rules, ok := matchRobotsGroups(groups, token); ok {
+		return rules
+	}
+	rules, _ := matchRobotsGroups(groups, "*")
+	return rules
+}
+
+// matchRobotsGroups merges the groups which name agent, returning false if
+// there are none.
+func matchRobotsGroups(groups []*robotsGroup, agent string) (robotsRules, bool) {
+	var (
+		rules   robotsRules
+		matched bool
+	)
+	for _, group := range groups {
+		for _, a := range group.agents {
+			if a != agent {
+				continue
+			}
+			rules.rules = append(rules.rules, group.rules...)
+			if group.crawlDelay > rules.crawlDelay {
+				rules.crawlDelay = group.crawlDelay
+			}
+			matched = true
+			break
+		}
+	}
+	return rules, matched
+}
+
+// robotsPattern compiles a robots.txt path pattern, where "*" matches any
+// sequence of characters and a trailing "$" anchors the end of the path.
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRobots(t *testing.T) {
+	const robots = `
+# comments are ignored
+User-agent: *
+Disallow: /
+
+User-agent: other-bot
+User-agent: url-scraper
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: url-scraper
+Disallow: /tmp/ # merged with the above group
+`
+
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		{"unmatched path", "url-scraper/1.0", "/index.html", true},
+		{"disallowed prefix", "url-scraper/1.0", "/private/page", false},
+		{"longer allow wins", "url-scraper/1.0", "/private/public/page", true},
+		{"wildcard with end anchor", "url-scraper/1.0", "/docs/file.pdf", false},
+		{"end anchor not matched", "url-scraper/1.0", "/docs/file.pdf?download=1", true},
+		{"merged group", "url-scraper/1.0", "/tmp/file", false},
+		{"case insensitive user agent", "URL-Scraper/2.0", "/private", false},
+		{"wildcard group", "another-bot/1.0", "/index.html", false},
+		{"robots.txt always allowed", "another-bot/1.0", "/robots.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(robots), tt.userAgent)
+			require.Equal(t, tt.expected, rules.allowed(tt.path))
+		})
+	}
+
+	rules := parseRobots(strings.NewReader(robots), "url-scraper/1.0")
+	require.Equal(t, 2*time.Second, rules.crawlDelay)
+
+	// an empty group for our user agent allows everything, rather than
+	// falling back to the wildcard group
+	rules = parseRobots(strings.NewReader("User-agent: *\nDisallow: /\n\nUser-agent: url-scraper\nDisallow:\n"), "url-scraper/1.0")
+	require.True(t, rules.allowed("/index.html"))
+}
+
+func TestRobotsChecker_Check(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		path        string
+		expectedErr error
+		expectFail  bool
+	}{
+		{
+			name:   "allowed",
+			status: http.StatusOK,
+			body:   "User-agent: *\nDisallow: /private\n",
+			path:   "/public",
+		},
+		{
+			name:        "disallowed",
+			status:      http.StatusOK,
+			body:        "User-agent: *\nDisallow: /private\n",
+			path:        "/private",
+			expectedErr: errDisallowedByRobots,
+		},
+		{
+			name:   "missing robots.txt allows all",
+			status: http.StatusNotFound,
+			path:   "/private",
+		},
+		{
+			name:       "unreachable robots.txt",
+			status:     http.StatusServiceUnavailable,
+			path:       "/public",
+			expectFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/robots.txt", r.URL.Path)
+				require.Equal(t, "url-scraper/1.0", r.UserAgent())
+				atomic.AddInt32(&fetches, 1)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			checker := newRobotsChecker(server.Client(), "url-scraper/1.0", time.Minute)
+			u, err := url.Parse(server.URL + tt.path)
+			require.NoError(t, err)
+
+			for i := 0; i < 2; i++ {
+				err = checker.check(context.Background(), u)
+				switch {
+				case tt.expectedErr != nil:
+					require.ErrorIs(t, err, tt.expectedErr)
+				case tt.expectFail:
+					require.Error(t, err)
+					require.False(t, errors.Is(err, errDisallowedByRobots))
+				default:
+					require.NoError(t, err)
+				}
+			}
+
+			// successful fetches are cached, whereas failed fetches are
+			// retried
+			expectedFetches := int32(1)
+			if tt.expectFail {
+				expectedFetches = 2
+			}
+			require.Equal(t, expectedFetches, atomic.LoadInt32(&fetches))
+		})
+	}
+}
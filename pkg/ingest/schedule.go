@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule determines when a URL is next benchmarked.
+type schedule interface {
+	// next returns the next run time strictly after from.
+	next(from time.Time) time.Time
+}
+
+// parseSchedule parses a URL's schedule, which is either an interval duration
+// (e.g. "30s" or "5m") or a standard 5 field cron expression (e.g.
+// "*/15 9-17 * * 1-5"). An empty schedule uses defaultInterval.
+func parseSchedule(spec string, defaultInterval time.Duration) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return intervalSchedule(defaultInterval), nil
+	}
+
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("schedule interval %q must be at least 1s", spec)
+		}
+		return intervalSchedule(d), nil
+	}
+
+	return parseCron(spec)
+}
+
+// intervalSchedule runs at a fixed interval.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(from time.Time) time.Time {
+	return from.Add(time.Duration(s))
+}
+
+// cronSchedule runs at the times matched by a cron expression, evaluated in
+// UTC. Each field is a bitset of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record whether the day of month and day of week
+	// fields are unrestricted; if both are restricted, either may match
+	domAny, dowAny bool
+}
+
+// cronFields are the bounds of each cron field in order.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCron parses a 5 field cron expression. Each field supports "*",
+// values, ranges ("1-5"), steps ("*/15" or "0-30/10") and lists thereof.
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: expected a duration or a cron expression with 5 fields", spec)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s field in schedule %q: %w", cronFields[i].name, spec, err)
+		}
+		bits[i] = b
+	}
+
+	// Sunday may be either 0 or 7
+	dow := bits[4]
+	if dow&(1<<7) != 0 {
+		dow |= 1
+	}
+
+	return &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    dow,
+		domAny: strings.HasPrefix(fields[2], "*"),
+		dowAny: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepSpec)
+			}
+		}
+
+		lower, upper := min, max
+		if rangeSpec != "*" {
+			lowerSpec, upperSpec, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if lower, err = strconv.Atoi(lowerSpec); err != nil {
+				return 0, fmt.Errorf("invalid value %q", lowerSpec)
+			}
+			upper = lower
+			if isRange {
+				if upper, err = strconv.Atoi(upperSpec); err != nil {
+					return 0, fmt.Errorf("invalid value %q", upperSpec)
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to the maximum in steps of 15
+				upper = max
+			}
+		}
+		if lower < min || upper > max || lower > upper {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lower; v <= upper; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// cronSearchLimit bounds the search for the next run time so that
+// expressions which never match (e.g. 30th February) terminate.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+func (s *cronSchedule) next(from time.Time) time.Time {
+	t := from.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	// never matches, so effectively never run
+	return limit
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2023, 4, 5, 10, 17, 30, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		name     string
+		spec     string
+		expected []time.Time
+		invalid  bool
+	}{
+		{
+			name:     "default interval",
+			spec:     "",
+			expected: []time.Time{from.Add(time.Minute)},
+		},
+		{
+			name:     "interval",
+			spec:     "90s",
+			expected: []time.Time{from.Add(90 * time.Second)},
+		},
+		{
+			name: "every 15 minutes",
+			spec: "*/15 * * * *",
+			expected: []time.Time{
+				time.Date(2023, 4, 5, 10, 30, 0, 0, time.UTC),
+				time.Date(2023, 4, 5, 10, 45, 0, 0, time.UTC),
+				time.Date(2023, 4, 5, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "weekday working hours",
+			spec: "0 9-17/4 * * 1-5",
+			expected: []time.Time{
+				time.Date(2023, 4, 5, 13, 0, 0, 0, time.UTC),
+				time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC),
+				time.Date(2023, 4, 6, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "sunday as 7",
+			spec: "30 0 * * 7",
+			expected: []time.Time{
+				time.Date(2023, 4, 9, 0, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "day of month or day of week",
+			spec: "0 0 1 * 6",
+			expected: []time.Time{
+				time.Date(2023, 4, 8, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 4, 15, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "lists and month rollover",
+			spec: "5,10 0 1 1,7 *",
+			expected: []time.Time{
+				time.Date(2023, 7, 1, 0, 5, 0, 0, time.UTC),
+				time.Date(2023, 7, 1, 0, 10, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC),
+			},
+		},
+		{name: "interval too short", spec: "10ms", invalid: true},
+		{name: "too few fields", spec: "* * * *", invalid: true},
+		{name: "out of range", spec: "60 * * * *", invalid: true},
+		{name: "invalid step", spec: "*/0 * * * *", invalid: true},
+		{name: "inverted range", spec: "* 5-1 * * *", invalid: true},
+		{name: "not a schedule", spec: "hourly", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := parseSchedule(tt.spec, time.Minute)
+			if tt.invalid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			next := from
+			for _, expected := range tt.expected {
+				next = sched.next(next)
+				require.Equal(t, expected, next)
+			}
+		})
+	}
+
+	t.Run("never matches", func(t *testing.T) {
+		sched, err := parseSchedule("0 0 30 2 *", time.Minute)
+		require.NoError(t, err)
+		require.True(t, sched.next(from).After(from.Add(4*365*24*time.Hour)))
+	})
+}
@@ -0,0 +1,260 @@
+package ingest
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// scheduler tracks when each stored URL is next due to be benchmarked,
+// ordered by a min-heap of next run times.
+type scheduler struct {
+	logger          config.Logger
+	storage         ports.Storer
+	defaultInterval time.Duration
+	// jitter is the fraction (0-1) of each interval which is randomly added
+	// to the next run time so that URLs don't all run at once
+	jitter float64
+
+	mu      *sync.Mutex
+	queue   scheduleQueue
+	entries map[string]*scheduledURL
+	rand    *rand.Rand
+	summary *scrapeSummary
+
+	// wake is signalled when an entry is scheduled before the current
+	// earliest entry
+	wake chan struct{}
+}
+
+// scheduledURL is a stored URL and its next run time.
+type scheduledURL struct {
+	record   ports.Record
+	schedule schedule
+	next     time.Time
+	// running is true whilst a benchmark of the URL is in flight, so that
+	// slow URLs aren't benchmarked concurrently with themselves
+	running bool
+	// index is the entry's index in the heap
+	index int
+}
+
+func newScheduler(logger config.Logger, storage ports.Storer, defaultInterval time.Duration, jitter float64) *scheduler {
+	return &scheduler{
+		logger:          logger,
+		storage:         storage,
+		defaultInterval: defaultInterval,
+		jitter:          jitter,
+		mu:              &sync.Mutex{},
+		entries:         make(map[string]*scheduledURL),
+		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		summary:         &scrapeSummary{},
+		wake:            make(chan struct{}, 1),
+	}
+}
+
+// sync reconciles the schedule with the store: URLs which have been stored
+// since the last sync are scheduled, the specs of scheduled URLs are updated
+// and evicted URLs are unscheduled. URLs which are new to the scheduler, e.g.
+// on startup, are first run at a random point within their interval.
+func (s *scheduler) sync() {
+	records := s.storage.Fetch(math.MaxInt, ports.Age, ports.Descending)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		stored[record.Key] = struct{}{}
+		s.upsert(record, now, true)
+	}
+
+	for key, entry := range s.entries {
+		if _, ok := stored[key]; !ok {
+			heap.Remove(&s.queue, entry.index)
+			delete(s.entries, key)
+		}
+	}
+}
+
+// add schedules a newly stored URL, or updates the spec of a scheduled URL if
+// spec is non-nil. New URLs are first run after a full interval.
+func (s *scheduler) add(url string, spec *ports.URLSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := ports.Record{Key: url}
+	if entry, ok := s.entries[url]; ok {
+		record = entry.record
+	}
+	if spec != nil {
+		record.URLSpec = *spec
+	}
+	s.upsert(record, time.Now(), false)
+}
+
+// upsert schedules or updates record. The caller must hold the lock.
+func (s *scheduler) upsert(record ports.Record, now time.Time, randomStart bool) {
+	sched, err := parseSchedule(record.Schedule, s.defaultInterval)
+	if err != nil {
+		// specs are validated on ingestion, so this is unexpected
+		s.logger.Error("failed to parse URL schedule, using default interval", zap.String("url", record.Key), zap.Error(err))
+		sched = intervalSchedule(s.defaultInterval)
+	}
+
+	entry, ok := s.entries[record.Key]
+	if ok {
+		scheduleChanged := entry.record.Schedule != record.Schedule
+		entry.record = record
+		entry.schedule = sched
+		if !scheduleChanged {
+			return
+		}
+		entry.next = s.nextRun(sched, now)
+		heap.Fix(&s.queue, entry.index)
+	} else {
+		entry = &scheduledURL{record: record, schedule: sched}
+		entry.next = s.nextRun(sched, now)
+		if randomStart {
+			// spread URLs loaded at once across their first interval
+			entry.next = now.Add(time.Duration(s.rand.Float64() * float64(entry.next.Sub(now))))
+		}
+		s.entries[record.Key] = entry
+		heap.Push(&s.queue, entry)
+	}
+
+	if s.queue[0] == entry {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// nextRun returns the next run time of sched after now, including jitter for
+// interval schedules. Cron schedules run at their exact times, as jitter
+// proportional to a potentially long gap between matches could delay a run by
+// hours or days. The caller must hold the lock.
+func (s *scheduler) nextRun(sched schedule, now time.Time) time.Time {
+	next := sched.next(now)
+	if _, ok := sched.(intervalSchedule); !ok {
+		return next
+	}
+	return next.Add(time.Duration(s.jitter * s.rand.Float64() * float64(next.Sub(now))))
+}
+
+// untilNext returns how long until the earliest entry is due, or max if there
+// are no entries.
+func (s *scheduler) untilNext(now time.Time, max time.Duration) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return max
+	}
+	if wait := s.queue[0].next.Sub(now); wait < max {
+		return wait
+	}
+	return max
+}
+
+// due returns the records of all entries due at now, marking them as running
+// and scheduling their next run. Entries which are still running from their
+// previous run are skipped.
+func (s *scheduler) due(now time.Time) []ports.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []ports.Record
+	for len(s.queue) > 0 && !s.queue[0].next.After(now) {
+		entry := s.queue[0]
+		if entry.running {
+			s.logger.Warn("skipping scheduled benchmark of URL as previous benchmark is still running",
+				zap.String("url", entry.record.Key))
+		} else {
+			entry.running = true
+			records = append(records, entry.record)
+		}
+		entry.next = s.nextRun(entry.schedule, now)
+		heap.Fix(&s.queue, entry.index)
+	}
+	return records
+}
+
+// setContent updates the content of a scheduled URL so that its next run is
+// conditional on the latest cache validators.
+func (s *scheduler) setContent(url string, content ports.Content) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[url]; ok {
+		entry.record.Content = content
+	}
+}
+
+// done marks a benchmark of url as complete and records its result in the
+// summary.
+func (s *scheduler) done(url string, result scrapeResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[url]; ok {
+		entry.running = false
+	}
+	s.summary.push(result)
+}
+
+// flushSummary returns the summary of benchmarks completed since the last
+// flush.
+func (s *scheduler) flushSummary() *scrapeSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := s.summary
+	s.summary = &scrapeSummary{}
+	return summary
+}
+
+// len returns the number of scheduled URLs.
+func (s *scheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// scheduleQueue is a min-heap of scheduledURLs ordered by next run time. It
+// implements heap.Interface.
+type scheduleQueue []*scheduledURL
+
+func (q scheduleQueue) Len() int { return len(q) }
+
+func (q scheduleQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x any) {
+	entry := x.(*scheduledURL)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *scheduleQueue) Pop() any {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return entry
+}
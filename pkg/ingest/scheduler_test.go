@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+	"jemgunay/url-scraper/pkg/store"
+)
+
+func TestScheduler(t *testing.T) {
+	logger := zap.NewNop()
+	storage := store.New(logger, 2)
+	sched := newScheduler(logger, storage, time.Hour, 0)
+
+	storage.Store("https://a.com/", &ports.URLSpec{Schedule: "1m"})
+	storage.Store("https://b.com/", &ports.URLSpec{Schedule: "2m"})
+	sched.sync()
+	require.Equal(t, 2, sched.len())
+
+	// URLs loaded by a sync are first run within their interval
+	now := time.Now()
+	require.LessOrEqual(t, sched.untilNext(now, time.Hour), 2*time.Minute)
+	records := sched.due(now.Add(2 * time.Minute))
+	require.Len(t, records, 2)
+
+	// running URLs are skipped until done
+	require.Empty(t, sched.due(now.Add(10*time.Minute)))
+	sched.done("https://a.com/", scrapeResult{URL: "https://a.com/"})
+	records = sched.due(now.Add(20 * time.Minute))
+	require.Len(t, records, 1)
+	require.Equal(t, "https://a.com/", records[0].Key)
+	require.Len(t, sched.flushSummary().Durations, 1)
+	require.Empty(t, sched.flushSummary().Durations)
+
+	// new URLs are first run after a full interval
+	sched.done("https://a.com/", scrapeResult{})
+	sched.add("https://c.com/", &ports.URLSpec{Schedule: "30s"})
+	require.Equal(t, 3, sched.len())
+	now = time.Now()
+	require.Empty(t, sched.due(now.Add(29*time.Second)))
+
+	// evicted URLs are unscheduled on sync
+	storage.Store("https://c.com/", nil)
+	sched.sync()
+	require.Equal(t, 2, sched.len())
+	for _, record := range storage.Fetch(10, ports.Age, ports.Descending) {
+		require.Contains(t, sched.entries, record.Key)
+	}
+}
+
+func TestScheduler_NextRun(t *testing.T) {
+	sched := newScheduler(zap.NewNop(), store.New(zap.NewNop(), 1), time.Hour, 1)
+	now := time.Date(2023, 1, 2, 9, 30, 0, 0, time.UTC)
+
+	// intervals are jittered by up to the jitter fraction of the interval
+	next := sched.nextRun(intervalSchedule(time.Minute), now)
+	require.False(t, next.Before(now.Add(time.Minute)))
+	require.False(t, next.After(now.Add(2*time.Minute)))
+
+	// cron schedules aren't jittered
+	cron, err := parseSchedule("0 9 * * 1", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 1, 9, 9, 0, 0, 0, time.UTC), sched.nextRun(cron, now))
+}
@@ -0,0 +1,95 @@
+package ingest
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// requestTrace records the timestamps of each phase of a request via
+// httptrace hooks. Hooks may be called from the transport's dialing
+// goroutines, so access is synchronised.
+type requestTrace struct {
+	mu *sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+}
+
+func newRequestTrace() *requestTrace {
+	return &requestTrace{
+		mu: &sync.Mutex{},
+	}
+}
+
+// clientTrace returns the httptrace hooks which populate the requestTrace.
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	// record sets *ts to now, keeping the first value if set multiple times,
+	// e.g. when dialing multiple addresses in parallel
+	record := func(ts *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if ts.IsZero() {
+			*ts = time.Now().UTC()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { record(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { record(&t.dnsDone) },
+		ConnectStart: func(network, addr string) {
+			record(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				record(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { record(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(&t.tlsDone)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			record(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() { record(&t.firstByte) },
+	}
+}
+
+// reset clears all recorded timestamps, e.g. to time a redirected request
+// afresh.
+func (t *requestTrace) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	*t = requestTrace{mu: t.mu}
+}
+
+// timings calculates the duration of each phase given the time at which the
+// response body was fully read.
+func (t *requestTrace) timings(bodyDone time.Time) ports.PhaseTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return ports.PhaseTimings{
+		DNSLookup:       between(t.dnsStart, t.dnsDone),
+		Connect:         between(t.connectStart, t.connectDone),
+		TLSHandshake:    between(t.tlsStart, t.tlsDone),
+		TimeToFirstByte: between(t.wroteRequest, t.firstByte),
+		ContentTransfer: between(t.firstByte, bodyDone),
+	}
+}
+
+// between returns the duration between start and end, or zero if either
+// didn't occur.
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
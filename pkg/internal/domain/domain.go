@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"strings"
+)
+
+// Match returns the value of host's most specific domain in domains, walking up
+// the domain hierarchy, e.g. api.example.com then example.com. host is matched
+// case-insensitively and any port is ignored. domains must be keyed by
+// lowercase domain.
+func Match[T any](domains map[string]T, host string) (T, bool) {
+	host = strings.ToLower(host)
+	// strip the port, if any
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+
+	for domain := host; domain != ""; {
+		if value, ok := domains[domain]; ok {
+			return value, true
+		}
+
+		i := strings.Index(domain, ".")
+		if i == -1 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+
+	var zero T
+	return zero, false
+}
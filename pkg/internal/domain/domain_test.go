@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	domains := map[string]string{
+		"example.com":         "example",
+		"private.example.com": "private",
+	}
+
+	tests := []struct {
+		name          string
+		host          string
+		expected      string
+		expectedMatch bool
+	}{
+		{"domain", "example.com", "example", true},
+		{"subdomain", "api.example.com", "example", true},
+		{"most specific domain", "api.private.example.com", "private", true},
+		{"port and case ignored", "API.Example.com:8080", "example", true},
+		{"suffix is not a subdomain", "notexample.com", "", false},
+		{"IPv6 literal", "[::1]", "", false},
+		{"no match", "other.com", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, ok := Match(domains, tt.host)
+			require.Equal(t, tt.expectedMatch, ok)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
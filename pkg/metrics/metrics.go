@@ -0,0 +1,352 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the default histogram bucket upper bounds, suitable for
+// request durations in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// collector is a metric family which can be written in the text exposition
+// format.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry is a concurrency-safe collection of metrics which is rendered in the
+// Prometheus text exposition format, allowing metrics to be scraped without
+// depending on the Prometheus client libraries.
+type Registry struct {
+	mu         *sync.Mutex
+	names      map[string]struct{}
+	collectors []collector
+}
+
+// NewRegistry initialises a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		mu:    &sync.Mutex{},
+		names: make(map[string]struct{}),
+	}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.names[name]; ok {
+		panic(fmt.Sprintf("metric %q registered twice", name))
+	}
+	r.names[name] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounter registers a new counter which is partitioned by labelNames.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{family: newFamily[*Counter](name, help, labelNames, func() *Counter {
+		return &Counter{mu: &sync.Mutex{}}
+	})}
+	r.register(name, c)
+	return c
+}
+
+// NewCounterFunc registers a new counter whose value is read from f on each
+// scrape.
+func (r *Registry) NewCounterFunc(name, help string, f func() float64) {
+	r.register(name, &funcCollector{name: name, help: help, typ: counterType, f: f})
+}
+
+// NewGaugeFunc registers a new gauge whose value is read from f on each
+// scrape.
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(name, &funcCollector{name: name, help: help, typ: gaugeType, f: f})
+}
+
+// NewHistogram registers a new histogram which is partitioned by labelNames.
+// buckets are the bucket upper bounds in increasing order.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{family: newFamily[*Histogram](name, help, labelNames, func() *Histogram {
+		return &Histogram{
+			mu:      &sync.Mutex{},
+			buckets: buckets,
+			counts:  make([]uint64, len(buckets)),
+		}
+	})}
+	r.register(name, h)
+	return h
+}
+
+// WriteTo writes all registered metrics to w in the Prometheus text exposition
+// format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler returns an http.Handler which serves the registered metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		r.WriteTo(w)
+	})
+}
+
+// family is a metric partitioned into series by label values.
+type family[T any] struct {
+	name       string
+	help       string
+	labelNames []string
+	newSeries  func() T
+
+	mu     *sync.RWMutex
+	series map[string]*series[T]
+}
+
+type series[T any] struct {
+	labelValues []string
+	metric      T
+}
+
+func newFamily[T any](name, help string, labelNames []string, newSeries func() T) family[T] {
+	return family[T]{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		newSeries:  newSeries,
+		mu:         &sync.RWMutex{},
+		series:     make(map[string]*series[T]),
+	}
+}
+
+// with returns the series for labelValues, creating it if it doesn't exist.
+func (f *family[T]) with(labelValues []string) T {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %q expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s.metric
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s.metric
+	}
+	s = &series[T]{labelValues: labelValues, metric: f.newSeries()}
+	f.series[key] = s
+	return s.metric
+}
+
+// sorted returns all series sorted by label values so that output is stable.
+func (f *family[T]) sorted() []*series[T] {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	sorted := make([]*series[T], 0, len(f.series))
+	for _, s := range f.series {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.Join(sorted[i].labelValues, "\xff") < strings.Join(sorted[j].labelValues, "\xff")
+	})
+	return sorted
+}
+
+// labels formats label pairs, with any extra pair appended, e.g. {a="b",le="1"}.
+func (f *family[T]) labels(labelValues []string, extra ...string) string {
+	if len(labelValues) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, value := range labelValues {
+		pairs = append(pairs, f.labelNames[i]+`="`+escapeLabelValue(value)+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeLabelValue(extra[1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	family[*Counter]
+}
+
+// With returns the Counter for the given label values, which must be provided
+// in the same order as the label names the CounterVec was registered with.
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.with(labelValues)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, counterType)
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(s.labelValues), formatFloat(s.metric.value()))
+	}
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	mu  *sync.Mutex
+	val float64
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increments the counter by delta, which must not be negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("counter cannot decrease in value")
+	}
+	c.mu.Lock()
+	c.val += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.val
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	family[*Histogram]
+}
+
+// With returns the Histogram for the given label values, which must be
+// provided in the same order as the label names the HistogramVec was
+// registered with.
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.with(labelValues)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, histogramType)
+	for _, s := range h.sorted() {
+		counts, count, sum := s.metric.snapshot()
+
+		var cumulative uint64
+		for i, upper := range s.metric.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(s.labelValues), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(s.labelValues), count)
+	}
+}
+
+// Histogram samples observations into buckets.
+type Histogram struct {
+	mu      *sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe adds an observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// observations above the largest bucket are only counted in +Inf
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) snapshot() ([]uint64, uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	return counts, h.count, h.sum
+}
+
+// funcCollector is an unlabelled metric whose value is read on each scrape.
+type funcCollector struct {
+	name string
+	help string
+	typ  metricType
+	f    func() float64
+}
+
+func (c *funcCollector) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, c.typ)
+	fmt.Fprintf(w, "%s %s\n", c.name, formatFloat(c.f()))
+}
+
+func writeHeader(w *bufio.Writer, name, help string, typ metricType) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := registry.NewCounter("requests_total", "Total requests.", "code", "method")
+	requests.With("200", "GET").Inc()
+	requests.With("200", "GET").Add(2)
+	requests.With("500", "POST").Inc()
+
+	registry.NewGaugeFunc("queue_depth", "Current queue depth.", func() float64 { return 7 })
+	registry.NewCounterFunc("evictions_total", "Total evictions.", func() float64 { return 3 })
+
+	durations := registry.NewHistogram("duration_seconds", "Request durations.", []float64{0.1, 1}, "host")
+	durations.With(`ex"ample`).Observe(0.05)
+	durations.With(`ex"ample`).Observe(0.1)
+	durations.With(`ex"ample`).Observe(0.5)
+	durations.With(`ex"ample`).Observe(5)
+
+	registry.NewCounter("unlabelled_total", "Multi\nline help.").With().Inc()
+
+	expected := `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{code="200",method="GET"} 3
+requests_total{code="500",method="POST"} 1
+# HELP queue_depth Current queue depth.
+# TYPE queue_depth gauge
+queue_depth 7
+# HELP evictions_total Total evictions.
+# TYPE evictions_total counter
+evictions_total 3
+# HELP duration_seconds Request durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{host="ex\"ample",le="0.1"} 2
+duration_seconds_bucket{host="ex\"ample",le="1"} 3
+duration_seconds_bucket{host="ex\"ample",le="+Inf"} 4
+duration_seconds_sum{host="ex\"ample"} 5.65
+duration_seconds_count{host="ex\"ample"} 4
+# HELP unlabelled_total Multi\nline help.
+# TYPE unlabelled_total counter
+unlabelled_total 1
+`
+
+	b := &strings.Builder{}
+	n, err := registry.WriteTo(b)
+	require.NoError(t, err)
+	require.Equal(t, expected, b.String())
+	require.EqualValues(t, len(expected), n)
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGaugeFunc("up", "Whether the service is up.", func() float64 { return 1 })
+
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, contentType, rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "up 1\n")
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("requests_total", "Total requests.", "code")
+
+	require.Panics(t, func() { registry.NewCounter("requests_total", "Duplicate.") })
+	require.Panics(t, func() { counter.With("200", "GET") })
+	require.Panics(t, func() { counter.With("200").Add(-1) })
+}
@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// privatePrefixes are the non-public IP ranges blocked when BlockPrivate is
+// set.
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this" network
+	netip.MustParsePrefix("10.0.0.0/8"),     // private
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),    // loopback
+	netip.MustParsePrefix("169.254.0.0/16"), // link-local, incl. cloud metadata
+	netip.MustParsePrefix("172.16.0.0/12"),  // private
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("192.168.0.0/16"), // private
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("224.0.0.0/4"),    // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, incl. broadcast
+	netip.MustParsePrefix("::/128"),         // unspecified
+	netip.MustParsePrefix("::1/128"),        // loopback
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which may map to private IPv4
+	netip.MustParsePrefix("2001::/32"),      // Teredo, which embeds IPv4
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("2002::/16"),      // 6to4, which may relay to private IPv4
+	netip.MustParsePrefix("fc00::/7"),       // unique local, incl. cloud metadata
+	netip.MustParsePrefix("fe80::/10"),      // link-local
+	netip.MustParsePrefix("ff00::/8"),       // multicast
+}
+
+// Policy determines whether outgoing requests may connect to a destination.
+// Its DialContext enforces the policy on the resolved IPs of every
+// connection, so it also applies to redirects and can't be bypassed by DNS
+// records pointing at internal addresses.
+type Policy struct {
+	blockPrivate bool
+	allowDomains []string
+	denyDomains  []string
+	allowCIDRs   []netip.Prefix
+	denyCIDRs    []netip.Prefix
+
+	resolver *net.Resolver
+	dialer   *net.Dialer
+}
+
+// New initialises a new Policy from the destinations config.
+func New(conf config.Destinations) (*Policy, error) {
+	allowCIDRs, err := parsePrefixes(conf.AllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow CIDRs: %w", err)
+	}
+	denyCIDRs, err := parsePrefixes(conf.DenyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny CIDRs: %w", err)
+	}
+
+	return &Policy{
+		blockPrivate: conf.BlockPrivate,
+		allowDomains: normaliseDomains(conf.AllowDomains),
+		denyDomains:  normaliseDomains(conf.DenyDomains),
+		allowCIDRs:   allowCIDRs,
+		denyCIDRs:    denyCIDRs,
+		resolver:     net.DefaultResolver,
+		dialer:       &net.Dialer{},
+	}, nil
+}
+
+// CheckHost returns ports.ErrBlockedDestination (wrapped) if requests to host
+// are prohibited by the domain allow and deny lists. If there is a domain
+// allow list, IP literals are only permitted if they are in an allowed CIDR.
+// host must not include a port.
+func (p *Policy) CheckHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if matchDomain(host, p.denyDomains) {
+		return fmt.Errorf("%w: domain %s is denied", ports.ErrBlockedDestination, host)
+	}
+	if len(p.allowDomains) == 0 {
+		return nil
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !matchPrefix(ip.Unmap(), p.allowCIDRs) {
+			return fmt.Errorf("%w: IP %s is not in an allowed domain or CIDR", ports.ErrBlockedDestination, host)
+		}
+		return nil
+	}
+	if !matchDomain(host, p.allowDomains) {
+		return fmt.Errorf("%w: domain %s is not allowed", ports.ErrBlockedDestination, host)
+	}
+	return nil
+}
+
+// CheckIP returns ports.ErrBlockedDestination (wrapped) if connections to ip
+// are prohibited.
+func (p *Policy) CheckIP(ip netip.Addr) error {
+	ip = ip.Unmap()
+
+	if matchPrefix(ip, p.denyCIDRs) {
+		return fmt.Errorf("%w: IP %s is denied", ports.ErrBlockedDestination, ip)
+	}
+	if matchPrefix(ip, p.allowCIDRs) {
+		return nil
+	}
+	if p.blockPrivate && matchPrefix(ip, privatePrefixes) {
+		return fmt.Errorf("%w: IP %s is in a private range", ports.ErrBlockedDestination, ip)
+	}
+	return nil
+}
+
+// DialContext resolves addr and connects to the first of its IPs which is
+// permitted by the policy. It satisfies http.Transport.DialContext.
+func (p *Policy) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.CheckHost(host); err != nil {
+		return nil, err
+	}
+
+	// resolve here rather than in the dialer so that the IPs we check are the
+	// IPs we connect to
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else if ips, err = p.resolver.LookupNetIP(ctx, "ip", host); err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, ip := range ips {
+		if err := p.CheckIP(ip); err != nil {
+			if dialErr == nil {
+				dialErr = err
+			}
+			continue
+		}
+
+		conn, err := p.dialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	if dialErr == nil {
+		dialErr = fmt.Errorf("no IPs found for host %s", host)
+	}
+	return nil, dialErr
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func normaliseDomains(domains []string) []string {
+	normalised := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		normalised = append(normalised, strings.TrimSuffix(strings.ToLower(domain), "."))
+	}
+	return normalised
+}
+
+// matchDomain determines whether host is one of domains or a subdomain of
+// one.
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPrefix(ip netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
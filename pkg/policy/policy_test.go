@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestPolicy_CheckIP(t *testing.T) {
+	policy, err := New(config.Destinations{
+		BlockPrivate: true,
+		AllowCIDRs:   []string{"10.1.0.0/16"},
+		DenyCIDRs:    []string{"203.0.113.0/24", "10.1.2.0/24"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"93.184.216.34", false},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"fd00:ec2::254", true},
+		{"192.168.1.1", true},
+		{"172.16.0.1", true},
+		{"0.0.0.0", true},
+		{"fe80::1", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"2002:a9fe:a9fe::", true},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", true},
+		{"2001:db8::1", true},
+		{"2606:4700::1111", false},
+		{"10.0.0.1", true},
+		{"10.1.0.1", false},
+		{"10.1.2.1", true},
+		{"203.0.113.10", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			err := policy.CheckIP(netip.MustParseAddr(tt.ip))
+			if tt.blocked {
+				require.ErrorIs(t, err, ports.ErrBlockedDestination)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("private ranges permitted if not blocked", func(t *testing.T) {
+		policy, err := New(config.Destinations{})
+		require.NoError(t, err)
+		require.NoError(t, policy.CheckIP(netip.MustParseAddr("127.0.0.1")))
+	})
+}
+
+func TestPolicy_CheckHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Destinations
+		host    string
+		blocked bool
+	}{
+		{"no lists", config.Destinations{}, "example.com", false},
+		{"denied domain", config.Destinations{DenyDomains: []string{"example.com"}}, "example.com", true},
+		{"denied subdomain", config.Destinations{DenyDomains: []string{"example.com"}}, "API.example.com.", true},
+		{"suffix is not a subdomain", config.Destinations{DenyDomains: []string{"example.com"}}, "notexample.com", false},
+		{"allowed domain", config.Destinations{AllowDomains: []string{"httpbin.org"}}, "httpbin.org", false},
+		{"not allowed domain", config.Destinations{AllowDomains: []string{"httpbin.org"}}, "example.com", true},
+		{"deny takes precedence", config.Destinations{AllowDomains: []string{"httpbin.org"}, DenyDomains: []string{"admin.httpbin.org"}}, "admin.httpbin.org", true},
+		{"IP literal not allowed by allow list", config.Destinations{AllowDomains: []string{"httpbin.org"}}, "93.184.216.34", true},
+		{"IPv6 literal not allowed by allow list", config.Destinations{AllowDomains: []string{"httpbin.org"}}, "2606:4700::1111", true},
+		{"IP literal in allowed CIDR", config.Destinations{AllowDomains: []string{"httpbin.org"}, AllowCIDRs: []string{"93.184.216.0/24"}}, "93.184.216.34", false},
+		{"IP literal without allow list", config.Destinations{}, "93.184.216.34", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := New(tt.conf)
+			require.NoError(t, err)
+
+			err = policy.CheckHost(tt.host)
+			if tt.blocked {
+				require.ErrorIs(t, err, ports.ErrBlockedDestination)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPolicy_DialContext(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	targetURL, err := url.Parse(target.URL)
+	require.NoError(t, err)
+
+	// redirects to the same server via localhost, which is denied
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+targetURL.Port(), http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	newClient := func(conf config.Destinations) *http.Client {
+		policy, err := New(conf)
+		require.NoError(t, err)
+		return &http.Client{Transport: &http.Transport{DialContext: policy.DialContext}}
+	}
+
+	t.Run("loopback blocked by default", func(t *testing.T) {
+		_, err := newClient(config.Destinations{BlockPrivate: true}).Get(target.URL)
+		require.ErrorIs(t, err, ports.ErrBlockedDestination)
+	})
+
+	t.Run("allowed CIDR", func(t *testing.T) {
+		resp, err := newClient(config.Destinations{BlockPrivate: true, AllowCIDRs: []string{"127.0.0.0/8"}}).Get(target.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("enforced on redirects", func(t *testing.T) {
+		client := newClient(config.Destinations{
+			BlockPrivate: true,
+			AllowCIDRs:   []string{"127.0.0.0/8"},
+			DenyDomains:  []string{"localhost"},
+		})
+		_, err := client.Get(redirector.URL)
+		require.ErrorIs(t, err, ports.ErrBlockedDestination)
+	})
+
+	t.Run("invalid CIDR", func(t *testing.T) {
+		_, err := New(config.Destinations{DenyCIDRs: []string{"not-a-cidr"}})
+		require.Error(t, err)
+	})
+}
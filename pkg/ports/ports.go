@@ -12,6 +12,138 @@ type Record struct {
 	Key          string    `json:"key"`
 	SubmitCount  int       `json:"count"`
 	LastUpserted time.Time `json:"last_upserted"`
+	// LastChanged is when the Content's Hash last changed, or zero if the
+	// content hasn't been hashed yet.
+	LastChanged time.Time `json:"last_changed"`
+	Content
+	// TLS describes the TLS connection of the most recent benchmark, if the
+	// URL is served over HTTPS.
+	TLS *TLSInfo `json:"tls,omitempty"`
+	// Metadata is extracted from the most recently downloaded HTML response,
+	// if any.
+	Metadata *Metadata `json:"metadata,omitempty"`
+	URLSpec
+}
+
+// Metadata is metadata extracted from an HTML page.
+type Metadata struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Canonical is the absolute URL of the page's canonical link.
+	Canonical string `json:"canonical,omitempty"`
+	Language  string `json:"language,omitempty"`
+	// OpenGraph and Twitter are keyed by property name without the "og:" or
+	// "twitter:" prefix, e.g. "image".
+	OpenGraph map[string]string `json:"open_graph,omitempty"`
+	Twitter   map[string]string `json:"twitter,omitempty"`
+	// OutboundLinks is the number of links to other hosts.
+	OutboundLinks int `json:"outbound_links"`
+}
+
+// TLSInfo describes a TLS connection and the peer's certificate chain.
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	// Chain is the peer certificate chain, leaf first.
+	Chain []Certificate `json:"chain"`
+	// ExpiresAt is the soonest expiry of any certificate in the Chain.
+	ExpiresAt    time.Time `json:"expires_at"`
+	DaysToExpiry int       `json:"days_to_expiry"`
+	// Expiring is set if ExpiresAt is within the certificate expiry warning
+	// window.
+	Expiring bool `json:"expiring"`
+}
+
+// Certificate describes an X.509 certificate.
+type Certificate struct {
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer"`
+	// SANs are the certificate's subject alternative names, i.e. DNS names,
+	// IP addresses, email addresses and URIs.
+	SANs         []string  `json:"sans,omitempty"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	DaysToExpiry int       `json:"days_to_expiry"`
+}
+
+// Content describes the response of the most recent successful benchmark of a
+// URL.
+type Content struct {
+	// Hash is the hash of the normalised response body.
+	Hash string `json:"content_hash,omitempty"`
+	// Size is the size of the response body in bytes.
+	Size int64 `json:"content_size,omitempty"`
+	// ETag and LastModified are the response's cache validators, which are
+	// sent as conditional request headers by subsequent benchmarks.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// URLSpec is the per-URL configuration of how a URL is benchmarked.
+type URLSpec struct {
+	// Method is the request method. Defaults to GET.
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// TimeoutMillis is the request timeout, which is capped at the global
+	// client timeout. Zero uses the global client timeout.
+	TimeoutMillis int `json:"timeout_ms,omitempty"`
+	// FollowRedirects determines whether redirects are followed. Defaults to
+	// true.
+	FollowRedirects *bool `json:"follow_redirects,omitempty"`
+	// Schedule is how often the URL is benchmarked, as either an interval
+	// (e.g. "5m") or a 5 field cron expression evaluated in UTC (e.g.
+	// "*/15 * * * *"). Defaults to the global refresh interval.
+	Schedule string `json:"schedule,omitempty"`
+	// Assertions determine whether a response is successful. If nil, any 2xx
+	// response is successful.
+	Assertions *Assertions `json:"assertions,omitempty"`
+	// Extract are the rules extracting values from HTML responses, which
+	// override any rules of the same name configured for the URL's domain.
+	Extract []ExtractionRule `json:"extract,omitempty"`
+}
+
+// Extraction value types.
+const (
+	ExtractString = "string"
+	ExtractNumber = "number"
+)
+
+// ExtractionRule extracts a named value from an HTML response.
+type ExtractionRule struct {
+	Name string `json:"name"`
+	// Selector is either a CSS selector (e.g. "div.price > span") or an
+	// XPath-like path starting with "/" (e.g. "//div[@id='price']/span[1]").
+	// The first matching element is extracted.
+	Selector string `json:"selector"`
+	// Attribute is the attribute of the element extracted. If empty, the
+	// element's text is extracted.
+	Attribute string `json:"attribute,omitempty"`
+	// Pattern is an optional regular expression applied to the extracted
+	// value, keeping its first capture group if any, otherwise the whole match.
+	Pattern string `json:"pattern,omitempty"`
+	// Type is either ExtractString or ExtractNumber. Defaults to
+	// ExtractString.
+	Type string `json:"type,omitempty"`
+}
+
+// Assertions are the conditions a response must satisfy to be successful.
+// Unset assertions are not evaluated.
+type Assertions struct {
+	// StatusCodes are the accepted status codes, as codes (e.g. "204"),
+	// classes (e.g. "2xx") or inclusive ranges (e.g. "200-299"). Defaults to
+	// 2xx.
+	StatusCodes []string `json:"status_codes,omitempty"`
+	// Headers are required response headers. An empty value only requires
+	// the header to be present.
+	Headers      map[string]string `json:"headers,omitempty"`
+	BodyContains string            `json:"body_contains,omitempty"`
+	BodyRegex    string            `json:"body_regex,omitempty"`
+	// JSONPathEquals maps JSON paths (e.g. "data.items[0].id") into the
+	// response body to their expected values.
+	JSONPathEquals        map[string]interface{} `json:"json_path_equals,omitempty"`
+	MaxResponseTimeMillis int                    `json:"max_response_time_ms,omitempty"`
+	MaxBodyBytes          int64                  `json:"max_body_bytes,omitempty"`
 }
 
 // SortOrder is the sort ordering approach.
@@ -49,16 +181,433 @@ const (
 
 // Storer is responsible for storing and fetching Records.
 type Storer interface {
-	Store(key string)
+	// Store stores a key, or bumps its count if previously stored. The
+	// Record's URLSpec is replaced by spec, unless spec is nil.
+	Store(key string, spec *URLSpec)
 	Fetch(limit int, sortBy SortBy, order SortOrder) []Record
+	// UpdateContent sets the Content of a stored key, bumping its LastChanged
+	// time to at if the Content's Hash differs from the previous one. It
+	// returns the previous hash and whether the content changed, which is
+	// always the case for the first hash of a key. Keys which aren't stored
+	// are ignored.
+	UpdateContent(key string, content Content, at time.Time) (previous string, changed bool)
+	// UpdateTLS sets the TLSInfo of a stored key. Keys which aren't stored are
+	// ignored.
+	UpdateTLS(key string, info TLSInfo)
+	// UpdateMetadata sets the Metadata of a stored key. Keys which aren't
+	// stored are ignored.
+	UpdateMetadata(key string, metadata Metadata)
+}
+
+// Benchmark is the result of a single URL benchmark request.
+type Benchmark struct {
+	Timestamp  time.Time     `json:"timestamp"`
+	Duration   time.Duration `json:"duration_ns"`
+	Phases     PhaseTimings  `json:"phases"`
+	Status     string        `json:"status"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Attempts is the number of requests made, including retries.
+	Attempts int `json:"attempts"`
+	// FailedAssertions describes each Assertion the response failed.
+	FailedAssertions []string `json:"failed_assertions,omitempty"`
+	// ContentHash is the hash of the normalised response body, if the
+	// benchmark was successful.
+	ContentHash string `json:"content_hash,omitempty"`
+	// Redirects are the redirects followed by the final attempt, in order.
+	// Phases only account for the request to FinalURL.
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+	// FinalURL is the URL of the final response, if any redirects were
+	// followed.
+	FinalURL string `json:"final_url,omitempty"`
+}
+
+// RedirectHop is a single redirect response in a redirect chain.
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	// Location is the URL redirected to.
+	Location string `json:"location"`
+	// Duration is the time from the request being sent to the redirect
+	// response being received.
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// PhaseTimings break down the duration of a Benchmark request into its
+// phases. DNSLookup, Connect and TLSHandshake are zero if an existing
+// connection was reused.
+type PhaseTimings struct {
+	DNSLookup    time.Duration `json:"dns_lookup_ns"`
+	Connect      time.Duration `json:"connect_ns"`
+	TLSHandshake time.Duration `json:"tls_handshake_ns"`
+	// TimeToFirstByte is the time from the request being written to the
+	// first response byte being received, i.e. server think time.
+	TimeToFirstByte time.Duration `json:"time_to_first_byte_ns"`
+	// ContentTransfer is the time from the first response byte being
+	// received to the response body being fully read.
+	ContentTransfer time.Duration `json:"content_transfer_ns"`
+}
+
+// BenchmarkStorer is responsible for storing and querying the Benchmark
+// history of URLs.
+type BenchmarkStorer interface {
+	Record(url string, benchmark Benchmark)
+	// Query returns the Benchmarks recorded for url between from and to
+	// (inclusive), sorted by most recent first and truncated to limit. A zero
+	// from or to leaves that end of the range unbounded.
+	Query(url string, from, to time.Time, limit int) []Benchmark
+}
+
+// ContentChange is a change of a URL's content, as detected by a change of its
+// Content's Hash. The first ContentChange of a URL has no PreviousHash.
+type ContentChange struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Hash         string    `json:"hash"`
+	PreviousHash string    `json:"previous_hash,omitempty"`
+}
+
+// ChangeStorer is responsible for storing and querying the ContentChange
+// history of URLs.
+type ChangeStorer interface {
+	Record(url string, change ContentChange)
+	// Query returns the ContentChanges recorded for url since from
+	// (inclusive), sorted by most recent first and truncated to limit. A zero
+	// from is unbounded.
+	Query(url string, from time.Time, limit int) []ContentChange
+}
+
+// BenchmarkStats are aggregated statistics of Benchmarks over a time window.
+// Latency statistics only account for successful Benchmarks.
+type BenchmarkStats struct {
+	Window     string        `json:"window"`
+	Count      int           `json:"count"`
+	ErrorCount int           `json:"error_count"`
+	ErrorRate  float64       `json:"error_rate"`
+	Min        time.Duration `json:"min_ns"`
+	Max        time.Duration `json:"max_ns"`
+	Mean       time.Duration `json:"mean_ns"`
+	P50        time.Duration `json:"p50_ns"`
+	P90        time.Duration `json:"p90_ns"`
+	P95        time.Duration `json:"p95_ns"`
+	P99        time.Duration `json:"p99_ns"`
+}
+
+// URLBenchmarkStats are the BenchmarkStats of a single URL for each window.
+type URLBenchmarkStats struct {
+	URL   string           `json:"url"`
+	Stats []BenchmarkStats `json:"stats"`
+}
+
+// BenchmarkAnalyser is responsible for aggregating Benchmark history into
+// BenchmarkStats over a set of time windows.
+type BenchmarkAnalyser interface {
+	// Stats aggregates the Benchmarks of url for each window.
+	Stats(url string) []BenchmarkStats
+	// OverallStats aggregates the Benchmarks of all stored URLs for each
+	// window, returning both the per-URL and combined statistics.
+	OverallStats() (overall []BenchmarkStats, urls []URLBenchmarkStats)
+}
+
+// URLCertificates are the TLS details of a single URL.
+type URLCertificates struct {
+	URL string `json:"url"`
+	TLSInfo
+}
+
+// CertificateMonitor is responsible for reporting the TLS certificates of
+// stored URLs.
+type CertificateMonitor interface {
+	// Certificates returns the TLS details of every stored HTTPS URL, sorted
+	// by soonest expiry first. Expiry is evaluated as of the call.
+	Certificates() []URLCertificates
+}
+
+// ExtractedValue is a version of a value extracted by an ExtractionRule.
+type ExtractedValue struct {
+	Timestamp time.Time `json:"timestamp"`
+	Rule      string    `json:"rule"`
+	// Value is a string or float64 as per the rule's type.
+	Value interface{} `json:"value"`
+}
+
+// ExtractionStorer is responsible for storing the version history of the
+// values extracted from each URL.
+type ExtractionStorer interface {
+	// Record stores value as the latest version of its rule for url, unless
+	// it is equal to the current version. It returns whether it was stored.
+	Record(url string, value ExtractedValue) bool
+	// Query returns the versions of url's extracted values since from
+	// (inclusive), optionally only of a single rule, sorted by most recent
+	// first and truncated to limit. A zero from is unbounded and an empty rule
+	// matches all rules.
+	Query(url, rule string, from time.Time, limit int) []ExtractedValue
+}
+
+// JobStatus is the lifecycle status of an ingestion Job.
+type JobStatus string
+
+const (
+	// JobQueued indicates the URL is waiting in the ingestion queue.
+	JobQueued JobStatus = "queued"
+	// JobValidating indicates the URL is being fetched for validation.
+	JobValidating JobStatus = "validating"
+	// JobStored indicates the URL was validated and stored.
+	JobStored JobStatus = "stored"
+	// JobRejected indicates the URL was discarded; see Job.Reason.
+	JobRejected JobStatus = "rejected"
+)
+
+// Job tracks the ingestion of a URL.
+type Job struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Status    JobStatus `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobTracker is responsible for tracking the lifecycle of ingestion Jobs.
+type JobTracker interface {
+	// Create creates a new queued Job for url.
+	Create(url string) Job
+	// Update transitions a Job to status, with an optional reason.
+	Update(id string, status JobStatus, reason string)
+	Get(id string) (Job, bool)
+}
+
+// CrawlSpec configures a crawl from a seed URL.
+type CrawlSpec struct {
+	// MaxDepth is the maximum number of links followed from the seed URL,
+	// where zero only crawls the seed URL. Unset uses the configured maximum.
+	MaxDepth *int `json:"max_depth,omitempty"`
+	// MaxPages is the maximum number of pages crawled, including the seed
+	// URL. Zero uses the configured maximum.
+	MaxPages int        `json:"max_pages,omitempty"`
+	Scope    CrawlScope `json:"scope"`
+}
+
+// CrawlScope determines which discovered links are crawled. A link must
+// satisfy every set condition.
+type CrawlScope struct {
+	// SameHost restricts links to the seed URL's host. Defaults to true.
+	SameHost *bool `json:"same_host,omitempty"`
+	// PathPrefix restricts links to paths with this prefix, e.g. "/docs/".
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Pattern is a regular expression which links must match.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// CrawlStatus is the lifecycle status of a Crawl.
+type CrawlStatus string
+
+const (
+	// CrawlRunning indicates pages of the crawl are waiting to be processed.
+	CrawlRunning CrawlStatus = "running"
+	// CrawlCompleted indicates every page of the crawl has been processed.
+	CrawlCompleted CrawlStatus = "completed"
+	// CrawlCancelled indicates the crawl was cancelled before every page was
+	// processed.
+	CrawlCancelled CrawlStatus = "cancelled"
+)
+
+// Crawl tracks the progress of a crawl from a seed URL and the link graph it
+// discovered.
+type Crawl struct {
+	ID       string        `json:"id"`
+	Seed     string        `json:"seed"`
+	Status   CrawlStatus   `json:"status"`
+	Spec     CrawlSpec     `json:"spec"`
+	Progress CrawlProgress `json:"progress"`
+	// Pages are the crawled pages in the order they were discovered.
+	Pages []CrawlPage `json:"pages"`
+	// Links are the in-scope links between pages.
+	Links     []CrawlLink `json:"links"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// CrawlProgress counts the URLs discovered by a Crawl.
+type CrawlProgress struct {
+	// Queued, Stored and Rejected count the crawled pages by status.
+	Queued   int `json:"queued"`
+	Stored   int `json:"stored"`
+	Rejected int `json:"rejected"`
+	// OutOfScope counts the unique discovered URLs outside the crawl's scope.
+	OutOfScope int `json:"out_of_scope"`
+	// Skipped counts the unique in-scope URLs which weren't crawled as the
+	// crawl reached its maximum pages.
+	Skipped int `json:"skipped"`
+}
+
+// CrawlPage is a page crawled by a Crawl.
+type CrawlPage struct {
+	URL string `json:"url"`
+	// Depth is the number of links followed from the seed URL.
+	Depth int `json:"depth"`
+	// JobID is the ingestion Job of the page.
+	JobID  string    `json:"job_id,omitempty"`
+	Status JobStatus `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// CrawlLink is a link from one page to another.
+type CrawlLink struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LinkCheckSpec configures a link check of either a single page or the stored
+// pages of a crawl.
+type LinkCheckSpec struct {
+	URL     string `json:"url,omitempty"`
+	CrawlID string `json:"crawl_id,omitempty"`
 }
 
+// LinkCheckStatus is the lifecycle status of a LinkCheck.
+type LinkCheckStatus string
+
+const (
+	// LinkCheckRunning indicates pages or links are waiting to be checked.
+	LinkCheckRunning LinkCheckStatus = "running"
+	// LinkCheckCompleted indicates every page and link has been checked.
+	LinkCheckCompleted LinkCheckStatus = "completed"
+	// LinkCheckAborted indicates the link check was stopped due to shutdown.
+	LinkCheckAborted LinkCheckStatus = "aborted"
+)
+
+// LinkCheck tracks the progress of checking the links and assets referenced
+// by a set of pages, and reports those which are broken.
+type LinkCheck struct {
+	ID       string            `json:"id"`
+	Spec     LinkCheckSpec     `json:"spec"`
+	Status   LinkCheckStatus   `json:"status"`
+	Progress LinkCheckProgress `json:"progress"`
+	// Broken are the references to broken links, ordered by page then by
+	// position within the page.
+	Broken []BrokenLink `json:"broken"`
+	// PageErrors describe each page which couldn't be fetched and parsed.
+	PageErrors []PageError `json:"page_errors,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// LinkCheckProgress counts the pages and links of a LinkCheck.
+type LinkCheckProgress struct {
+	// Pages counts the pages whose links are checked, and FailedPages those
+	// which couldn't be fetched.
+	Pages       int `json:"pages"`
+	FailedPages int `json:"failed_pages"`
+	// Links counts the unique links found, Checked those which have been
+	// checked and Broken those which are broken.
+	Links   int `json:"links"`
+	Checked int `json:"checked"`
+	Broken  int `json:"broken"`
+	// Skipped counts the unique links which weren't checked as the link
+	// check reached its maximum links.
+	Skipped int `json:"skipped"`
+}
+
+// LinkElement is the HTML element referencing a link.
+type LinkElement string
+
+const (
+	// LinkElementA is an anchor's href.
+	LinkElementA LinkElement = "a"
+	// LinkElementImg is an image's src.
+	LinkElementImg LinkElement = "img"
+	// LinkElementScript is a script's src.
+	LinkElementScript LinkElement = "script"
+	// LinkElementLink is a link's href, e.g. a stylesheet or icon.
+	LinkElementLink LinkElement = "link"
+)
+
+// LinkFailure is the reason a link is broken.
+type LinkFailure string
+
+const (
+	// LinkHTTPError indicates a 4xx or 5xx response status code.
+	LinkHTTPError LinkFailure = "http_error"
+	// LinkDNSFailure indicates the link's host couldn't be resolved.
+	LinkDNSFailure LinkFailure = "dns_failure"
+	// LinkTimeout indicates the request timed out.
+	LinkTimeout LinkFailure = "timeout"
+	// LinkRequestFailed indicates any other request failure, e.g. a refused
+	// connection or blocked destination.
+	LinkRequestFailed LinkFailure = "request_failed"
+)
+
+// BrokenLink is a reference from a page to a broken link.
+type BrokenLink struct {
+	// Page is the referring page.
+	Page    string      `json:"page"`
+	URL     string      `json:"url"`
+	Element LinkElement `json:"element"`
+	// Text is the anchor text of a link, or the alt text of an image.
+	Text       string      `json:"text,omitempty"`
+	Failure    LinkFailure `json:"failure"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// PageError is the reason a page's links couldn't be checked.
+type PageError struct {
+	Page  string `json:"page"`
+	Error string `json:"error"`
+}
+
+var (
+	// ErrInvalidURL is returned when an ingested URL is syntactically invalid.
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrInvalidSpec is returned when an ingested URLSpec is invalid.
+	ErrInvalidSpec = errors.New("invalid URL spec")
+	// ErrBackpressure is returned when an ingested URL couldn't be enqueued
+	// before the context expired.
+	ErrBackpressure = errors.New("request to enqueue expired")
+	// ErrClosed is returned when ingesting into a closed Ingester.
+	ErrClosed = errors.New("ingester is closed")
+	// ErrCrawlNotFound is returned when referencing a crawl which doesn't
+	// exist.
+	ErrCrawlNotFound = errors.New("crawl not found")
+)
+
 // Ingester is responsible for ingesting and processing URLs.
 type Ingester interface {
-	Ingest(ctx context.Context, url string) error
+	// Ingest enqueues a URL for ingestion, returning a Job which can be used
+	// to track its progress. spec configures how the URL is benchmarked and
+	// may be nil. ErrInvalidURL, ErrInvalidSpec, ErrBackpressure or ErrClosed
+	// are returned (wrapped) if the URL is not enqueued.
+	Ingest(ctx context.Context, url string, spec *URLSpec) (Job, error)
+	// Job fetches an ingestion Job by ID.
+	Job(id string) (Job, bool)
+	// Canonicalise returns the canonical form of a URL under which Ingest
+	// stores it, or ErrInvalidURL (wrapped) if the URL is syntactically
+	// invalid.
+	Canonicalise(url string) (string, error)
+	// Crawl enqueues a seed URL for ingestion, followed by the pages it links
+	// to within the scope and limits of crawl. spec configures how every page
+	// is benchmarked and may be nil. The same errors as Ingest are returned
+	// (wrapped) if the seed URL is not enqueued, and ErrInvalidSpec if crawl
+	// is invalid.
+	Crawl(ctx context.Context, seed string, spec *URLSpec, crawl CrawlSpec) (Crawl, error)
+	// CrawlStatus fetches a Crawl by ID.
+	CrawlStatus(id string) (Crawl, bool)
+	// CancelCrawl cancels a running Crawl by ID, returning false if it
+	// doesn't exist.
+	CancelCrawl(id string) (Crawl, bool)
+	// CheckLinks starts checking the links and assets referenced by the page
+	// or crawl of spec. ErrInvalidURL, ErrInvalidSpec, ErrCrawlNotFound or
+	// ErrClosed are returned (wrapped) if the link check isn't started.
+	CheckLinks(spec LinkCheckSpec) (LinkCheck, error)
+	// LinkCheckStatus fetches a LinkCheck by ID.
+	LinkCheckStatus(id string) (LinkCheck, bool)
 }
 
 // Client represents a client capable of performing HTTP requests.
 type Client interface {
 	Do(req *http.Request) (*http.Response, error)
 }
+
+// ErrBlockedDestination is returned (wrapped) by a Client when a request's
+// destination is prohibited by the destination policy.
+var ErrBlockedDestination = errors.New("destination is blocked")
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// maxBatchURLBytes is the maximum number of bytes per URL of a batch, used to
+// bound the size of a batch request body.
+const maxBatchURLBytes = 4096
+
+// batchStatus is the outcome of ingesting a single URL of a batch.
+type batchStatus string
+
+const (
+	batchAccepted batchStatus = "accepted"
+	batchInvalid  batchStatus = "invalid"
+	batchRefused  batchStatus = "refused"
+)
+
+type batchResult struct {
+	URL    string      `json:"url"`
+	Status batchStatus `json:"status"`
+	JobID  string      `json:"job_id,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Accepted int           `json:"accepted"`
+	Invalid  int           `json:"invalid"`
+	Refused  int           `json:"refused"`
+	Results  []batchResult `json:"results"`
+}
+
+// URLAction dispatches custom methods on the URL collection, i.e.
+// POST /urls:batch.
+func (s *Server) URLAction(c *gin.Context) {
+	switch c.Param("action") {
+	case ":batch":
+		s.AddURLBatch(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown URL action"})
+	}
+}
+
+// AddURLBatch accepts a batch of URLs to insert into the store, either as a
+// JSON array of URL strings or as a newline-delimited body. All URLs share a
+// single enqueue timeout; once it expires, any remaining URLs are refused. The
+// response reports whether each URL was accepted (with a job ID), rejected as
+// invalid or refused due to backpressure.
+func (s *Server) AddURLBatch(c *gin.Context) {
+	ctx := c.Request.Context()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(s.maxBatchSize)*maxBatchURLBytes)
+	urls, err := parseBatch(c.Request)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		msg := fmt.Sprintf("batch exceeds maximum size of %d bytes", tooLarge.Limit)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to decode batch URL request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if len(urls) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no URLs provided"})
+		return
+	}
+	if len(urls) > s.maxBatchSize {
+		msg := fmt.Sprintf("batch exceeds maximum size of %d URLs", s.maxBatchSize)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
+		return
+	}
+
+	resp := batchResponse{
+		Results: make([]batchResult, 0, len(urls)),
+	}
+	for _, url := range urls {
+		result := batchResult{URL: url}
+
+		job, err := s.ingester.Ingest(ctx, url, nil)
+		switch {
+		case err == nil:
+			result.Status = batchAccepted
+			result.JobID = job.ID
+			resp.Accepted++
+		case errors.Is(err, ports.ErrInvalidURL):
+			result.Status = batchInvalid
+			result.Error = err.Error()
+			resp.Invalid++
+		default:
+			result.Status = batchRefused
+			result.Error = err.Error()
+			resp.Refused++
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	s.logger.Info("ingested URL batch", zap.Int("accepted", resp.Accepted),
+		zap.Int("invalid", resp.Invalid), zap.Int("refused", resp.Refused))
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseBatch decodes the URLs of a batch request body. JSON is detected via
+// the Content-Type header or a leading '['; otherwise the body is treated as
+// newline-delimited, ignoring blank lines.
+func parseBatch(req *http.Request) ([]string, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if strings.Contains(req.Header.Get("Content-Type"), "json") || bytes.HasPrefix(trimmed, []byte("[")) {
+		var urls []string
+		if err := json.Unmarshal(trimmed, &urls); err != nil {
+			return nil, fmt.Errorf("failed to JSON decode body: %w", err)
+		}
+		return urls, nil
+	}
+
+	var urls []string
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	return urls, scanner.Err()
+}
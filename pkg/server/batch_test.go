@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestServer_AddURLBatch(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		contentType      string
+		body             string
+		expectedStatus   int
+		expectedStatuses []batchStatus
+	}{
+		{
+			name:             "JSON array",
+			path:             "/api/v1/urls:batch",
+			contentType:      "application/json",
+			body:             `["https://example.com", "not-a-url", "https://busy.example.com"]`,
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: []batchStatus{batchAccepted, batchInvalid, batchRefused},
+		},
+		{
+			name:             "newline-delimited",
+			path:             "/api/v1/urls:batch",
+			contentType:      "text/plain",
+			body:             "https://example.com\n\n  https://example.com/2  \nnot-a-url\n",
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: []batchStatus{batchAccepted, batchAccepted, batchInvalid},
+		},
+		{
+			name:             "JSON array without content type",
+			path:             "/api/v1/urls:batch",
+			body:             `  ["https://example.com"]`,
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: []batchStatus{batchAccepted},
+		},
+		{
+			name:           "exceeds maximum size",
+			path:           "/api/v1/urls:batch",
+			body:           "https://example.com/1\nhttps://example.com/2\nhttps://example.com/3\nhttps://example.com/4\n",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "exceeds maximum body size",
+			path:           "/api/v1/urls:batch",
+			body:           "https://example.com/" + strings.Repeat("a", 3*maxBatchURLBytes),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "empty batch",
+			path:           "/api/v1/urls:batch",
+			body:           "\n\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid JSON",
+			path:           "/api/v1/urls:batch",
+			contentType:    "application/json",
+			body:           `[1, 2]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown action",
+			path:           "/api/v1/urls:delete",
+			body:           "https://example.com",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(zap.NewNop(), 8080, 3, newTestDeps())
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp batchResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+			var actualStatuses []batchStatus
+			counts := map[batchStatus]int{}
+			for _, result := range resp.Results {
+				actualStatuses = append(actualStatuses, result.Status)
+				counts[result.Status]++
+				if result.Status == batchAccepted {
+					require.Equal(t, "job-1", result.JobID)
+				} else {
+					require.NotEmpty(t, result.Error)
+				}
+			}
+			require.Equal(t, tt.expectedStatuses, actualStatuses)
+			require.Equal(t, counts[batchAccepted], resp.Accepted)
+			require.Equal(t, counts[batchInvalid], resp.Invalid)
+			require.Equal(t, counts[batchRefused], resp.Refused)
+		})
+	}
+}
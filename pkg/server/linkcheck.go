@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+// linkCheckCSVHeader is the header row of a link check report in CSV form.
+var linkCheckCSVHeader = []string{"page", "url", "element", "text", "failure", "status_code", "error"}
+
+// AddLinkCheck starts checking the links and assets referenced by either a
+// single page or the stored pages of a crawl. The response contains the link
+// check, and its Location header points to where the report can be polled.
+func (s *Server) AddLinkCheck(c *gin.Context) {
+	spec := ports.LinkCheckSpec{}
+	if err := c.BindJSON(&spec); err != nil {
+		s.logger.Error("failed to JSON decode add link check request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	check, err := s.ingester.CheckLinks(spec)
+	if s.unavailable(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, ports.ErrInvalidURL) || errors.Is(err, ports.ErrInvalidSpec):
+		s.logger.Error("invalid link check provided", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ports.ErrCrawlNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		s.logger.Error("failed to start link check", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected error adding link check"})
+		return
+	}
+
+	c.Header("Location", "/api/v1/linkchecks/"+check.ID)
+	c.JSON(http.StatusAccepted, check)
+}
+
+// GetLinkCheck fetches a link check by ID, which reports its progress and
+// every reference to a broken link. The report is in JSON form, or in CSV form
+// containing only the broken links if the format query param is csv. Either
+// form is downloaded as an attachment if the download query param is true.
+func (s *Server) GetLinkCheck(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		const msg = "invalid format query param provided"
+		s.logger.Error(msg, zap.String("format", format))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var download bool
+	if downloadRaw, ok := c.GetQuery("download"); ok {
+		var err error
+		download, err = strconv.ParseBool(downloadRaw)
+		if err != nil {
+			const msg = "invalid download query param provided"
+			s.logger.Error(msg, zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	check, ok := s.ingester.LinkCheckStatus(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link check not found"})
+		return
+	}
+
+	if download {
+		c.Header("Content-Disposition", `attachment; filename="linkcheck-`+check.ID+"."+format+`"`)
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, check)
+		return
+	}
+
+	body, err := encodeBrokenLinksCSV(check.Broken)
+	if err != nil {
+		s.logger.Error("failed to CSV encode link check report", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected error encoding link check"})
+		return
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", body)
+}
+
+// encodeBrokenLinksCSV encodes broken links as CSV with a header row.
+func encodeBrokenLinksCSV(links []ports.BrokenLink) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.Write(linkCheckCSVHeader); err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		var statusCode string
+		if link.StatusCode != 0 {
+			statusCode = strconv.Itoa(link.StatusCode)
+		}
+		record := []string{link.Page, link.URL, string(link.Element), link.Text, string(link.Failure),
+			statusCode, link.Error}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func newTestServer() *Server {
+	return New(zap.NewNop(), 8080, 100, newTestDeps())
+}
+
+func TestServer_AddLinkCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "page",
+			body:           `{"url": "https://example.com"}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "crawl",
+			body:           `{"crawl_id": "crawl-1"}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "unknown crawl",
+			body:           `{"crawl_id": "unknown"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid spec",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid payload",
+			body:           `{"url": 1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "ingester closed",
+			body:           `{"url": "https://closed.example.com"}`,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	server := newTestServer()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/linkchecks", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusAccepted {
+				return
+			}
+			require.Equal(t, "/api/v1/linkchecks/check-1", rec.Header().Get("Location"))
+
+			var check ports.LinkCheck
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &check))
+			require.Equal(t, ports.LinkCheckRunning, check.Status)
+		})
+	}
+}
+
+func TestServer_GetLinkCheck(t *testing.T) {
+	tests := []struct {
+		name                string
+		path                string
+		expectedStatus      int
+		expectedContentType string
+		expectedDisposition string
+		expectedBody        string
+	}{
+		{
+			name:                "JSON",
+			path:                "/api/v1/linkchecks/check-1",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		{
+			name:                "JSON download",
+			path:                "/api/v1/linkchecks/check-1?format=json&download=true",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedDisposition: `attachment; filename="linkcheck-check-1.json"`,
+		},
+		{
+			name:                "CSV download",
+			path:                "/api/v1/linkchecks/check-1?format=csv&download=true",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedDisposition: `attachment; filename="linkcheck-check-1.csv"`,
+			expectedBody: "page,url,element,text,failure,status_code,error\n" +
+				`https://example.com/,https://example.com/gone,a,"Gone, ""really""",http_error,404,` + "\n" +
+				"https://example.com/,https://missing.invalid/logo.png,img,,dns_failure,,no such host\n",
+		},
+		{
+			name:           "invalid format",
+			path:           "/api/v1/linkchecks/check-1?format=xml",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid download",
+			path:           "/api/v1/linkchecks/check-1?download=maybe",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "not found",
+			path:           "/api/v1/linkchecks/unknown",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	server := newTestServer()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			require.Equal(t, tt.expectedContentType, rec.Header().Get("Content-Type"))
+			require.Equal(t, tt.expectedDisposition, rec.Header().Get("Content-Disposition"))
+			if tt.expectedBody != "" {
+				require.Equal(t, tt.expectedBody, rec.Body.String())
+				return
+			}
+
+			var check ports.LinkCheck
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &check))
+			require.Len(t, check.Broken, 2)
+		})
+	}
+}
@@ -2,32 +2,68 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/metrics"
 	"jemgunay/url-scraper/pkg/ports"
 )
 
+// retryAfterSeconds is how long clients are asked to wait before retrying a
+// request refused due to ingester backpressure.
+const retryAfterSeconds = "10"
+
 // Server provides a RESTful HTTP server for performing URL-related operations.
 type Server struct {
-	logger   config.Logger
-	ingester ports.Ingester
-	storage  ports.Storer
+	logger      config.Logger
+	ingester    ports.Ingester
+	storage     ports.Storer
+	benchmarks  ports.BenchmarkStorer
+	changes     ports.ChangeStorer
+	extractions ports.ExtractionStorer
+	analyser    ports.BenchmarkAnalyser
+	certs       ports.CertificateMonitor
+
+	maxBatchSize int
+	httpServer   *http.Server
+}
 
-	httpServer *http.Server
+// Deps are the dependencies which a Server serves requests from.
+type Deps struct {
+	Ingester     ports.Ingester
+	Storage      ports.Storer
+	Benchmarks   ports.BenchmarkStorer
+	Changes      ports.ChangeStorer
+	Extractions  ports.ExtractionStorer
+	Analyser     ports.BenchmarkAnalyser
+	Certificates ports.CertificateMonitor
+	// Registry is exposed by the metrics endpoint
+	Registry *metrics.Registry
 }
 
-// New initialises a new HTTP URL API server.
-func New(logger config.Logger, port int, ingester ports.Ingester, storage ports.Storer) *Server {
+// New initialises a new HTTP URL API server. maxBatchSize is the maximum number
+// of URLs accepted by a single batch submission.
+func New(logger config.Logger, port, maxBatchSize int, deps Deps) *Server {
 	server := &Server{
-		logger:   logger,
-		ingester: ingester,
-		storage:  storage,
+		logger:      logger,
+		ingester:    deps.Ingester,
+		storage:     deps.Storage,
+		benchmarks:  deps.Benchmarks,
+		changes:     deps.Changes,
+		extractions: deps.Extractions,
+		analyser:    deps.Analyser,
+		certs:       deps.Certificates,
+
+		maxBatchSize: maxBatchSize,
 	}
 
 	// disable gin debug logs
@@ -35,10 +71,29 @@ func New(logger config.Logger, port int, ingester ports.Ingester, storage ports.
 
 	// register routes in router
 	router := gin.Default()
+	// match routes against the escaped path so that URL path params may
+	// contain encoded slashes, e.g. /api/v1/urls/https%3A%2F%2Fexample.com
+	router.UseRawPath = true
+	router.GET("/metrics", gin.WrapH(deps.Registry.Handler()))
 	api := router.Group("/api")
 	v1 := api.Group("/v1")
 	v1.GET("/urls", server.GetURL)
 	v1.POST("/urls", server.AddURL)
+	// gin doesn't support literal colons in paths, so custom methods such as
+	// /urls:batch are matched by a wildcard and dispatched by URLAction
+	v1.POST("/urls:action", server.URLAction)
+	v1.GET("/urls/:url/benchmarks", server.GetBenchmarks)
+	v1.GET("/urls/:url/stats", server.GetURLStats)
+	v1.GET("/urls/:url/changes", server.GetChanges)
+	v1.GET("/urls/:url/extractions", server.GetExtractions)
+	v1.GET("/stats", server.GetStats)
+	v1.GET("/jobs/:id", server.GetJob)
+	v1.POST("/crawls", server.AddCrawl)
+	v1.GET("/crawls/:id", server.GetCrawl)
+	v1.DELETE("/crawls/:id", server.CancelCrawl)
+	v1.POST("/linkchecks", server.AddLinkCheck)
+	v1.GET("/linkchecks/:id", server.GetLinkCheck)
+	v1.GET("/certificates", server.GetCertificates)
 
 	server.httpServer = &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -53,14 +108,25 @@ func New(logger config.Logger, port int, ingester ports.Ingester, storage ports.
 }
 
 // Run binds the HTTP server. It is a blocking operation and always returns an
-// error on shutdown (on success or failure).
+// error on shutdown (on success or failure). After Shutdown is called, Run
+// returns http.ErrServerClosed.
 func (s *Server) Run() error {
 	return s.httpServer.ListenAndServe()
 }
 
+// Shutdown gracefully shuts down the HTTP server: it stops accepting new
+// connections and waits for in-flight requests to complete. If ctx expires
+// first, its error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
 // GetURL fetches the 50 most recently stored URLs with their submission count
 // in JSON form. It accepts query parameters for sort criteria (sortBy=age/
-// count, default age) and sort order (sortOrder=asc/desc, default desc).
+// count, default age), sort order (sortOrder=asc/desc, default desc), to only
+// include URLs whose content changed at or after a time (changedSince,
+// RFC3339) and a comma-separated list of optional fields to include (fields,
+// i.e. metadata, default none).
 func (s *Server) GetURL(c *gin.Context) {
 	sortBy := ports.Age
 	sortByRaw, ok := c.GetQuery("sortBy")
@@ -86,17 +152,88 @@ func (s *Server) GetURL(c *gin.Context) {
 		}
 	}
 
-	records := s.storage.Fetch(50, sortBy, sortOrder)
-	c.JSON(http.StatusOK, records)
+	fields, ok := s.parseFields(c)
+	if !ok {
+		return
+	}
+
+	changedSinceRaw, ok := c.GetQuery("changedSince")
+	if !ok {
+		records := s.storage.Fetch(50, sortBy, sortOrder)
+		c.JSON(http.StatusOK, fields.apply(records))
+		return
+	}
+
+	changedSince, err := time.Parse(time.RFC3339, changedSinceRaw)
+	if err != nil {
+		const msg = "invalid changedSince query param provided"
+		s.logger.Error(msg, zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// filter before truncating so that changed URLs aren't crowded out
+	records := make([]ports.Record, 0)
+	for _, record := range s.storage.Fetch(math.MaxInt, sortBy, sortOrder) {
+		if len(records) == 50 {
+			break
+		}
+		if record.Hash != "" && !record.LastChanged.Before(changedSince) {
+			records = append(records, record)
+		}
+	}
+	c.JSON(http.StatusOK, fields.apply(records))
+}
+
+// recordFields are the optional fields of a ports.Record to include in
+// responses.
+type recordFields struct {
+	metadata bool
+}
+
+// parseFields parses the fields query param. If it contains an unknown field,
+// a Bad Request response is written and false is returned.
+func (s *Server) parseFields(c *gin.Context) (recordFields, bool) {
+	var fields recordFields
+	fieldsRaw, ok := c.GetQuery("fields")
+	if !ok {
+		return fields, true
+	}
+
+	for _, field := range strings.Split(fieldsRaw, ",") {
+		switch strings.TrimSpace(field) {
+		case "":
+		case "metadata":
+			fields.metadata = true
+		default:
+			const msg = "invalid fields query param provided"
+			s.logger.Error(msg, zap.String("field", field))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return fields, false
+		}
+	}
+	return fields, true
+}
+
+// apply omits the fields of records which weren't requested.
+func (f recordFields) apply(records []ports.Record) []ports.Record {
+	if !f.metadata {
+		for i := range records {
+			records[i].Metadata = nil
+		}
+	}
+	return records
 }
 
 type addPayload struct {
 	URL string `json:"url"`
+	ports.URLSpec
 }
 
 // AddURL accepts a URL to insert into the store. The storage operation is
 // asynchronous and successful storage is not guaranteed despite an Accepted
-// response status code.
+// response status code. The response contains an ingestion job, and its
+// Location header points to where the job's outcome can be polled.
 func (s *Server) AddURL(c *gin.Context) {
 	// set a context timeout to prevent ingester backpressure from starving the
 	// server
@@ -111,11 +248,340 @@ func (s *Server) AddURL(c *gin.Context) {
 		return
 	}
 
-	if err := s.ingester.Ingest(ctx, payload.URL); err != nil {
+	job, err := s.ingester.Ingest(ctx, payload.URL, &payload.URLSpec)
+	if errors.Is(err, ports.ErrInvalidURL) || errors.Is(err, ports.ErrInvalidSpec) {
+		s.logger.Error("invalid URL provided", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if s.unavailable(c, err) {
+		return
+	}
+	if err != nil {
 		s.logger.Error("failed to ingest URL", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected error adding URL"})
 		return
 	}
 
-	c.Status(http.StatusAccepted)
+	c.Header("Location", "/api/v1/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetJob fetches an ingestion job by ID in JSON form, which reports whether
+// the submitted URL is queued, being validated, stored or rejected (with a
+// reason).
+func (s *Server) GetJob(c *gin.Context) {
+	job, ok := s.ingester.Job(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+type crawlPayload struct {
+	URL string `json:"url"`
+	ports.CrawlSpec
+	ports.URLSpec
+}
+
+// AddCrawl accepts a seed URL to crawl. The seed URL and the pages it links to
+// within the crawl's scope and limits are inserted into the store
+// asynchronously. The response contains the crawl, and its Location header
+// points to where the crawl's progress can be polled.
+func (s *Server) AddCrawl(c *gin.Context) {
+	// set a context timeout to prevent ingester backpressure from starving the
+	// server
+	ctx := c.Request.Context()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	payload := crawlPayload{}
+	if err := c.BindJSON(&payload); err != nil {
+		s.logger.Error("failed to JSON decode add crawl request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	crawl, err := s.ingester.Crawl(ctx, payload.URL, &payload.URLSpec, payload.CrawlSpec)
+	if errors.Is(err, ports.ErrInvalidURL) || errors.Is(err, ports.ErrInvalidSpec) {
+		s.logger.Error("invalid crawl provided", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if s.unavailable(c, err) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to start crawl", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected error adding crawl"})
+		return
+	}
+
+	c.Header("Location", "/api/v1/crawls/"+crawl.ID)
+	c.JSON(http.StatusAccepted, crawl)
+}
+
+// GetCrawl fetches a crawl by ID in JSON form, which reports its progress, the
+// status of each crawled page and the link graph discovered so far.
+func (s *Server) GetCrawl(c *gin.Context) {
+	crawl, ok := s.ingester.CrawlStatus(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "crawl not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, crawl)
+}
+
+// CancelCrawl cancels a running crawl by ID, responding with the cancelled
+// crawl in JSON form. Pages which have already been enqueued are still
+// ingested.
+func (s *Server) CancelCrawl(c *gin.Context) {
+	crawl, ok := s.ingester.CancelCrawl(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "crawl not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, crawl)
+}
+
+// GetBenchmarks fetches the benchmark history of a URL, sorted by most recent
+// first, in JSON form. The URL path param must be URL encoded. It accepts
+// query parameters for the time range (from/to, RFC3339, default unbounded) and
+// the maximum number of benchmarks to return (limit, default 100, max 1000).
+func (s *Server) GetBenchmarks(c *gin.Context) {
+	url, ok := s.urlParam(c)
+	if !ok {
+		return
+	}
+
+	var from, to time.Time
+	for param, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		raw, ok := c.GetQuery(param)
+		if !ok {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			msg := fmt.Sprintf("invalid %s query param provided", param)
+			s.logger.Error(msg, zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		*t = parsed
+	}
+
+	limit, ok := s.parseLimit(c)
+	if !ok {
+		return
+	}
+
+	benchmarks := s.benchmarks.Query(url, from, to, limit)
+	c.JSON(http.StatusOK, benchmarks)
+}
+
+// unavailable writes a Service Unavailable response if err is due to ingester
+// backpressure or the ingester being closed, both of which may be retried, and
+// returns whether it did. Backpressure responses include a Retry-After header.
+func (s *Server) unavailable(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, ports.ErrBackpressure):
+		s.logger.Warn("refusing request due to ingester backpressure", zap.Error(err))
+		c.Header("Retry-After", retryAfterSeconds)
+	case errors.Is(err, ports.ErrClosed):
+		s.logger.Warn("refusing request as ingester is closed", zap.Error(err))
+	default:
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	return true
+}
+
+// urlParam canonicalises the url path param so that it matches the key the URL
+// is stored under. If it is invalid, a Bad Request response is written and
+// false is returned.
+func (s *Server) urlParam(c *gin.Context) (string, bool) {
+	url, err := s.ingester.Canonicalise(c.Param("url"))
+	if err != nil {
+		const msg = "invalid URL provided"
+		s.logger.Error(msg, zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return "", false
+	}
+	return url, true
+}
+
+// parseLimit parses the limit query param (default 100, max 1000). If it is
+// invalid, a Bad Request response is written and false is returned.
+func (s *Server) parseLimit(c *gin.Context) (int, bool) {
+	limitRaw, ok := c.GetQuery("limit")
+	if !ok {
+		return 100, true
+	}
+
+	limit, err := strconv.Atoi(limitRaw)
+	if err != nil || limit < 1 || limit > 1000 {
+		const msg = "invalid limit query param provided"
+		s.logger.Error(msg, zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, false
+	}
+	return limit, true
+}
+
+// GetChanges fetches the content change history of a URL, sorted by most
+// recent first, in JSON form. The URL path param must be URL encoded. It
+// accepts query parameters for the start of the time range (from, RFC3339,
+// default unbounded) and the maximum number of changes to return (limit,
+// default 100, max 1000).
+func (s *Server) GetChanges(c *gin.Context) {
+	url, ok := s.urlParam(c)
+	if !ok {
+		return
+	}
+
+	var from time.Time
+	if fromRaw, ok := c.GetQuery("from"); ok {
+		var err error
+		from, err = time.Parse(time.RFC3339, fromRaw)
+		if err != nil {
+			const msg = "invalid from query param provided"
+			s.logger.Error(msg, zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	limit, ok := s.parseLimit(c)
+	if !ok {
+		return
+	}
+
+	changes := s.changes.Query(url, from, limit)
+	c.JSON(http.StatusOK, changes)
+}
+
+// GetExtractions fetches the version history of the values extracted from a
+// URL, sorted by most recent first, in JSON form. The URL path param must be
+// URL encoded. It accepts query parameters for the extraction rule (rule,
+// default all rules), the start of the time range (from, RFC3339, default
+// unbounded) and the maximum number of versions to return (limit, default
+// 100, max 1000).
+func (s *Server) GetExtractions(c *gin.Context) {
+	url, ok := s.urlParam(c)
+	if !ok {
+		return
+	}
+
+	var from time.Time
+	if fromRaw, ok := c.GetQuery("from"); ok {
+		var err error
+		from, err = time.Parse(time.RFC3339, fromRaw)
+		if err != nil {
+			const msg = "invalid from query param provided"
+			s.logger.Error(msg, zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	limit, ok := s.parseLimit(c)
+	if !ok {
+		return
+	}
+
+	values := s.extractions.Query(url, c.Query("rule"), from, limit)
+	c.JSON(http.StatusOK, values)
+}
+
+// GetURLStats fetches aggregated benchmark statistics of a URL in JSON form,
+// e.g. latency percentiles and error rate. The URL path param must be URL
+// encoded. Statistics are returned for each configured window unless the
+// window query param is provided.
+func (s *Server) GetURLStats(c *gin.Context) {
+	url, ok := s.urlParam(c)
+	if !ok {
+		return
+	}
+
+	stats, ok := s.filterWindow(c, s.analyser.Stats(url))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetStats fetches aggregated benchmark statistics of all stored URLs in JSON
+// form, both combined and per URL. Statistics are returned for each configured
+// window unless the window query param is provided.
+func (s *Server) GetStats(c *gin.Context) {
+	overall, urls := s.analyser.OverallStats()
+
+	overall, ok := s.filterWindow(c, overall)
+	if !ok {
+		return
+	}
+	for i := range urls {
+		urls[i].Stats, _ = s.filterWindow(c, urls[i].Stats)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"overall": overall,
+		"urls":    urls,
+	})
+}
+
+// GetCertificates fetches the TLS details of all stored HTTPS URLs, sorted by
+// soonest certificate expiry first, in JSON form. Only URLs with expiring
+// certificates are returned if the expiring query param is true.
+func (s *Server) GetCertificates(c *gin.Context) {
+	var expiringOnly bool
+	if expiringRaw, ok := c.GetQuery("expiring"); ok {
+		var err error
+		expiringOnly, err = strconv.ParseBool(expiringRaw)
+		if err != nil {
+			const msg = "invalid expiring query param provided"
+			s.logger.Error(msg, zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	certs := s.certs.Certificates()
+	if expiringOnly {
+		filtered := make([]ports.URLCertificates, 0, len(certs))
+		for _, cert := range certs {
+			if cert.Expiring {
+				filtered = append(filtered, cert)
+			}
+		}
+		certs = filtered
+	}
+
+	c.JSON(http.StatusOK, certs)
+}
+
+// filterWindow filters stats to the window specified by the window query param,
+// if provided. If the window doesn't exist, a Bad Request response is written
+// and false is returned.
+func (s *Server) filterWindow(c *gin.Context, stats []ports.BenchmarkStats) ([]ports.BenchmarkStats, bool) {
+	window, ok := c.GetQuery("window")
+	if !ok {
+		return stats, true
+	}
+
+	for _, stat := range stats {
+		if stat.Window == window {
+			return []ports.BenchmarkStats{stat}, true
+		}
+	}
+
+	const msg = "invalid window query param provided"
+	s.logger.Error(msg, zap.String("window", window))
+	c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	return nil, false
 }
@@ -2,34 +2,828 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
+	"jemgunay/url-scraper/pkg/metrics"
 	"jemgunay/url-scraper/pkg/ports"
 )
 
 type testIngester struct{}
 
-func (testIngester) Ingest(ctx context.Context, url string) error {
-	return nil
+func (testIngester) Ingest(ctx context.Context, url string, spec *ports.URLSpec) (ports.Job, error) {
+	if spec != nil && spec.Assertions != nil && len(spec.Assertions.StatusCodes) > 0 && spec.Assertions.StatusCodes[0] == "999" {
+		return ports.Job{}, fmt.Errorf("%w: invalid status code %q", ports.ErrInvalidSpec, "999")
+	}
+	switch url {
+	case "not-a-url":
+		return ports.Job{}, fmt.Errorf("%w: scheme must be http or https", ports.ErrInvalidURL)
+	case "https://busy.example.com":
+		return ports.Job{}, ports.ErrBackpressure
+	case "https://closed.example.com":
+		return ports.Job{}, ports.ErrClosed
+	}
+	return ports.Job{ID: "job-1", URL: url, Status: ports.JobQueued}, nil
+}
+
+func (testIngester) Job(id string) (ports.Job, bool) {
+	if id != "job-1" {
+		return ports.Job{}, false
+	}
+	return ports.Job{ID: id, URL: "https://example.com", Status: ports.JobRejected, Reason: "unexpected HTTP response status: 404 Not Found"}, true
+}
+
+func (testIngester) Canonicalise(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("%w: host must be provided", ports.ErrInvalidURL)
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+func (testIngester) Crawl(ctx context.Context, seed string, spec *ports.URLSpec, crawl ports.CrawlSpec) (ports.Crawl, error) {
+	if crawl.MaxDepth != nil && *crawl.MaxDepth > 3 {
+		return ports.Crawl{}, fmt.Errorf("%w: max depth must be between 0 and 3", ports.ErrInvalidSpec)
+	}
+	switch seed {
+	case "https://busy.example.com":
+		return ports.Crawl{}, ports.ErrBackpressure
+	case "https://closed.example.com":
+		return ports.Crawl{}, ports.ErrClosed
+	}
+	return ports.Crawl{ID: "crawl-1", Seed: seed, Status: ports.CrawlRunning, Spec: crawl}, nil
+}
+
+func (testIngester) CrawlStatus(id string) (ports.Crawl, bool) {
+	if id != "crawl-1" {
+		return ports.Crawl{}, false
+	}
+	return ports.Crawl{ID: id, Seed: "https://example.com/", Status: ports.CrawlCompleted,
+		Links: []ports.CrawlLink{{From: "https://example.com/", To: "https://example.com/a"}}}, true
+}
+
+func (testIngester) CancelCrawl(id string) (ports.Crawl, bool) {
+	if id != "crawl-1" {
+		return ports.Crawl{}, false
+	}
+	return ports.Crawl{ID: id, Seed: "https://example.com/", Status: ports.CrawlCancelled}, true
+}
+
+func (testIngester) CheckLinks(spec ports.LinkCheckSpec) (ports.LinkCheck, error) {
+	switch {
+	case spec.CrawlID == "unknown":
+		return ports.LinkCheck{}, ports.ErrCrawlNotFound
+	case spec.URL == "https://closed.example.com":
+		return ports.LinkCheck{}, ports.ErrClosed
+	case spec.URL == "" && spec.CrawlID == "":
+		return ports.LinkCheck{}, fmt.Errorf("%w: exactly one of url or crawl_id must be provided", ports.ErrInvalidSpec)
+	}
+	return ports.LinkCheck{ID: "check-1", Spec: spec, Status: ports.LinkCheckRunning}, nil
+}
+
+func (testIngester) LinkCheckStatus(id string) (ports.LinkCheck, bool) {
+	if id != "check-1" {
+		return ports.LinkCheck{}, false
+	}
+	return ports.LinkCheck{
+		ID:       id,
+		Spec:     ports.LinkCheckSpec{URL: "https://example.com/"},
+		Status:   ports.LinkCheckCompleted,
+		Progress: ports.LinkCheckProgress{Pages: 1, Links: 3, Checked: 3, Broken: 2},
+		Broken: []ports.BrokenLink{
+			{Page: "https://example.com/", URL: "https://example.com/gone", Element: ports.LinkElementA,
+				Text: `Gone, "really"`, Failure: ports.LinkHTTPError, StatusCode: 404},
+			{Page: "https://example.com/", URL: "https://missing.invalid/logo.png", Element: ports.LinkElementImg,
+				Failure: ports.LinkDNSFailure, Error: "no such host"},
+		},
+	}, true
 }
 
 type testStorage struct{}
 
-func (testStorage) Store(key string) {}
+func (testStorage) Store(key string, spec *ports.URLSpec) {}
 
 func (testStorage) Fetch(limit int, sortBy ports.SortBy, order ports.SortOrder) []ports.Record {
-	return []ports.Record{}
+	changedAt := time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC)
+	records := []ports.Record{
+		{Key: "https://a.example.com", LastChanged: changedAt, Content: ports.Content{Hash: "a"},
+			Metadata: &ports.Metadata{Title: "A"}},
+		{Key: "https://b.example.com", LastChanged: changedAt.Add(-time.Hour), Content: ports.Content{Hash: "b"}},
+		{Key: "https://c.example.com"},
+	}
+	if limit < len(records) {
+		records = records[:limit]
+	}
+	return records
+}
+
+func (testStorage) UpdateContent(key string, content ports.Content, at time.Time) (string, bool) {
+	return "", false
+}
+
+func (testStorage) UpdateTLS(key string, info ports.TLSInfo) {}
+
+func (testStorage) UpdateMetadata(key string, metadata ports.Metadata) {}
+
+type testBenchmarks struct {
+	url      string
+	from, to time.Time
+	limit    int
+}
+
+func (testBenchmarks) Record(url string, benchmark ports.Benchmark) {}
+
+func (b *testBenchmarks) Query(url string, from, to time.Time, limit int) []ports.Benchmark {
+	b.url, b.from, b.to, b.limit = url, from, to, limit
+	return []ports.Benchmark{{Timestamp: to, Status: "success", StatusCode: http.StatusOK}}
+}
+
+type testChanges struct {
+	url   string
+	from  time.Time
+	limit int
+}
+
+func (testChanges) Record(url string, change ports.ContentChange) {}
+
+func (c *testChanges) Query(url string, from time.Time, limit int) []ports.ContentChange {
+	c.url, c.from, c.limit = url, from, limit
+	return []ports.ContentChange{{Timestamp: from, Hash: "b", PreviousHash: "a"}}
+}
+
+type testExtractions struct {
+	url, rule string
+	from      time.Time
+	limit     int
+}
+
+func (testExtractions) Record(url string, value ports.ExtractedValue) bool {
+	return true
+}
+
+func (e *testExtractions) Query(url, rule string, from time.Time, limit int) []ports.ExtractedValue {
+	e.url, e.rule, e.from, e.limit = url, rule, from, limit
+	return []ports.ExtractedValue{{Timestamp: from, Rule: "price", Value: 12.5}}
+}
+
+type testAnalyser struct{}
+
+func (testAnalyser) Stats(url string) []ports.BenchmarkStats {
+	return []ports.BenchmarkStats{{Window: "1h"}, {Window: "24h"}}
+}
+
+func (testAnalyser) OverallStats() ([]ports.BenchmarkStats, []ports.URLBenchmarkStats) {
+	return []ports.BenchmarkStats{{Window: "1h"}, {Window: "24h"}}, nil
+}
+
+type testCertificates struct{}
+
+func (testCertificates) Certificates() []ports.URLCertificates {
+	expiresAt := time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC)
+	return []ports.URLCertificates{
+		{URL: "https://a.example.com", TLSInfo: ports.TLSInfo{ExpiresAt: expiresAt, Expiring: true}},
+		{URL: "https://b.example.com", TLSInfo: ports.TLSInfo{ExpiresAt: expiresAt.Add(time.Hour * 24 * 90)}},
+	}
+}
+
+// newTestDeps returns Deps backed by stubs, which tests may override.
+func newTestDeps() Deps {
+	return Deps{
+		Ingester:     &testIngester{},
+		Storage:      testStorage{},
+		Benchmarks:   &testBenchmarks{},
+		Changes:      &testChanges{},
+		Extractions:  &testExtractions{},
+		Analyser:     testAnalyser{},
+		Certificates: testCertificates{},
+		Registry:     metrics.NewRegistry(),
+	}
 }
 
 func TestNew_InvalidPort(t *testing.T) {
 	logger := zap.NewNop()
 	ingester := &testIngester{}
 	storage := testStorage{}
+	benchmarks := &testBenchmarks{}
 
-	server := New(logger, -1, ingester, storage)
+	deps := newTestDeps()
+	deps.Ingester = ingester
+	deps.Storage = storage
+	deps.Benchmarks = benchmarks
+	server := New(logger, -1, 100, deps)
 	err := server.Run()
 	require.ErrorContains(t, err, "listen tcp: address -1: invalid port")
 }
+
+func TestServer_GetBenchmarks(t *testing.T) {
+	const targetURL = "https://example.com/path?a=b"
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedFrom   time.Time
+		expectedTo     time.Time
+		expectedLimit  int
+	}{
+		{
+			name:           "defaults",
+			expectedStatus: http.StatusOK,
+			expectedLimit:  100,
+		},
+		{
+			name:           "time range and limit",
+			query:          "?from=2023-04-05T17:00:00Z&to=2023-04-05T18:00:00Z&limit=5",
+			expectedStatus: http.StatusOK,
+			expectedFrom:   time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC),
+			expectedTo:     time.Date(2023, 4, 5, 18, 0, 0, 0, time.UTC),
+			expectedLimit:  5,
+		},
+		{
+			name:           "invalid from",
+			query:          "?from=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid limit",
+			query:          "?limit=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			benchmarks := &testBenchmarks{}
+			deps := newTestDeps()
+			deps.Benchmarks = benchmarks
+			server := New(zap.NewNop(), 8080, 100, deps)
+
+			path := "/api/v1/urls/" + url.PathEscape(targetURL) + "/benchmarks" + tt.query
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			require.Equal(t, targetURL, benchmarks.url)
+			require.True(t, tt.expectedFrom.Equal(benchmarks.from))
+			require.True(t, tt.expectedTo.Equal(benchmarks.to))
+			require.Equal(t, tt.expectedLimit, benchmarks.limit)
+
+			var body []ports.Benchmark
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			require.Len(t, body, 1)
+		})
+	}
+}
+
+func TestServer_GetURL_ChangedSince(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedKeys   []string
+	}{
+		{
+			name:           "unfiltered",
+			expectedStatus: http.StatusOK,
+			expectedKeys:   []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"},
+		},
+		{
+			name:           "changed since",
+			query:          "?changedSince=2023-04-05T16:30:00Z",
+			expectedStatus: http.StatusOK,
+			expectedKeys:   []string{"https://a.example.com"},
+		},
+		{
+			name:           "inclusive",
+			query:          "?changedSince=2023-04-05T16:00:00Z",
+			expectedStatus: http.StatusOK,
+			expectedKeys:   []string{"https://a.example.com", "https://b.example.com"},
+		},
+		{
+			name:           "invalid changed since",
+			query:          "?changedSince=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/urls"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body []ports.Record
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			var actualKeys []string
+			for _, record := range body {
+				actualKeys = append(actualKeys, record.Key)
+			}
+			require.Equal(t, tt.expectedKeys, actualKeys)
+		})
+	}
+}
+
+func TestServer_GetURL_Fields(t *testing.T) {
+	tests := []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedMetadata bool
+	}{
+		{
+			name:           "metadata omitted by default",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:             "metadata included",
+			query:            "?fields=metadata",
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: true,
+		},
+		{
+			name:             "metadata included with changed since",
+			query:            "?fields=metadata&changedSince=2023-04-05T16:30:00Z",
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: true,
+		},
+		{
+			name:           "invalid field",
+			query:          "?fields=metadata,body",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/urls"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body []ports.Record
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			require.Equal(t, "https://a.example.com", body[0].Key)
+			if tt.expectedMetadata {
+				require.Equal(t, &ports.Metadata{Title: "A"}, body[0].Metadata)
+			} else {
+				require.Nil(t, body[0].Metadata)
+			}
+		})
+	}
+}
+
+func TestServer_GetChanges(t *testing.T) {
+	const targetURL = "https://example.com/path?a=b"
+
+	changes := &testChanges{}
+	deps := newTestDeps()
+	deps.Changes = changes
+	server := New(zap.NewNop(), 8080, 100, deps)
+
+	path := "/api/v1/urls/" + url.PathEscape(targetURL) + "/changes?from=2023-04-05T17:00:00Z&limit=5"
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, targetURL, changes.url)
+	require.True(t, time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC).Equal(changes.from))
+	require.Equal(t, 5, changes.limit)
+
+	var body []ports.ContentChange
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body, 1)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/urls/"+url.PathEscape(targetURL)+"/changes?from=yesterday", nil)
+	rec = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestServer_GetExtractions(t *testing.T) {
+	const targetURL = "https://example.com/path?a=b"
+
+	extractions := &testExtractions{}
+	deps := newTestDeps()
+	deps.Extractions = extractions
+	server := New(zap.NewNop(), 8080, 100, deps)
+
+	path := "/api/v1/urls/" + url.PathEscape(targetURL) + "/extractions?rule=price&from=2023-04-05T17:00:00Z&limit=5"
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, targetURL, extractions.url)
+	require.Equal(t, "price", extractions.rule)
+	require.True(t, time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC).Equal(extractions.from))
+	require.Equal(t, 5, extractions.limit)
+
+	var body []ports.ExtractedValue
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body, 1)
+	require.Equal(t, 12.5, body[0].Value)
+
+	for _, query := range []string{"from=yesterday", "limit=0"} {
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/urls/"+url.PathEscape(targetURL)+"/extractions?"+query, nil)
+		rec = httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestServer_URLParam(t *testing.T) {
+	const targetURL = "https://example.com/path?a=b"
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{
+			name:           "canonical",
+			url:            targetURL,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "non-canonical",
+			url:            "https://EXAMPLE.com/path?a=b#section",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid",
+			url:            "not-a-url",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			benchmarks, changes, extractions := &testBenchmarks{}, &testChanges{}, &testExtractions{}
+			deps := newTestDeps()
+			deps.Benchmarks = benchmarks
+			deps.Changes = changes
+			deps.Extractions = extractions
+			server := New(zap.NewNop(), 8080, 100, deps)
+
+			// every lookup by URL queries the URL's canonical form
+			for _, resource := range []string{"benchmarks", "changes", "extractions", "stats"} {
+				path := "/api/v1/urls/" + url.PathEscape(tt.url) + "/" + resource
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				rec := httptest.NewRecorder()
+				server.httpServer.Handler.ServeHTTP(rec, req)
+				require.Equal(t, tt.expectedStatus, rec.Code, resource)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			require.Equal(t, targetURL, benchmarks.url)
+			require.Equal(t, targetURL, changes.url)
+			require.Equal(t, targetURL, extractions.url)
+		})
+	}
+}
+
+func TestServer_GetURLStats(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		expectedStatus  int
+		expectedWindows []string
+	}{
+		{
+			name:            "all windows",
+			expectedStatus:  http.StatusOK,
+			expectedWindows: []string{"1h", "24h"},
+		},
+		{
+			name:            "single window",
+			query:           "?window=24h",
+			expectedStatus:  http.StatusOK,
+			expectedWindows: []string{"24h"},
+		},
+		{
+			name:           "unknown window",
+			query:          "?window=7d",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+			path := "/api/v1/urls/" + url.PathEscape("https://example.com") + "/stats" + tt.query
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body []ports.BenchmarkStats
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			var actualWindows []string
+			for _, stats := range body {
+				actualWindows = append(actualWindows, stats.Window)
+			}
+			require.Equal(t, tt.expectedWindows, actualWindows)
+		})
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	server := New(zap.NewNop(), 0, 100, newTestDeps())
+
+	runErr := make(chan error)
+	go func() {
+		runErr <- server.Run()
+	}()
+	// give the server a chance to bind
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+	require.ErrorIs(t, <-runErr, http.ErrServerClosed)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewCounter("scraper_ingests_total", "Total ingests.", "result").With("accepted").Inc()
+	deps := newTestDeps()
+	deps.Registry = registry
+	server := New(zap.NewNop(), 8080, 100, deps)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	require.Contains(t, rec.Body.String(), `scraper_ingests_total{result="accepted"} 1`)
+}
+
+func TestServer_AddURL(t *testing.T) {
+	server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", strings.NewReader(`{"url": "https://example.com"}`))
+	rec := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, "/api/v1/jobs/job-1", rec.Header().Get("Location"))
+
+	var job ports.Job
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	require.Equal(t, "job-1", job.ID)
+	require.Equal(t, ports.JobQueued, job.Status)
+}
+
+func TestServer_AddURL_Unavailable(t *testing.T) {
+	tests := []struct {
+		name               string
+		path               string
+		url                string
+		expectedRetryAfter string
+	}{
+		{"URL backpressure", "/api/v1/urls", "https://busy.example.com", "10"},
+		{"URL ingester closed", "/api/v1/urls", "https://closed.example.com", ""},
+		{"crawl backpressure", "/api/v1/crawls", "https://busy.example.com", "10"},
+		{"crawl ingester closed", "/api/v1/crawls", "https://closed.example.com", ""},
+	}
+
+	server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"url": "`+tt.url+`"}`))
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			require.Equal(t, tt.expectedRetryAfter, rec.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestServer_GetJob(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{
+			name:           "existing job",
+			id:             "job-1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown job",
+			id:             "job-2",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+tt.id, nil)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var job ports.Job
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+			require.Equal(t, ports.JobRejected, job.Status)
+			require.NotEmpty(t, job.Reason)
+		})
+	}
+}
+
+func TestServer_AddURL_Invalid(t *testing.T) {
+	server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", strings.NewReader(`{"url": "not-a-url"}`))
+	rec := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid URL: scheme must be http or https")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/urls",
+		strings.NewReader(`{"url": "https://example.com", "assertions": {"status_codes": ["999"]}}`))
+	rec = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid URL spec: invalid status code")
+}
+
+func TestServer_GetCertificates(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedURLs   []string
+	}{
+		{
+			name:           "all",
+			expectedStatus: http.StatusOK,
+			expectedURLs:   []string{"https://a.example.com", "https://b.example.com"},
+		},
+		{
+			name:           "expiring",
+			query:          "?expiring=true",
+			expectedStatus: http.StatusOK,
+			expectedURLs:   []string{"https://a.example.com"},
+		},
+		{
+			name:           "invalid_expiring",
+			query:          "?expiring=soon",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/certificates"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var certs []ports.URLCertificates
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &certs))
+			urls := make([]string, 0, len(certs))
+			for _, cert := range certs {
+				urls = append(urls, cert.URL)
+			}
+			require.Equal(t, tt.expectedURLs, urls)
+		})
+	}
+}
+
+func TestServer_Crawls(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "accepted",
+			body:           `{"url": "https://example.com", "max_depth": 2, "scope": {"path_prefix": "/docs/"}}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "invalid crawl spec",
+			body:           `{"url": "https://example.com", "max_depth": 4}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid payload",
+			body:           `{"url": 1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "backpressure",
+			body:           `{"url": "https://busy.example.com"}`,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "closed",
+			body:           `{"url": "https://closed.example.com"}`,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	server := New(zap.NewNop(), 8080, 100, newTestDeps())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/crawls", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusAccepted {
+				return
+			}
+			require.Equal(t, "/api/v1/crawls/crawl-1", rec.Header().Get("Location"))
+
+			var crawl ports.Crawl
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &crawl))
+			require.Equal(t, 2, *crawl.Spec.MaxDepth)
+			require.Equal(t, "/docs/", crawl.Spec.Scope.PathPrefix)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/crawls/crawl-1", nil)
+	rec := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var crawl ports.Crawl
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &crawl))
+	require.Equal(t, ports.CrawlCompleted, crawl.Status)
+	require.Len(t, crawl.Links, 1)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/crawls/unknown", nil)
+	rec = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/crawls/crawl-1", nil)
+	rec = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &crawl))
+	require.Equal(t, ports.CrawlCancelled, crawl.Status)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/crawls/unknown", nil)
+	rec = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
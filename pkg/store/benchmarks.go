@@ -0,0 +1,41 @@
+package store
+
+import (
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+var _ ports.BenchmarkStorer = (*BenchmarkStore)(nil)
+
+// BenchmarkStore is a concurrency-safe time-series store of Benchmarks per URL.
+// Benchmarks older than the retention period are pruned, as are the oldest
+// Benchmarks of a URL once it exceeds the per-URL capacity.
+type BenchmarkStore struct {
+	logger config.Logger
+	series *series[ports.Benchmark]
+}
+
+// NewBenchmarkStore initialises a new BenchmarkStore which retains up to
+// capacity Benchmarks per URL for the retention period.
+func NewBenchmarkStore(logger config.Logger, retention time.Duration, capacity int) *BenchmarkStore {
+	return &BenchmarkStore{
+		logger: logger,
+		series: newSeries(retention, capacity, func(benchmark ports.Benchmark) time.Time {
+			return benchmark.Timestamp
+		}),
+	}
+}
+
+// Record stores a Benchmark against a URL. Record is concurrency safe.
+func (b *BenchmarkStore) Record(url string, benchmark ports.Benchmark) {
+	b.series.record(url, benchmark, nil)
+}
+
+// Query returns the Benchmarks recorded for url between from and to
+// (inclusive), sorted by most recent first and truncated to limit. A zero from
+// or to leaves that end of the range unbounded. Query is concurrency safe.
+func (b *BenchmarkStore) Query(url string, from, to time.Time, limit int) []ports.Benchmark {
+	return b.series.query(url, from, to, limit, nil)
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestBenchmarkStore_Query(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	at := func(minutesAgo int) time.Time {
+		return now.Add(-time.Duration(minutesAgo) * time.Minute)
+	}
+
+	tests := []struct {
+		name               string
+		url                string
+		from, to           time.Time
+		limit              int
+		expectedTimestamps []time.Time
+	}{
+		{
+			name:               "unbounded range sorted by most recent",
+			url:                "url-1",
+			limit:              10,
+			expectedTimestamps: []time.Time{at(0), at(10), at(20), at(30)},
+		},
+		{
+			name:               "limit",
+			url:                "url-1",
+			limit:              2,
+			expectedTimestamps: []time.Time{at(0), at(10)},
+		},
+		{
+			name:               "inclusive time range",
+			url:                "url-1",
+			from:               at(20),
+			to:                 at(10),
+			limit:              10,
+			expectedTimestamps: []time.Time{at(10), at(20)},
+		},
+		{
+			name:               "expired benchmarks excluded",
+			url:                "url-2",
+			limit:              10,
+			expectedTimestamps: []time.Time{at(5)},
+		},
+		{
+			name:               "unknown URL",
+			url:                "url-3",
+			limit:              10,
+			expectedTimestamps: []time.Time{},
+		},
+	}
+
+	s := NewBenchmarkStore(zap.NewNop(), time.Hour, 4)
+	// url-1 exceeds capacity so the oldest benchmark should be dropped; the
+	// out of order record should still be sorted correctly
+	for _, minutesAgo := range []int{40, 30, 20, 0, 10} {
+		s.Record("url-1", ports.Benchmark{Timestamp: at(minutesAgo)})
+	}
+	s.Record("url-2", ports.Benchmark{Timestamp: at(90)})
+	s.Record("url-2", ports.Benchmark{Timestamp: at(5)})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			benchmarks := s.Query(tt.url, tt.from, tt.to, tt.limit)
+
+			actualTimestamps := []time.Time{}
+			for _, b := range benchmarks {
+				actualTimestamps = append(actualTimestamps, b.Timestamp)
+			}
+			require.Equal(t, tt.expectedTimestamps, actualTimestamps)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+var _ ports.ChangeStorer = (*ChangeStore)(nil)
+
+// ChangeStore is a concurrency-safe store of the ContentChange history of each
+// URL. ContentChanges older than the retention period are pruned, as are the
+// oldest ContentChanges of a URL once it exceeds the per-URL capacity.
+type ChangeStore struct {
+	logger  config.Logger
+	history *series[ports.ContentChange]
+}
+
+// NewChangeStore initialises a new ChangeStore which retains up to capacity
+// ContentChanges per URL for the retention period.
+func NewChangeStore(logger config.Logger, retention time.Duration, capacity int) *ChangeStore {
+	return &ChangeStore{
+		logger: logger,
+		history: newSeries(retention, capacity, func(change ports.ContentChange) time.Time {
+			return change.Timestamp
+		}),
+	}
+}
+
+// Record stores a ContentChange against a URL. Record is concurrency safe.
+func (c *ChangeStore) Record(url string, change ports.ContentChange) {
+	c.history.record(url, change, nil)
+}
+
+// Query returns the ContentChanges recorded for url since from (inclusive),
+// sorted by most recent first and truncated to limit. A zero from is
+// unbounded. Query is concurrency safe.
+func (c *ChangeStore) Query(url string, from time.Time, limit int) []ports.ContentChange {
+	return c.history.query(url, from, time.Time{}, limit, nil)
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestChangeStore_Query(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	at := func(minutesAgo int) time.Time {
+		return now.Add(-time.Duration(minutesAgo) * time.Minute)
+	}
+
+	tests := []struct {
+		name               string
+		url                string
+		from               time.Time
+		limit              int
+		expectedTimestamps []time.Time
+	}{
+		{
+			name:               "unbounded range sorted by most recent",
+			url:                "url-1",
+			limit:              10,
+			expectedTimestamps: []time.Time{at(0), at(10), at(20)},
+		},
+		{
+			name:               "limit",
+			url:                "url-1",
+			limit:              1,
+			expectedTimestamps: []time.Time{at(0)},
+		},
+		{
+			name:               "inclusive from",
+			url:                "url-1",
+			from:               at(10),
+			limit:              10,
+			expectedTimestamps: []time.Time{at(0), at(10)},
+		},
+		{
+			name:               "expired changes excluded",
+			url:                "url-2",
+			limit:              10,
+			expectedTimestamps: []time.Time{at(5)},
+		},
+		{
+			name:               "unknown URL",
+			url:                "url-3",
+			limit:              10,
+			expectedTimestamps: []time.Time{},
+		},
+	}
+
+	s := NewChangeStore(zap.NewNop(), time.Hour, 3)
+	// url-1 exceeds capacity so the oldest change should be dropped
+	for _, minutesAgo := range []int{30, 20, 10, 0} {
+		s.Record("url-1", ports.ContentChange{Timestamp: at(minutesAgo)})
+	}
+	s.Record("url-2", ports.ContentChange{Timestamp: at(90)})
+	s.Record("url-2", ports.ContentChange{Timestamp: at(5)})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := s.Query(tt.url, tt.from, tt.limit)
+
+			actualTimestamps := []time.Time{}
+			for _, c := range changes {
+				actualTimestamps = append(actualTimestamps, c.Timestamp)
+			}
+			require.Equal(t, tt.expectedTimestamps, actualTimestamps)
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/metrics"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+var (
+	_ ports.Storer          = (*DiskStore)(nil)
+	_ ports.BenchmarkStorer = (*DiskBenchmarkStore)(nil)
+)
+
+const (
+	logFileName      = "records.log"
+	snapshotFileName = "records.snapshot"
+)
+
+// DiskStore is a Store which persists every write to an append-only log on
+// disk. The log is periodically compacted into a snapshot so that it doesn't
+// grow unbounded. On initialisation, the snapshot is loaded and the log is
+// replayed on top of it, restoring the state of the store prior to shutdown
+// or crash. The benchmark history of each URL is persisted alongside the
+// records via the BenchmarkStorer returned by Benchmarks.
+type DiskStore struct {
+	logger     config.Logger
+	mem        *Store
+	benchmarks *BenchmarkStore
+
+	// mu serialises writes so that the in-memory store and the log are
+	// always applied in the same order
+	mu      *sync.Mutex
+	dir     string
+	logFile *os.File
+	seq     uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// logEntry is a single write operation appended to the log. Entries with
+// Content, TLS or Metadata are updates of that field and entries with a
+// Benchmark record it against the key, otherwise they are upserts.
+type logEntry struct {
+	Seq        uint64           `json:"seq"`
+	Key        string           `json:"key"`
+	UpsertedAt time.Time        `json:"ts"`
+	Spec       *ports.URLSpec   `json:"spec,omitempty"`
+	Content    *ports.Content   `json:"content,omitempty"`
+	TLS        *ports.TLSInfo   `json:"tls,omitempty"`
+	Metadata   *ports.Metadata  `json:"metadata,omitempty"`
+	Benchmark  *ports.Benchmark `json:"benchmark,omitempty"`
+}
+
+// snapshot is a compacted copy of the store at the time the log entry with
+// sequence number Seq was applied.
+type snapshot struct {
+	Seq        uint64                       `json:"seq"`
+	Records    []ports.Record               `json:"records"`
+	Benchmarks map[string][]ports.Benchmark `json:"benchmarks,omitempty"`
+}
+
+// NewDisk initialises a new DiskStore, restoring any state previously
+// persisted to dir, including the history of benchmarks. A compacted snapshot
+// is taken every snapshotInterval.
+func NewDisk(logger config.Logger, recordCapacity int, dir string, snapshotInterval time.Duration,
+	benchmarks *BenchmarkStore) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	s := &DiskStore{
+		logger:     logger,
+		mem:        New(logger, recordCapacity),
+		benchmarks: benchmarks,
+		mu:         &sync.Mutex{},
+		dir:        dir,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	if err := s.replayLog(); err != nil {
+		return nil, fmt.Errorf("failed to replay log: %w", err)
+	}
+	// evictions which occurred during replay have already been accounted for
+	s.mem.evictions = 0
+
+	logger.Info("restored store from disk", zap.String("dir", dir),
+		zap.Int("record_count", len(s.mem.recordList)), zap.Uint64("seq", s.seq))
+
+	go s.startSnapshotter(snapshotInterval)
+
+	return s, nil
+}
+
+// Store stores a key into the store, or bumps the count if it has been
+// previously stored. The record's URLSpec is replaced by spec, unless spec is
+// nil. The write is persisted to the log before Store returns. Store is
+// concurrency safe.
+func (s *DiskStore) Store(key string, spec *ports.URLSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := logEntry{
+		Seq:        s.seq + 1,
+		Key:        key,
+		UpsertedAt: time.Now().UTC(),
+		Spec:       spec,
+	}
+
+	s.mem.mu.Lock()
+	s.mem.upsert(entry.Key, entry.UpsertedAt, entry.Spec)
+	s.mem.mu.Unlock()
+	s.seq = entry.Seq
+
+	if err := s.appendLog(entry); err != nil {
+		s.logger.Error("failed to persist record to log", zap.Error(err), zap.String("key", key))
+	}
+}
+
+// UpdateContent sets the content of a stored key, bumping its last changed
+// time to at if the content's hash differs from the previous one. It returns
+// the previous hash and whether the content changed. Only modifications are
+// persisted to the log. UpdateContent is concurrency safe.
+func (s *DiskStore) UpdateContent(key string, content ports.Content, at time.Time) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mem.mu.Lock()
+	previous, changed, modified := s.mem.updateContent(key, content, at)
+	s.mem.mu.Unlock()
+	if !modified {
+		return previous, false
+	}
+
+	s.seq++
+	entry := logEntry{
+		Seq:        s.seq,
+		Key:        key,
+		UpsertedAt: at,
+		Content:    &content,
+	}
+	if err := s.appendLog(entry); err != nil {
+		s.logger.Error("failed to persist content update to log", zap.Error(err), zap.String("key", key))
+	}
+	return previous, changed
+}
+
+// UpdateTLS sets the TLS info of a stored key. Keys which aren't stored are
+// ignored. Only modifications are persisted to the log. UpdateTLS is
+// concurrency safe.
+func (s *DiskStore) UpdateTLS(key string, info ports.TLSInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mem.mu.Lock()
+	modified := s.mem.updateTLS(key, info)
+	s.mem.mu.Unlock()
+	if !modified {
+		return
+	}
+
+	s.seq++
+	entry := logEntry{
+		Seq:        s.seq,
+		Key:        key,
+		UpsertedAt: time.Now().UTC(),
+		TLS:        &info,
+	}
+	if err := s.appendLog(entry); err != nil {
+		s.logger.Error("failed to persist TLS update to log", zap.Error(err), zap.String("key", key))
+	}
+}
+
+// UpdateMetadata sets the metadata of a stored key. Keys which aren't stored
+// are ignored. Only modifications are persisted to the log. UpdateMetadata is
+// concurrency safe.
+func (s *DiskStore) UpdateMetadata(key string, metadata ports.Metadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mem.mu.Lock()
+	modified := s.mem.updateMetadata(key, metadata)
+	s.mem.mu.Unlock()
+	if !modified {
+		return
+	}
+
+	s.seq++
+	entry := logEntry{
+		Seq:        s.seq,
+		Key:        key,
+		UpsertedAt: time.Now().UTC(),
+		Metadata:   &metadata,
+	}
+	if err := s.appendLog(entry); err != nil {
+		s.logger.Error("failed to persist metadata update to log", zap.Error(err), zap.String("key", key))
+	}
+}
+
+// Benchmarks returns a BenchmarkStorer which persists Benchmarks to the log
+// before recording them.
+func (s *DiskStore) Benchmarks() *DiskBenchmarkStore {
+	return &DiskBenchmarkStore{store: s}
+}
+
+// DiskBenchmarkStore is a BenchmarkStorer which persists the Benchmarks of a
+// DiskStore.
+type DiskBenchmarkStore struct {
+	store *DiskStore
+}
+
+// Record stores a Benchmark against a URL. The write is persisted to the log
+// before Record returns. Record is concurrency safe.
+func (b *DiskBenchmarkStore) Record(url string, benchmark ports.Benchmark) {
+	s := b.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.benchmarks.Record(url, benchmark)
+
+	s.seq++
+	entry := logEntry{
+		Seq:        s.seq,
+		Key:        url,
+		UpsertedAt: benchmark.Timestamp,
+		Benchmark:  &benchmark,
+	}
+	if err := s.appendLog(entry); err != nil {
+		s.logger.Error("failed to persist benchmark to log", zap.Error(err), zap.String("key", url))
+	}
+}
+
+// Query returns the Benchmarks recorded for url between from and to
+// (inclusive), sorted by most recent first and truncated to limit. A zero from
+// or to leaves that end of the range unbounded. Query is concurrency safe.
+func (b *DiskBenchmarkStore) Query(url string, from, to time.Time, limit int) []ports.Benchmark {
+	return b.store.benchmarks.Query(url, from, to, limit)
+}
+
+// Fetch fetches records given the specified criteria. Records are truncated to
+// the required limit, and are sorted as requested by sortBy and sortOrder.
+func (s *DiskStore) Fetch(limit int, sortBy ports.SortBy, sortOrder ports.SortOrder) []ports.Record {
+	return s.mem.Fetch(limit, sortBy, sortOrder)
+}
+
+// RegisterMetrics registers the store size and eviction metrics.
+func (s *DiskStore) RegisterMetrics(registry *metrics.Registry) {
+	s.mem.RegisterMetrics(registry)
+}
+
+// Snapshot compacts the current state of the store into a snapshot on disk and
+// truncates the log.
+func (s *DiskStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshot()
+}
+
+// Close stops the periodic snapshotter, takes a final snapshot and closes the
+// log file.
+func (s *DiskStore) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.snapshot(); err != nil {
+		s.logFile.Close()
+		return err
+	}
+	return s.logFile.Close()
+}
+
+func (s *DiskStore) startSnapshotter(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				s.logger.Error("failed to snapshot store", zap.Error(err))
+				continue
+			}
+			s.logger.Debug("successfully snapshotted store")
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *DiskStore) appendLog(entry logEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to JSON encode log entry: %w", err)
+	}
+	if _, err := s.logFile.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write log entry: %w", err)
+	}
+	return s.logFile.Sync()
+}
+
+// snapshot writes the snapshot to a temporary file before atomically renaming
+// it over the previous snapshot, so that a crash mid-write never leaves a
+// corrupt snapshot behind. The caller must hold mu.
+func (s *DiskStore) snapshot() error {
+	s.mem.mu.RLock()
+	snap := snapshot{
+		Seq:     s.seq,
+		Records: s.mem.records(),
+	}
+	s.mem.mu.RUnlock()
+	snap.Benchmarks = s.benchmarks.series.all()
+
+	tmpPath := filepath.Join(s.dir, snapshotFileName+".tmp")
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	if err := json.NewEncoder(f).Encode(snap); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to JSON encode snapshot: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync snapshot file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("failed to rename snapshot file: %w", err)
+	}
+
+	// entries up to seq are now captured by the snapshot; if we crash before
+	// the log is truncated, they are skipped on replay
+	if err := s.logFile.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate log: %w", err)
+	}
+	if _, err := s.logFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek log: %w", err)
+	}
+	return nil
+}
+
+func (s *DiskStore) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot file: %w", err)
+	}
+	defer f.Close()
+
+	snap := snapshot{}
+	if err := json.NewDecoder(f).Decode(&snap); err != nil {
+		return fmt.Errorf("failed to JSON decode snapshot: %w", err)
+	}
+
+	s.seq = snap.Seq
+	s.mem.mu.Lock()
+	s.mem.restore(snap.Records)
+	s.mem.mu.Unlock()
+	s.benchmarks.series.restore(snap.Benchmarks)
+	return nil
+}
+
+// replayLog applies all log entries newer than the snapshot to the store and
+// opens the log for appending. A torn trailing entry (i.e. from a crash
+// mid-write) is truncated from the log.
+func (s *DiskStore) replayLog() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, logFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	var offset int64
+	reader := bufio.NewReader(f)
+	s.mem.mu.Lock()
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// EOF with a partial line left over is a torn write
+			break
+		}
+
+		entry := logEntry{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			s.logger.Warn("discarding corrupt log entry", zap.Error(err), zap.Int64("offset", offset))
+			break
+		}
+		offset += int64(len(line))
+
+		if entry.Seq <= s.seq {
+			continue
+		}
+		switch {
+		case entry.Content != nil:
+			s.mem.updateContent(entry.Key, *entry.Content, entry.UpsertedAt)
+		case entry.TLS != nil:
+			s.mem.updateTLS(entry.Key, *entry.TLS)
+		case entry.Metadata != nil:
+			s.mem.updateMetadata(entry.Key, *entry.Metadata)
+		case entry.Benchmark != nil:
+			s.benchmarks.Record(entry.Key, *entry.Benchmark)
+		default:
+			s.mem.upsert(entry.Key, entry.UpsertedAt, entry.Spec)
+		}
+		s.seq = entry.Seq
+	}
+	s.mem.mu.Unlock()
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to truncate torn log entries: %w", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to seek log: %w", err)
+	}
+
+	s.logFile = f
+	return nil
+}
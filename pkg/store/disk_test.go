@@ -0,0 +1,122 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestDiskStore_Restore(t *testing.T) {
+	tests := []struct {
+		name string
+		// shutdown is performed on the store before it is reopened
+		shutdown func(t *testing.T, s *DiskStore)
+	}{
+		{
+			name: "replay log after crash",
+			shutdown: func(t *testing.T, s *DiskStore) {
+				// simulate a crash by closing the log without snapshotting
+				close(s.stop)
+				<-s.done
+				require.NoError(t, s.logFile.Close())
+			},
+		},
+		{
+			name: "load snapshot after graceful close",
+			shutdown: func(t *testing.T, s *DiskStore) {
+				require.NoError(t, s.Close())
+			},
+		},
+		{
+			name: "load snapshot and replay log",
+			shutdown: func(t *testing.T, s *DiskStore) {
+				require.NoError(t, s.Snapshot())
+				s.Store("url-10", nil)
+				close(s.stop)
+				<-s.done
+				require.NoError(t, s.logFile.Close())
+			},
+		},
+	}
+
+	logger := zap.NewNop()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s, err := NewDisk(logger, 5, dir, time.Hour, NewBenchmarkStore(logger, time.Hour, 10))
+			require.NoError(t, err)
+			populate(s, 10)
+			s.Store("url-9", &ports.URLSpec{Assertions: &ports.Assertions{StatusCodes: []string{"204"}}})
+			s.UpdateContent("url-8", ports.Content{Hash: "hash"}, time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC))
+			s.UpdateTLS("url-7", ports.TLSInfo{Version: "TLS 1.3"})
+			s.UpdateMetadata("url-6", ports.Metadata{Title: "title"})
+			now := time.Now().UTC()
+			for i := 0; i < 3; i++ {
+				s.Benchmarks().Record("url-9", ports.Benchmark{Timestamp: now.Add(time.Duration(i) * time.Second), Status: "success"})
+			}
+			tt.shutdown(t, s)
+			expected := s.Fetch(5, ports.Age, ports.Descending)
+			expectedBenchmarks := s.Benchmarks().Query("url-9", time.Time{}, time.Time{}, 10)
+			require.Len(t, expectedBenchmarks, 3)
+
+			restored, err := NewDisk(logger, 5, dir, time.Hour, NewBenchmarkStore(logger, time.Hour, 10))
+			require.NoError(t, err)
+			defer restored.Close()
+
+			records := restored.Fetch(5, ports.Age, ports.Descending)
+			require.Equal(t, expected, records)
+			for _, record := range records {
+				require.Equal(t, record.Key == "url-9", record.Assertions != nil)
+				require.Equal(t, record.Key == "url-8", record.Hash == "hash")
+				require.Equal(t, record.Key == "url-7", record.TLS != nil)
+				require.Equal(t, record.Key == "url-6", record.Metadata != nil)
+			}
+			require.Equal(t, expectedBenchmarks, restored.Benchmarks().Query("url-9", time.Time{}, time.Time{}, 10))
+		})
+	}
+}
+
+func TestDiskStore_TornLogEntry(t *testing.T) {
+	logger := zap.NewNop()
+	dir := t.TempDir()
+
+	s, err := NewDisk(logger, 5, dir, time.Hour, NewBenchmarkStore(logger, time.Hour, 10))
+	require.NoError(t, err)
+	populate(s, 3)
+	close(s.stop)
+	<-s.done
+	require.NoError(t, s.logFile.Close())
+	expected := s.Fetch(5, ports.Age, ports.Descending)
+
+	// simulate a crash part way through appending an entry
+	f, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":7,"key":"url-`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restored, err := NewDisk(logger, 5, dir, time.Hour, NewBenchmarkStore(logger, time.Hour, 10))
+	require.NoError(t, err)
+	require.Equal(t, expected, restored.Fetch(5, ports.Age, ports.Descending))
+
+	// subsequent writes should be appended after the last intact entry
+	restored.Store("url-4", nil)
+	close(restored.stop)
+	<-restored.done
+	require.NoError(t, restored.logFile.Close())
+
+	restoredAgain, err := NewDisk(logger, 5, dir, time.Hour, NewBenchmarkStore(logger, time.Hour, 10))
+	require.NoError(t, err)
+	defer restoredAgain.Close()
+	records := restoredAgain.Fetch(5, ports.Age, ports.Descending)
+	require.Len(t, records, 4)
+	require.Equal(t, "url-4", records[0].Key)
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+var _ ports.ExtractionStorer = (*ExtractionStore)(nil)
+
+// ExtractionStore is a concurrency-safe store of the version history of the
+// values extracted from each URL. A version is only stored when a value
+// differs from the current version of its rule. Versions older than the
+// retention period are pruned, as are the oldest versions of a URL once it
+// exceeds the per-URL capacity.
+type ExtractionStore struct {
+	logger  config.Logger
+	history *series[ports.ExtractedValue]
+}
+
+// NewExtractionStore initialises a new ExtractionStore which retains up to
+// capacity versions per URL for the retention period.
+func NewExtractionStore(logger config.Logger, retention time.Duration, capacity int) *ExtractionStore {
+	return &ExtractionStore{
+		logger: logger,
+		history: newSeries(retention, capacity, func(value ports.ExtractedValue) time.Time {
+			return value.Timestamp
+		}),
+	}
+}
+
+// Record stores value as the latest version of its rule for url, unless it is
+// equal to the current version. Record is concurrency safe.
+func (e *ExtractionStore) Record(url string, value ports.ExtractedValue) bool {
+	return e.history.record(url, value, func(history []ports.ExtractedValue) bool {
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Rule == value.Rule {
+				return history[i].Value != value.Value
+			}
+		}
+		return true
+	})
+}
+
+// Query returns the versions of url's extracted values since from
+// (inclusive), only of rule unless it is empty, sorted by most recent first
+// and truncated to limit. A zero from is unbounded. Query is concurrency safe.
+func (e *ExtractionStore) Query(url, rule string, from time.Time, limit int) []ports.ExtractedValue {
+	return e.history.query(url, from, time.Time{}, limit, func(value ports.ExtractedValue) bool {
+		return rule == "" || value.Rule == rule
+	})
+}
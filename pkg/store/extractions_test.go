@@ -0,0 +1,91 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestExtractionStore_Record(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	at := func(minutesAgo int) time.Time {
+		return now.Add(-time.Duration(minutesAgo) * time.Minute)
+	}
+
+	s := NewExtractionStore(zap.NewNop(), time.Hour, 4)
+	require.True(t, s.Record("url-1", ports.ExtractedValue{Timestamp: at(30), Rule: "price", Value: 10.0}))
+	require.True(t, s.Record("url-1", ports.ExtractedValue{Timestamp: at(30), Rule: "title", Value: "Widget"}))
+	// unchanged values aren't versioned, even if interleaved with other rules
+	require.False(t, s.Record("url-1", ports.ExtractedValue{Timestamp: at(20), Rule: "price", Value: 10.0}))
+	require.True(t, s.Record("url-1", ports.ExtractedValue{Timestamp: at(20), Rule: "title", Value: "Widget 2"}))
+	require.False(t, s.Record("url-1", ports.ExtractedValue{Timestamp: at(10), Rule: "title", Value: "Widget 2"}))
+	require.True(t, s.Record("url-1", ports.ExtractedValue{Timestamp: at(10), Rule: "price", Value: 12.5}))
+	// url-1 exceeds capacity so the oldest version should be dropped
+	require.True(t, s.Record("url-1", ports.ExtractedValue{Timestamp: at(0), Rule: "price", Value: 10.0}))
+	// a value whose type changed is a new version
+	require.True(t, s.Record("url-2", ports.ExtractedValue{Timestamp: at(90), Rule: "price", Value: "10"}))
+	require.True(t, s.Record("url-2", ports.ExtractedValue{Timestamp: at(5), Rule: "price", Value: 10.0}))
+
+	tests := []struct {
+		name           string
+		url            string
+		rule           string
+		from           time.Time
+		limit          int
+		expectedValues []interface{}
+	}{
+		{
+			name:           "all rules sorted by most recent",
+			url:            "url-1",
+			limit:          10,
+			expectedValues: []interface{}{10.0, 12.5, "Widget 2", "Widget"},
+		},
+		{
+			name:           "single rule",
+			url:            "url-1",
+			rule:           "price",
+			limit:          10,
+			expectedValues: []interface{}{10.0, 12.5},
+		},
+		{
+			name:           "limit",
+			url:            "url-1",
+			rule:           "title",
+			limit:          1,
+			expectedValues: []interface{}{"Widget 2"},
+		},
+		{
+			name:           "inclusive from",
+			url:            "url-1",
+			from:           at(10),
+			limit:          10,
+			expectedValues: []interface{}{10.0, 12.5},
+		},
+		{
+			name:           "expired versions excluded",
+			url:            "url-2",
+			limit:          10,
+			expectedValues: []interface{}{10.0},
+		},
+		{
+			name:           "unknown URL",
+			url:            "url-3",
+			limit:          10,
+			expectedValues: []interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualValues := []interface{}{}
+			for _, v := range s.Query(tt.url, tt.rule, tt.from, tt.limit) {
+				actualValues = append(actualValues, v.Value)
+			}
+			require.Equal(t, tt.expectedValues, actualValues)
+		})
+	}
+}
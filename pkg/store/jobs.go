@@ -0,0 +1,56 @@
+package store
+
+import (
+	"time"
+
+	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+var _ ports.JobTracker = (*JobStore)(nil)
+
+// JobStore is a concurrency-safe in-memory ports.JobTracker. If the number of
+// tracked Jobs exceeds the defined capacity, the oldest Job is purged.
+type JobStore struct {
+	logger config.Logger
+	jobs   *Tracker[ports.Job]
+}
+
+// NewJobStore initialises a new JobStore which tracks up to capacity Jobs.
+func NewJobStore(logger config.Logger, capacity int) *JobStore {
+	return &JobStore{
+		logger: logger,
+		jobs:   NewTracker[ports.Job](capacity),
+	}
+}
+
+// Create creates a new queued Job for url. Create is concurrency safe.
+func (j *JobStore) Create(url string) ports.Job {
+	now := time.Now().UTC()
+	job := ports.Job{
+		ID:        NewID(),
+		URL:       url,
+		Status:    ports.JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	j.jobs.Add(job.ID, job)
+
+	return job
+}
+
+// Update transitions a Job to status, with an optional reason. Updates to
+// unknown (or purged) Jobs are ignored. Update is concurrency safe.
+func (j *JobStore) Update(id string, status ports.JobStatus, reason string) {
+	j.jobs.Update(id, func(job ports.Job) ports.Job {
+		job.Status = status
+		job.Reason = reason
+		job.UpdatedAt = time.Now().UTC()
+		return job
+	})
+}
+
+// Get fetches a Job by ID. Get is concurrency safe.
+func (j *JobStore) Get(id string) (ports.Job, bool) {
+	return j.jobs.Get(id)
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"jemgunay/url-scraper/pkg/ports"
+)
+
+func TestJobStore(t *testing.T) {
+	s := NewJobStore(zap.NewNop(), 3)
+
+	job := s.Create("url-1")
+	require.Len(t, job.ID, 32)
+	require.Equal(t, ports.JobQueued, job.Status)
+
+	s.Update(job.ID, ports.JobRejected, "unexpected HTTP response status: 404 Not Found")
+	actual, ok := s.Get(job.ID)
+	require.True(t, ok)
+	require.Equal(t, ports.JobRejected, actual.Status)
+	require.Equal(t, "unexpected HTTP response status: 404 Not Found", actual.Reason)
+	require.False(t, actual.UpdatedAt.Before(actual.CreatedAt))
+
+	// exceeding capacity should purge the oldest job
+	for i := 2; i <= 4; i++ {
+		s.Create(fmt.Sprintf("url-%d", i))
+	}
+	_, ok = s.Get(job.ID)
+	require.False(t, ok)
+	require.Len(t, s.jobs.lookup, 3)
+
+	// updating a purged job should be a no-op
+	s.Update(job.ID, ports.JobStored, "")
+	_, ok = s.Get(job.ID)
+	require.False(t, ok)
+}
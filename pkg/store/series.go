@@ -0,0 +1,143 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// series is a concurrency-safe time series of entries per URL. Entries older
+// than the retention period are pruned, as are the oldest entries of a URL once
+// it exceeds the per-URL capacity.
+type series[T any] struct {
+	retention time.Duration
+	capacity  int
+	timestamp func(entry T) time.Time
+
+	mu        *sync.RWMutex
+	entries   map[string][]T
+	lastPrune time.Time
+}
+
+// newSeries initialises a new series which retains up to capacity entries per
+// URL for the retention period. timestamp returns the time of an entry.
+func newSeries[T any](retention time.Duration, capacity int, timestamp func(entry T) time.Time) *series[T] {
+	return &series[T]{
+		retention: retention,
+		capacity:  capacity,
+		timestamp: timestamp,
+
+		mu:        &sync.RWMutex{},
+		entries:   make(map[string][]T),
+		lastPrune: time.Now().UTC(),
+	}
+}
+
+// record appends entry to url's series, unless accept is non-nil and returns
+// false for the existing entries, in which case false is returned.
+func (s *series[T]) record(url string, entry T, accept func(entries []T) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if accept != nil && !accept(s.entries[url]) {
+		return false
+	}
+
+	entries := append(s.entries[url], entry)
+	// entries are almost always recorded in order, but concurrent workers may
+	// occasionally race
+	if n := len(entries); n > 1 && s.timestamp(entries[n-1]).Before(s.timestamp(entries[n-2])) {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return s.timestamp(entries[i]).Before(s.timestamp(entries[j]))
+		})
+	}
+	if len(entries) > s.capacity {
+		entries = entries[len(entries)-s.capacity:]
+	}
+	s.entries[url] = entries
+
+	// periodically sweep every URL so that URLs which are no longer being
+	// benchmarked are eventually purged
+	now := time.Now().UTC()
+	if now.Sub(s.lastPrune) > time.Minute {
+		s.prune(now)
+		s.lastPrune = now
+	}
+	return true
+}
+
+// prune removes expired entries from every URL. The caller must hold the
+// write lock.
+func (s *series[T]) prune(now time.Time) {
+	cutoff := now.Add(-s.retention)
+	for url, entries := range s.entries {
+		i := sort.Search(len(entries), func(i int) bool {
+			return !s.timestamp(entries[i]).Before(cutoff)
+		})
+		if i == len(entries) {
+			delete(s.entries, url)
+			continue
+		}
+		s.entries[url] = entries[i:]
+	}
+}
+
+// query returns the entries recorded for url between from and to (inclusive)
+// which match, sorted by most recent first and truncated to limit. A zero from
+// or to leaves that end of the range unbounded, and a nil match matches every
+// entry.
+func (s *series[T]) query(url string, from, to time.Time, limit int, match func(entry T) bool) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().UTC().Add(-s.retention)
+	if from.IsZero() || from.Before(cutoff) {
+		from = cutoff
+	}
+
+	entries := s.entries[url]
+	results := make([]T, 0)
+	for i := len(entries) - 1; i >= 0 && len(results) < limit; i-- {
+		timestamp := s.timestamp(entries[i])
+		if !to.IsZero() && timestamp.After(to) {
+			continue
+		}
+		if timestamp.Before(from) {
+			break
+		}
+		if match == nil || match(entries[i]) {
+			results = append(results, entries[i])
+		}
+	}
+
+	return results
+}
+
+// all returns a copy of the unexpired entries of every URL.
+func (s *series[T]) all() map[string][]T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(time.Now().UTC())
+	all := make(map[string][]T, len(s.entries))
+	for url, entries := range s.entries {
+		all[url] = append([]T(nil), entries...)
+	}
+	return all
+}
+
+// restore replaces the entries of every URL, e.g. with those previously
+// returned by all.
+func (s *series[T]) restore(all map[string][]T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = make(map[string][]T, len(all))
+	for url, entries := range all {
+		if len(entries) > s.capacity {
+			entries = entries[len(entries)-s.capacity:]
+		}
+		s.entries[url] = entries
+	}
+	s.prune(time.Now().UTC())
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeries_Record(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	at := func(minutesAgo int) time.Time {
+		return now.Add(-time.Duration(minutesAgo) * time.Minute)
+	}
+	s := newSeries(time.Hour, 3, func(entry time.Time) time.Time {
+		return entry
+	})
+
+	// out of order entries are sorted and the oldest are purged beyond
+	// capacity
+	for _, entry := range []time.Time{at(30), at(10), at(20), at(0)} {
+		require.True(t, s.record("url-1", entry, nil))
+	}
+	require.Equal(t, []time.Time{at(0), at(10), at(20)}, s.query("url-1", time.Time{}, time.Time{}, 10, nil))
+
+	// rejected entries aren't recorded
+	require.False(t, s.record("url-1", at(0), func(entries []time.Time) bool {
+		return entries[len(entries)-1] != at(0)
+	}))
+	require.Len(t, s.entries["url-1"], 3)
+
+	// matching filters results without counting towards the limit
+	results := s.query("url-1", time.Time{}, time.Time{}, 1, func(entry time.Time) bool {
+		return entry.Before(at(15))
+	})
+	require.Equal(t, []time.Time{at(20)}, results)
+
+	// sweeping purges URLs whose entries have all expired
+	s.record("url-2", at(90), nil)
+	s.lastPrune = now.Add(-time.Hour)
+	s.record("url-1", at(0), nil)
+	require.NotContains(t, s.entries, "url-2")
+	require.Contains(t, s.entries, "url-1")
+}
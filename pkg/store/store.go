@@ -1,12 +1,13 @@
 package store
 
 import (
-	"fmt"
+	"reflect"
 	"sort"
 	"sync"
 	"time"
 
 	"jemgunay/url-scraper/pkg/config"
+	"jemgunay/url-scraper/pkg/metrics"
 	"jemgunay/url-scraper/pkg/ports"
 )
 
@@ -22,6 +23,7 @@ type Store struct {
 	mu           *sync.RWMutex
 	recordLookup map[string]*ports.Record
 	recordList   []*ports.Record
+	evictions    uint64
 }
 
 // New initialises a new Store ready to be read from/written to.
@@ -38,11 +40,18 @@ func New(logger config.Logger, recordCapacity int) *Store {
 }
 
 // Store stores a key into the store, or bumps the count if it has been
-// previously stored. Store is concurrency safe.
-func (s *Store) Store(key string) {
+// previously stored. The record's URLSpec is replaced by spec, unless spec is
+// nil. Store is concurrency safe.
+func (s *Store) Store(key string, spec *ports.URLSpec) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.upsert(key, time.Now().UTC(), spec)
+}
+
+// upsert stores or bumps key with the given upsert time, replacing its
+// URLSpec unless spec is nil. The caller must hold the write lock.
+func (s *Store) upsert(key string, upsertedAt time.Time, spec *ports.URLSpec) {
 	// store in uniqueness map if previously unseen, or bump existing entry
 	// so that we don't have to search the ports.Record list
 	val, ok := s.recordLookup[key]
@@ -51,8 +60,11 @@ func (s *Store) Store(key string) {
 			Key: key,
 		}
 	}
-	val.LastUpserted = time.Now().UTC()
+	val.LastUpserted = upsertedAt
 	val.SubmitCount++
+	if spec != nil {
+		val.URLSpec = *spec
+	}
 	s.recordLookup[key] = val
 
 	if ok {
@@ -76,26 +88,132 @@ func (s *Store) Store(key string) {
 		delete(s.recordLookup, recordToPurge.Key)
 		// truncate slice to purge item from list
 		s.recordList = s.recordList[:s.recordCapacity]
+		s.evictions++
 	}
+}
 
-	fmt.Println(len(s.recordList), len(s.recordLookup))
+// UpdateContent sets the content of a stored key, bumping its last changed
+// time to at if the content's hash differs from the previous one. It returns
+// the previous hash and whether the content changed. Keys which aren't stored
+// are ignored. UpdateContent is concurrency safe.
+func (s *Store) UpdateContent(key string, content ports.Content, at time.Time) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, changed, _ := s.updateContent(key, content, at)
+	return previous, changed
 }
 
-// Fetch fetches records given the specified criteria. Records are truncated to
-// the required limit, and are sorted as requested by sortBy and sortOrder.
-func (s *Store) Fetch(limit int, sortBy ports.SortBy, sortOrder ports.SortOrder) []ports.Record {
-	s.mu.RLock()
+// updateContent sets the content of key, additionally returning whether the
+// record was modified at all, e.g. by new cache validators. The caller must
+// hold the write lock.
+func (s *Store) updateContent(key string, content ports.Content, at time.Time) (string, bool, bool) {
+	val, ok := s.recordLookup[key]
+	if !ok {
+		return "", false, false
+	}
 
-	// copy so that the consumer doesn't mutate the original store list
+	previous := val.Content
+	if previous == content {
+		return previous.Hash, false, false
+	}
+	val.Content = content
+	if previous.Hash == content.Hash {
+		return previous.Hash, false, true
+	}
+	val.LastChanged = at
+	return previous.Hash, true, true
+}
+
+// UpdateTLS sets the TLS info of a stored key. Keys which aren't stored are
+// ignored. UpdateTLS is concurrency safe.
+func (s *Store) UpdateTLS(key string, info ports.TLSInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updateTLS(key, info)
+}
+
+// updateTLS sets the TLS info of key, returning whether the record was
+// modified. The caller must hold the write lock.
+func (s *Store) updateTLS(key string, info ports.TLSInfo) bool {
+	val, ok := s.recordLookup[key]
+	if !ok {
+		return false
+	}
+	if val.TLS != nil && reflect.DeepEqual(*val.TLS, info) {
+		return false
+	}
+	val.TLS = &info
+	return true
+}
+
+// UpdateMetadata sets the metadata of a stored key. Keys which aren't stored
+// are ignored. UpdateMetadata is concurrency safe.
+func (s *Store) UpdateMetadata(key string, metadata ports.Metadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updateMetadata(key, metadata)
+}
+
+// updateMetadata sets the metadata of key, returning whether the record was
+// modified. The caller must hold the write lock.
+func (s *Store) updateMetadata(key string, metadata ports.Metadata) bool {
+	val, ok := s.recordLookup[key]
+	if !ok {
+		return false
+	}
+	if val.Metadata != nil && reflect.DeepEqual(*val.Metadata, metadata) {
+		return false
+	}
+	val.Metadata = &metadata
+	return true
+}
+
+// restore replaces the store's dataset with records, which are expected to be
+// sorted by last upserted timestamp descending. The caller must hold the write
+// lock.
+func (s *Store) restore(records []ports.Record) {
+	s.recordLookup = make(map[string]*ports.Record, s.recordCapacity)
+	s.recordList = make([]*ports.Record, 0, s.recordCapacity+1)
+
+	for i := range records {
+		if len(s.recordList) == s.recordCapacity {
+			break
+		}
+		record := records[i]
+		s.recordLookup[record.Key] = &record
+		s.recordList = append(s.recordList, &record)
+	}
+}
+
+// records returns a copy of all records, sorted by last upserted timestamp
+// descending. The caller must hold at least the read lock.
+func (s *Store) records() []ports.Record {
 	recordListCopy := make([]ports.Record, 0, len(s.recordList))
 	for _, record := range s.recordList {
 		recordListCopy = append(recordListCopy, *record)
 	}
+	return recordListCopy
+}
 
+// Close is a no-op as Store holds no resources to release. It allows Store and
+// DiskStore to be used interchangeably.
+func (s *Store) Close() error {
+	return nil
+}
+
+// Fetch fetches records given the specified criteria. Records are truncated to
+// the required limit, and are sorted as requested by sortBy and sortOrder.
+func (s *Store) Fetch(limit int, sortBy ports.SortBy, sortOrder ports.SortOrder) []ports.Record {
+	s.mu.RLock()
+	// copy so that the consumer doesn't mutate the original store list
+	recordListCopy := s.records()
 	s.mu.RUnlock()
 
-	if limit > s.recordCapacity {
-		limit = s.recordCapacity
+	if limit > len(recordListCopy) {
+		limit = len(recordListCopy)
 	}
 
 	// by default, records will be sorted by age descending on insertion
@@ -114,3 +232,17 @@ func (s *Store) Fetch(limit int, sortBy ports.SortBy, sortOrder ports.SortOrder)
 
 	return recordListCopy[:limit]
 }
+
+// RegisterMetrics registers the store size and eviction metrics.
+func (s *Store) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("scraper_store_records", "Number of records in the store.", func() float64 {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return float64(len(s.recordList))
+	})
+	registry.NewCounterFunc("scraper_store_evictions_total", "Total records evicted from the store due to capacity.", func() float64 {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return float64(s.evictions)
+	})
+}
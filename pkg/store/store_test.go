@@ -2,15 +2,35 @@ package store
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
+	"jemgunay/url-scraper/pkg/metrics"
 	"jemgunay/url-scraper/pkg/ports"
 )
 
+// newStorers returns a constructor for each ports.Storer implementation so that
+// they can be run against the same behavioural tests.
+func newStorers(t *testing.T) map[string]func(capacity int) ports.Storer {
+	logger := zap.NewNop()
+
+	return map[string]func(capacity int) ports.Storer{
+		"memory": func(capacity int) ports.Storer {
+			return New(logger, capacity)
+		},
+		"disk": func(capacity int) ports.Storer {
+			s, err := NewDisk(logger, capacity, t.TempDir(), time.Hour, NewBenchmarkStore(logger, time.Hour, 10))
+			require.NoError(t, err)
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+}
+
 func TestStore_Store(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -38,32 +58,173 @@ func TestStore_Store(t *testing.T) {
 		},
 	}
 
-	logger := zap.NewNop()
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := New(logger, 5)
+	for storerName, newStorer := range newStorers(t) {
+		for _, tt := range tests {
+			t.Run(storerName+"/"+tt.name, func(t *testing.T) {
+				s := newStorer(5)
+				populate(s, 10)
 
-			for i := 0; i < 10; i++ {
-				key := fmt.Sprintf("url-%d", i+1)
+				actualRecords := s.Fetch(tt.limit, tt.sortBy, tt.sortOrder)
 
-				for j := 0; j < i+1; j++ {
-					s.Store(key)
+				var actualKeys []string
+				var actualCounts []int
+				for _, k := range actualRecords {
+					actualKeys = append(actualKeys, k.Key)
+					actualCounts = append(actualCounts, k.SubmitCount)
 				}
+				require.Equal(t, tt.expectedKeys, actualKeys)
+				require.Equal(t, tt.expectedCounts, actualCounts)
+			})
+		}
+	}
+}
+
+func TestStore_Store_Spec(t *testing.T) {
+	spec := &ports.URLSpec{Assertions: &ports.Assertions{StatusCodes: []string{"204"}}}
+	otherSpec := &ports.URLSpec{Assertions: &ports.Assertions{BodyContains: "ok"}}
+
+	for name, newStorer := range newStorers(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newStorer(5)
 
-				time.Sleep(time.Millisecond * 10)
-			}
+			s.Store("url", spec)
+			require.Equal(t, *spec, s.Fetch(1, ports.Age, ports.Descending)[0].URLSpec)
 
-			actualRecords := s.Fetch(tt.limit, tt.sortBy, tt.sortOrder)
+			// a nil spec retains the existing spec
+			s.Store("url", nil)
+			require.Equal(t, *spec, s.Fetch(1, ports.Age, ports.Descending)[0].URLSpec)
 
-			var actualKeys []string
-			var actualCounts []int
-			for _, k := range actualRecords {
-				actualKeys = append(actualKeys, k.Key)
-				actualCounts = append(actualCounts, k.SubmitCount)
-			}
-			require.Equal(t, tt.expectedKeys, actualKeys)
-			require.Equal(t, tt.expectedCounts, actualCounts)
+			s.Store("url", otherSpec)
+			record := s.Fetch(1, ports.Age, ports.Descending)[0]
+			require.Equal(t, *otherSpec, record.URLSpec)
+			require.Equal(t, 3, record.SubmitCount)
 		})
 	}
 }
+
+func TestStore_UpdateContent(t *testing.T) {
+	first := time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC)
+	second := first.Add(time.Minute)
+
+	for name, newStorer := range newStorers(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newStorer(5)
+			content := ports.Content{Hash: "hash-1", Size: 10, ETag: `"v1"`}
+
+			// keys which aren't stored are ignored
+			previous, changed := s.UpdateContent("url", content, first)
+			require.False(t, changed)
+			require.Empty(t, previous)
+
+			s.Store("url", nil)
+			previous, changed = s.UpdateContent("url", content, first)
+			require.True(t, changed)
+			require.Empty(t, previous)
+
+			// new validators for an unchanged hash don't bump the last changed
+			// time
+			content.ETag = `"v2"`
+			previous, changed = s.UpdateContent("url", content, second)
+			require.False(t, changed)
+			require.Equal(t, "hash-1", previous)
+			record := s.Fetch(1, ports.Age, ports.Descending)[0]
+			require.Equal(t, content, record.Content)
+			require.Equal(t, first, record.LastChanged)
+
+			content.Hash = "hash-2"
+			previous, changed = s.UpdateContent("url", content, second)
+			require.True(t, changed)
+			require.Equal(t, "hash-1", previous)
+			record = s.Fetch(1, ports.Age, ports.Descending)[0]
+			require.Equal(t, content, record.Content)
+			require.Equal(t, second, record.LastChanged)
+			require.Equal(t, 1, record.SubmitCount)
+		})
+	}
+}
+
+func TestStore_UpdateTLS(t *testing.T) {
+	info := ports.TLSInfo{
+		Version:   "TLS 1.3",
+		Chain:     []ports.Certificate{{Subject: "CN=example.com"}},
+		ExpiresAt: time.Date(2023, 4, 5, 17, 0, 0, 0, time.UTC),
+	}
+
+	for name, newStorer := range newStorers(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newStorer(5)
+
+			// keys which aren't stored are ignored
+			s.UpdateTLS("url", info)
+			require.Empty(t, s.Fetch(1, ports.Age, ports.Descending))
+
+			s.Store("url", nil)
+			s.UpdateTLS("url", info)
+			record := s.Fetch(1, ports.Age, ports.Descending)[0]
+			require.Equal(t, &info, record.TLS)
+			require.Equal(t, 1, record.SubmitCount)
+		})
+	}
+}
+
+func TestStore_UpdateMetadata(t *testing.T) {
+	metadata := ports.Metadata{
+		Title:     "Example",
+		OpenGraph: map[string]string{"title": "Example"},
+	}
+
+	for name, newStorer := range newStorers(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newStorer(5)
+
+			// keys which aren't stored are ignored
+			s.UpdateMetadata("url", metadata)
+			require.Empty(t, s.Fetch(1, ports.Age, ports.Descending))
+
+			s.Store("url", nil)
+			s.UpdateMetadata("url", metadata)
+			record := s.Fetch(1, ports.Age, ports.Descending)[0]
+			require.Equal(t, &metadata, record.Metadata)
+			require.Equal(t, 1, record.SubmitCount)
+		})
+	}
+}
+
+func TestStore_Fetch_LimitExceedsRecords(t *testing.T) {
+	for storerName, newStorer := range newStorers(t) {
+		t.Run(storerName, func(t *testing.T) {
+			s := newStorer(5)
+			populate(s, 2)
+
+			records := s.Fetch(10, ports.Count, ports.Descending)
+			require.Len(t, records, 2)
+			require.Equal(t, "url-2", records[0].Key)
+		})
+	}
+}
+
+func TestStore_RegisterMetrics(t *testing.T) {
+	s := New(zap.NewNop(), 5)
+	registry := metrics.NewRegistry()
+	s.RegisterMetrics(registry)
+	populate(s, 10)
+
+	b := &strings.Builder{}
+	_, err := registry.WriteTo(b)
+	require.NoError(t, err)
+	require.Contains(t, b.String(), "scraper_store_records 5\n")
+	require.Contains(t, b.String(), "scraper_store_evictions_total 5\n")
+}
+
+// populate stores keys url-1 to url-n, where url-i is stored i times.
+func populate(s ports.Storer, n int) {
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("url-%d", i+1)
+
+		for j := 0; j < i+1; j++ {
+			s.Store(key, nil)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
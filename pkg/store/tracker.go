@@ -0,0 +1,74 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// Tracker is a concurrency-safe in-memory store of values by ID. If the number
+// of tracked values exceeds the defined capacity, the oldest value is purged.
+type Tracker[T any] struct {
+	capacity int
+
+	mu     *sync.RWMutex
+	lookup map[string]T
+	// order is a FIFO of IDs by creation time, used to purge the oldest
+	order []string
+}
+
+// NewTracker initialises a new Tracker which tracks up to capacity values.
+func NewTracker[T any](capacity int) *Tracker[T] {
+	return &Tracker[T]{
+		capacity: capacity,
+
+		mu:     &sync.RWMutex{},
+		lookup: make(map[string]T, capacity),
+		order:  make([]string, 0, capacity+1),
+	}
+}
+
+// Add tracks value by id, purging the oldest value if the Tracker exceeds its
+// capacity. Add is concurrency safe.
+func (t *Tracker[T]) Add(id string, value T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lookup[id] = value
+	t.order = append(t.order, id)
+	if len(t.order) > t.capacity {
+		delete(t.lookup, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// Update replaces the value of id with the result of update, returning false
+// if id is unknown (or purged). Update is concurrency safe.
+func (t *Tracker[T]) Update(id string, update func(value T) T) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	value, ok := t.lookup[id]
+	if !ok {
+		return false
+	}
+	t.lookup[id] = update(value)
+	return true
+}
+
+// Get fetches a value by ID. Get is concurrency safe.
+func (t *Tracker[T]) Get(id string) (T, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	value, ok := t.lookup[id]
+	return value, ok
+}
+
+// NewID generates a random 128-bit hex encoded ID.
+func NewID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error on supported platforms
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
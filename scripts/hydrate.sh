@@ -1,6 +1,16 @@
 #!/bin/bash
 
 url_count=60
+max_batch_size=100
+
+batch=()
+
+flush() {
+  if ((${#batch[@]} > 0)); then
+    printf '%s\n' "${batch[@]}" | curl -XPOST http://localhost:8080/api/v1/urls:batch --data-binary @-
+    batch=()
+  fi
+}
 
 for ((i = 1; i <= url_count; i++)); do
   url="https://httpbin.org/get?val=${i}"
@@ -8,6 +18,11 @@ for ((i = 1; i <= url_count; i++)); do
   req_count=$((1 + $RANDOM % 5))
 
   for ((j = 1; j <= req_count; j++)); do
-    curl -XPOST http://localhost:8080/api/v1/urls -d "{\"url\": \"${url}\"}"
+    batch+=("${url}")
+    if ((${#batch[@]} == max_batch_size)); then
+      flush
+    fi
   done
 done
+
+flush